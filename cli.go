@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"library-management-system/database"
+	"library-management-system/server"
+	"library-management-system/server/csvio"
+	"library-management-system/server/marc"
+	"library-management-system/server/queries"
+	"os"
+	"strings"
+)
+
+const usage = `Usage:
+  library-management-system                       run the server
+  library-management-system import books|cards [-dry-run] [-best-effort] [-column Header=column]... FILE
+  library-management-system import books -format marc|marcxml [-category-field 650$a] FILE
+  library-management-system export books|cards [-format csv|marc|marcxml] [-category-field 650$a] [FILE]`
+
+// columnFlag collects the mapping of headers to columns given by repeating -column
+type columnFlag map[string]string
+
+func (f columnFlag) String() string {
+	return fmt.Sprint(map[string]string(f))
+}
+
+func (f columnFlag) Set(value string) error {
+	name, column, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expect Header=column")
+	}
+	f[name] = column
+	return nil
+}
+
+// runCommand runs the command of the arguments against the database,
+// and returns the exit code
+func runCommand(args []string) int {
+	if len(args) < 2 || (args[1] != "books" && args[1] != "cards") {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	switch args[0] {
+	case "import":
+		return importCommand(args[1], args[2:])
+	case "export":
+		return exportCommand(args[1], args[2:])
+	}
+	fmt.Fprintln(os.Stderr, usage)
+	return 2
+}
+
+func importCommand(what string, args []string) int {
+	flags := flag.NewFlagSet("import "+what, flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "check the rows against the database, then roll back")
+	bestEffort := flags.Bool("best-effort", false, "import the valid rows even if some rows fail")
+	columns := columnFlag{}
+	flags.Var(columns, "column", "map a header to a column, or to nothing if the column is empty")
+	format := flags.String("format", "csv", "csv, or marc (ISO 2709) or marcxml for books")
+	category := flags.String("category-field", "", "subfield of the category in MARC records, as configured if empty")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || (*format != "csv" && what != "books") {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to open the file: ", err)
+		return 1
+	}
+	defer file.Close()
+
+	s := server.Server{}
+	if *format != "csv" {
+		result := s.ImportMARC(file, queries.MARCOptions{Format: queries.MARCFormat(*format), CategoryField: *category})
+		if importResult, ok := result.Payload.(queries.MARCImportResult); ok {
+			for _, recordError := range importResult.Errors {
+				fmt.Fprintf(os.Stderr, "record %d %s: %s\n", recordError.Record, recordError.Control, recordError.Message)
+			}
+		}
+		fmt.Println(result.Message)
+		if !result.Ok {
+			return 1
+		}
+		return 0
+	}
+
+	options := queries.ImportOptions{Mode: queries.AllOrNothing, DryRun: *dryRun, Columns: columns}
+	if *bestEffort {
+		options.Mode = queries.BestEffort
+	}
+	var result database.APIResult
+	if what == "books" {
+		result = s.ImportBooks(file, options)
+	} else {
+		result = s.ImportCards(file, options)
+	}
+	if importResult, ok := result.Payload.(queries.ImportResult); ok {
+		for _, rowError := range importResult.Errors {
+			fmt.Fprintf(os.Stderr, "line %d: %s (%s)\n", rowError.Line, rowError.Message, rowError.Code)
+		}
+	}
+	fmt.Println(result.Message)
+	if !result.Ok {
+		return 1
+	}
+	return 0
+}
+
+func exportCommand(what string, args []string) int {
+	flags := flag.NewFlagSet("export "+what, flag.ContinueOnError)
+	format := flags.String("format", "csv", "csv, or marc (ISO 2709) or marcxml for books")
+	category := flags.String("category-field", "", "subfield of the category in MARC records, as configured if empty")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 || (*format != "csv" && what != "books") {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	mapping := server.MARC
+	if *category != "" {
+		var err error
+		if mapping.Category, err = marc.ParseFieldSpec(*category); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	var out io.Writer = os.Stdout
+	if flags.NArg() == 1 {
+		file, err := os.Create(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to create the file: ", err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	s := server.Server{}
+	var result database.APIResult
+	var err error
+	if what == "books" {
+		if result = s.QueryBooks(queries.BookQueryConditions{}); result.Ok {
+			err = writeBooks(out, result.Payload.(queries.BookQueryResults).Results, *format, mapping)
+		}
+	} else {
+		if result = s.ShowCards(); result.Ok {
+			err = csvio.WriteCards(out, result.Payload.(queries.CardList).Cards)
+		}
+	}
+	if !result.Ok {
+		fmt.Fprintln(os.Stderr, result.Message)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write the file: ", err)
+		return 1
+	}
+	return 0
+}
+
+// writeBooks writes the books in the format, with the category of MARC records by the mapping
+func writeBooks(w io.Writer, books []database.Book, format string, mapping marc.Mapping) error {
+	records := make([]*marc.Record, 0, len(books))
+	for _, book := range books {
+		records = append(records, marc.FromBook(book, mapping))
+	}
+	switch queries.MARCFormat(format) {
+	case queries.ISO2709:
+		return marc.WriteRecords(w, records)
+	case queries.MARCXML:
+		return marc.WriteXML(w, records)
+	case "csv":
+		return csvio.WriteBooks(w, books)
+	}
+	return fmt.Errorf("invalid format %q, expect csv, marc or marcxml", format)
+}
@@ -0,0 +1,290 @@
+// Package client calls the API of a library management system server over HTTP.
+// Client implements utils.ServerInterface, so that the same scripts and tests
+// run against a deployed server.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"library-management-system/database"
+	"library-management-system/server/queries"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type Client struct {
+	BaseURL string // e.g. http://localhost:8080
+	HTTP    *http.Client
+	Token   string // sent as the bearer token, see Login
+}
+
+// New returns a client of the server at baseURL
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		HTTP:    http.DefaultClient,
+	}
+}
+
+// Login
+// logs in to the server, and sends the token with the following requests
+// after successfully completing this operation.
+func (c *Client) Login(username string, password string) database.APIResult {
+	body := map[string]string{"username": username, "password": password}
+	session := queries.Session{}
+	result := c.do(http.MethodPost, "/api/auth/login", nil, body, &session)
+	if result.Ok {
+		c.Token = session.Token
+	}
+	return result
+}
+
+/* Interface for books */
+
+// StoreBook
+// BookID and the normalized ISBN are stored to book after
+// successfully completing this operation.
+func (c *Client) StoreBook(book *database.Book) database.APIResult {
+	stored := database.Book{}
+	result := c.do(http.MethodPost, "/api/book/add", nil, book, &stored)
+	if result.Ok {
+		book.BookId, book.ISBN = stored.BookId, stored.ISBN
+		result.Payload = book
+	}
+	return result
+}
+
+func (c *Client) IncBookStock(bookId int, deltaStock int) database.APIResult {
+	body := map[string]int{"book_id": bookId, "delta_stock": deltaStock}
+	return c.do(http.MethodPut, "/api/book/stock", nil, body, nil)
+}
+
+// StoreBooks
+// BookIDs and the normalized ISBNs are stored to books after
+// successfully completing this operation.
+func (c *Client) StoreBooks(books []*database.Book) database.APIResult {
+	list := queries.BookList{
+		Count: len(books),
+		Books: make([]database.Book, 0, len(books)),
+	}
+	for _, book := range books {
+		list.Books = append(list.Books, *book)
+	}
+	stored := queries.BookList{}
+	result := c.do(http.MethodPost, "/api/book/adds", nil, list, &stored)
+	if result.Ok && len(stored.Books) != len(books) {
+		return database.APIResult{
+			Ok:      false,
+			Message: fmt.Sprintf("Failed to store books, %d of %d books are returned", len(stored.Books), len(books)),
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	for i, book := range books {
+		book.BookId = 0
+		if result.Ok {
+			book.BookId, book.ISBN = stored.Books[i].BookId, stored.Books[i].ISBN
+		}
+	}
+	return result
+}
+
+func (c *Client) RemoveBook(bookId int) database.APIResult {
+	params := url.Values{"book_id": {strconv.Itoa(bookId)}}
+	return c.do(http.MethodDelete, "/api/book/remove", params, nil, nil)
+}
+
+func (c *Client) ModifyBookInfo(book *database.Book) database.APIResult {
+	modified := database.Book{}
+	result := c.do(http.MethodPut, "/api/book/modify", nil, book, &modified)
+	if result.Ok {
+		book.ISBN = modified.ISBN
+		result.Payload = book
+	}
+	return result
+}
+
+// QueryBooks
+//
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.BookQueryResults}
+func (c *Client) QueryBooks(conditions queries.BookQueryConditions) database.APIResult {
+	params := url.Values{}
+	set := func(key string, value string) {
+		if value != "" {
+			params.Set(key, value)
+		}
+	}
+	setNumber := func(key string, value float64) {
+		if value != 0 {
+			params.Set(key, strconv.FormatFloat(value, 'f', -1, 64))
+		}
+	}
+	setList := func(key string, values []string) {
+		for _, value := range values {
+			params.Add(key, value)
+		}
+	}
+	set("q", conditions.Q)
+	set("category", conditions.Category)
+	set("title", conditions.Title)
+	set("press", conditions.Press)
+	setNumber("min_publish_year", float64(conditions.MinPublishYear))
+	setNumber("max_publish_year", float64(conditions.MaxPublishYear))
+	set("author", conditions.Author)
+	set("contributor", conditions.Contributor)
+	set("role", conditions.Role)
+	set("isbn", conditions.ISBN)
+	setNumber("min_price", conditions.MinPrice)
+	setNumber("max_price", conditions.MaxPrice)
+	set("match", string(conditions.Match))
+	setList("categories", conditions.Categories)
+	setList("presses", conditions.Presses)
+	setList("authors", conditions.Authors)
+	setList("exclude_categories", conditions.ExcludeCategories)
+	setList("exclude_presses", conditions.ExcludePresses)
+	setList("exclude_authors", conditions.ExcludeAuthors)
+	if conditions.InStock {
+		params.Set("in_stock", "true")
+	}
+	set("sort_by", string(conditions.SortBy))
+	set("sort_order", string(conditions.SortOrder))
+	setNumber("limit", float64(conditions.Limit))
+	setNumber("offset", float64(conditions.Offset))
+	set("cursor", conditions.Cursor)
+	if conditions.Facets {
+		params.Set("facets", "true")
+	}
+	return c.do(http.MethodGet, "/api/book/query", params, nil, &queries.BookQueryResults{})
+}
+
+/* Interface for borrow & return books */
+
+func (c *Client) BorrowBook(borrow database.Borrow) database.APIResult {
+	return c.do(http.MethodPost, "/api/borrow/add", nil, borrow, nil)
+}
+
+// ReturnBook
+// the server returns the book now if borrow.ReturnTime is 0.
+func (c *Client) ReturnBook(borrow database.Borrow) database.APIResult {
+	fine := database.Fine{}
+	result := c.do(http.MethodPost, "/api/borrow/return", nil, borrow, &fine)
+	if result.Ok && result.Payload != nil {
+		result.Payload = &fine
+	}
+	return result
+}
+
+// ShowBorrowHistories
+//
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.BorrowHistories}
+func (c *Client) ShowBorrowHistories(cardId int) database.APIResult {
+	params := url.Values{"card_id": {strconv.Itoa(cardId)}}
+	return c.do(http.MethodGet, "/api/borrow/query", params, nil, &queries.BorrowHistories{})
+}
+
+/* Interface for cards */
+
+// RegisterCard
+// CardID is stored to card after successfully completing this operation.
+func (c *Client) RegisterCard(card *database.Card) database.APIResult {
+	var cardId int
+	result := c.do(http.MethodPost, "/api/card/add", nil, card, &cardId)
+	if result.Ok {
+		card.CardId = cardId
+	}
+	return result
+}
+
+func (c *Client) RemoveCard(cardId int) database.APIResult {
+	params := url.Values{"card_id": {strconv.Itoa(cardId)}}
+	return c.do(http.MethodDelete, "/api/card/remove", params, nil, nil)
+}
+
+// ShowCards
+//
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.CardList}
+func (c *Client) ShowCards() database.APIResult {
+	return c.do(http.MethodGet, "/api/card/query", nil, nil, &queries.CardList{})
+}
+
+// do sends a request with the query params and the body in JSON, and decodes
+// the payload of a successful response into the value payload points to, which
+// becomes the payload of the result. the payload is decoded as encoding/json does
+// by default if payload is nil or the request failed.
+func (c *Client) do(method string, path string, params url.Values, body interface{}, payload interface{}) database.APIResult {
+	failure := func(err error) database.APIResult {
+		return database.APIResult{
+			Ok:      false,
+			Message: fmt.Sprintf("Failed to request %s %s, %v", method, path, err),
+			Payload: err,
+			Code:    database.ErrInternal,
+		}
+	}
+
+	endpoint := c.BaseURL + path
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return failure(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return failure(err)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	response, err := c.HTTP.Do(request)
+	if err != nil {
+		return failure(err)
+	}
+	defer response.Body.Close()
+
+	var raw struct {
+		Ok      bool               `json:"ok"`
+		Message string             `json:"message"`
+		Payload json.RawMessage    `json:"payload"`
+		Code    database.ErrorCode `json:"code"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&raw); err != nil {
+		return failure(fmt.Errorf("unexpected response %s: %w", response.Status, err))
+	}
+	result := database.APIResult{
+		Ok:      raw.Ok,
+		Message: raw.Message,
+		Payload: nil,
+		Code:    raw.Code,
+	}
+	if len(raw.Payload) == 0 || string(raw.Payload) == "null" {
+		return result
+	}
+	if !raw.Ok || payload == nil {
+		_ = json.Unmarshal(raw.Payload, &result.Payload)
+		return result
+	}
+	if err := json.Unmarshal(raw.Payload, payload); err != nil {
+		return failure(fmt.Errorf("unexpected payload: %w", err))
+	}
+	result.Payload = reflect.ValueOf(payload).Elem().Interface()
+	return result
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"fmt"
+	"library-management-system/database"
+	"library-management-system/server"
+	"library-management-system/server/auth"
+	"library-management-system/utils/apitest"
+	"net/http/httptest"
+	"testing"
+)
+
+var client *Client
+
+// admin configures the account the client logs in with
+var admin auth.Config
+
+func TestMain(m *testing.M) {
+	config, cleanup, err := apitest.ConnectDatabase("../config.yaml")
+	if err != nil {
+		fmt.Println("Failed to connect database: ", err)
+		return
+	}
+	defer cleanup()
+	server.InitPolicy(config)
+	admin.Admin.Username, admin.Admin.Password = "admin", "client-test"
+	server.InitAuth(admin)
+
+	// Serve the API in process
+	api := httptest.NewServer(server.NewHandler())
+	defer api.Close()
+	client = New(api.URL)
+	if result := client.Login("admin", "client-test"); !result.Ok {
+		fmt.Println("Failed to log in: ", result.Message)
+		return
+	}
+	m.Run()
+}
+
+// reset resets the database, then creates the admin again and logs in with
+// it, since its token is revoked with the account
+func reset() {
+	database.ResetDatabase()
+	server.InitAuth(admin)
+	client.Token = ""
+	if result := client.Login("admin", "client-test"); !result.Ok {
+		fmt.Println("Failed to log in: ", result.Message)
+	}
+}
+
+// target is the server under the shared test scenarios
+func target() apitest.Target {
+	return apitest.Target{
+		Server: client,
+		Reset:  reset,
+		Policy: server.Policy,
+	}
+}
+
+func TestBookRegister(t *testing.T) {
+	apitest.BookRegister(t, target())
+}
+
+func TestIncBookStock(t *testing.T) {
+	apitest.IncBookStock(t, target())
+}
+
+func TestBulkRegisterBook(t *testing.T) {
+	apitest.BulkRegisterBook(t, target())
+}
+
+func TestRemoveBook(t *testing.T) {
+	apitest.RemoveBook(t, target())
+}
+
+func TestModifyBookInfo(t *testing.T) {
+	apitest.ModifyBookInfo(t, target())
+}
+
+func TestQueryBook(t *testing.T) {
+	apitest.QueryBook(t, target())
+}
+
+func TestBorrowAndReturnBook(t *testing.T) {
+	apitest.BorrowAndReturnBook(t, target())
+}
+
+func TestParallelBorrowBook(t *testing.T) {
+	apitest.ParallelBorrowBook(t, target())
+}
+
+func TestRegisterAndShowAndRemoveCard(t *testing.T) {
+	apitest.RegisterAndShowAndRemoveCard(t, target())
+}
+
+func TestErrorCodes(t *testing.T) {
+	apitest.ErrorCodes(t, target())
+}
+
+func TestPaginateBooks(t *testing.T) {
+	apitest.PaginateBooks(t, target())
+}
+
+func TestSearchBooks(t *testing.T) {
+	apitest.SearchBooks(t, target())
+}
+
+func TestFacetBooks(t *testing.T) {
+	apitest.FacetBooks(t, target())
+}
+
+func TestFilterAuthors(t *testing.T) {
+	apitest.FilterAuthors(t, target())
+}
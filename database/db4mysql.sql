@@ -1,3 +1,10 @@
+drop table if exists `account`;
+drop table if exists `credit`;
+drop table if exists `contributor`;
+drop table if exists `copy`;
+drop table if exists `ledger`;
+drop table if exists `fine`;
+drop table if exists `hold`;
 drop table if exists `borrow`;
 drop table if exists `card`;
 drop table if exists `book`;
@@ -9,10 +16,13 @@ create table `book` (
     `press` varchar(63) not null,
     `publish_year` int not null,
     `author` varchar(63) not null,
+    `isbn` varchar(13) default null,
     `price` decimal(7, 2) not null default 0.00,
     `stock` int not null default 0,
     primary key (`book_id`),
-    unique (`category`, `press`, `author`, `title`, `publish_year`)
+    unique (`category`, `press`, `author`, `title`, `publish_year`),
+    unique (`isbn`),
+    fulltext `idx_book_search` (`title`, `author`, `category`, `press`)
 ) engine=innodb charset=utf8mb4;
 
 create table `card` (
@@ -30,7 +40,99 @@ create table `borrow` (
   `book_id` int not null,
   `borrow_time` bigint not null,
   `return_time` bigint not null default 0,
+  `due_time` bigint not null default 0,
+  `renewals` int not null default 0,
+  `copy_id` int not null default 0,
   primary key (`card_id`, `book_id`, `borrow_time`),
   foreign key (`card_id`) references `card`(`card_id`) on delete cascade on update cascade,
   foreign key (`book_id`) references `book`(`book_id`) on delete cascade on update cascade
-) engine=innodb charset=utf8mb4;
\ No newline at end of file
+) engine=innodb charset=utf8mb4;
+
+create table `hold` (
+  `card_id` int not null,
+  `book_id` int not null,
+  `hold_time` bigint not null,
+  `status` varchar(15) not null default 'waiting',
+  `ready_time` bigint not null default 0,
+  `expire_time` bigint not null default 0,
+  `copy_id` int not null default 0,
+  primary key (`card_id`, `book_id`, `hold_time`),
+  index (`book_id`, `hold_time`),
+  foreign key (`card_id`) references `card`(`card_id`) on delete cascade on update cascade,
+  foreign key (`book_id`) references `book`(`book_id`) on delete cascade on update cascade
+) engine=innodb charset=utf8mb4;
+
+create table `fine` (
+  `fine_id` int not null auto_increment,
+  `card_id` int not null,
+  `book_id` int not null,
+  `borrow_time` bigint not null,
+  `days_late` int not null,
+  `amount` decimal(7, 2) not null,
+  `settled` decimal(7, 2) not null default 0.00,
+  `create_time` bigint not null,
+  primary key (`fine_id`),
+  index (`card_id`),
+  foreign key (`card_id`) references `card`(`card_id`) on delete cascade on update cascade
+) engine=innodb charset=utf8mb4;
+
+create table `ledger` (
+  `ledger_id` int not null auto_increment,
+  `fine_id` int not null,
+  `card_id` int not null,
+  `kind` varchar(15) not null,
+  `amount` decimal(7, 2) not null,
+  `time` bigint not null,
+  `note` varchar(255) not null default '',
+  primary key (`ledger_id`),
+  index (`fine_id`),
+  index (`card_id`),
+  check ( `kind` in ('payment', 'waiver') ),
+  foreign key (`fine_id`) references `fine`(`fine_id`) on delete cascade on update cascade
+) engine=innodb charset=utf8mb4;
+
+create table `copy` (
+  `copy_id` int not null auto_increment,
+  `book_id` int not null,
+  `barcode` varchar(31) not null,
+  `location` varchar(63) not null default '',
+  `copy_condition` varchar(63) not null default '',
+  `status` varchar(15) not null default 'available',
+  primary key (`copy_id`),
+  unique (`barcode`),
+  index (`book_id`),
+  index (`status`),
+  foreign key (`book_id`) references `book`(`book_id`) on delete cascade on update cascade
+) engine=innodb charset=utf8mb4;
+
+create table `contributor` (
+  `contributor_id` int not null auto_increment,
+  `name` varchar(63) not null,
+  primary key (`contributor_id`),
+  unique (`name`)
+) engine=innodb charset=utf8mb4;
+
+create table `credit` (
+  `book_id` int not null,
+  `contributor_id` int not null,
+  `role` varchar(15) not null,
+  `position` int not null default 0,
+  primary key (`book_id`, `contributor_id`, `role`),
+  index (`contributor_id`),
+  check ( `role` in ('author', 'editor', 'translator', 'illustrator') ),
+  foreign key (`book_id`) references `book`(`book_id`) on delete cascade on update cascade,
+  foreign key (`contributor_id`) references `contributor`(`contributor_id`) on delete cascade on update cascade
+) engine=innodb charset=utf8mb4;
+
+create table `account` (
+  `account_id` int not null auto_increment,
+  `username` varchar(63) not null,
+  `password_hash` varchar(255) not null,
+  `role` varchar(15) not null,
+  `card_id` int default null,
+  primary key (`account_id`),
+  unique (`username`),
+  index (`card_id`),
+  check ( `role` in ('admin', 'librarian', 'patron') ),
+  foreign key (`card_id`) references `card`(`card_id`) on delete cascade on update cascade
+) engine=innodb charset=utf8mb4;
@@ -0,0 +1,77 @@
+package database
+
+import "net/http"
+
+// ErrorCode tells why a request failed, and is stable for clients to
+// match on, unlike APIResult.Message which is written for humans.
+type ErrorCode string
+
+const (
+	ErrInvalidArgument    ErrorCode = "INVALID_ARGUMENT"    // the request cannot be parsed
+	ErrInvalidISBN        ErrorCode = "INVALID_ISBN"        // the ISBN has a wrong length, character or checksum
+	ErrInvalidStock       ErrorCode = "INVALID_STOCK"       // the stock becomes negative
+	ErrInvalidTime        ErrorCode = "INVALID_TIME"        // the book is returned before it was borrowed
+	ErrInvalidCardType    ErrorCode = "INVALID_CARD_TYPE"   // the card type is neither T nor S
+	ErrInvalidContributor ErrorCode = "INVALID_CONTRIBUTOR" // the contributor has no name, an unknown role or is listed twice
+	ErrInvalidStatus      ErrorCode = "INVALID_STATUS"      // the copy status is unknown
+	ErrInvalidAmount      ErrorCode = "INVALID_AMOUNT"      // the amount is not positive or exceeds the unpaid fines
+	ErrInvalidAccount     ErrorCode = "INVALID_ACCOUNT"     // the account has an unknown role, a short password or a wrong card
+	ErrInvalidRows        ErrorCode = "INVALID_ROWS"        // some rows of an import are invalid or conflict, nothing is imported
+
+	ErrUnauthorized ErrorCode = "UNAUTHORIZED" // the request has no valid token, or the login is wrong
+	ErrForbidden    ErrorCode = "FORBIDDEN"    // the role of the account is not permitted to the request
+
+	ErrBookNotFound    ErrorCode = "BOOK_NOT_FOUND"
+	ErrCardNotFound    ErrorCode = "CARD_NOT_FOUND"
+	ErrCopyNotFound    ErrorCode = "COPY_NOT_FOUND"
+	ErrBorrowNotFound  ErrorCode = "BORROW_NOT_FOUND" // the book is not borrowed by the card
+	ErrHoldNotFound    ErrorCode = "HOLD_NOT_FOUND"
+	ErrAccountNotFound ErrorCode = "ACCOUNT_NOT_FOUND"
+	ErrFineNotFound    ErrorCode = "FINE_NOT_FOUND" // no unpaid fine is found
+
+	ErrDuplicateBook    ErrorCode = "DUPLICATE_BOOK"
+	ErrDuplicateISBN    ErrorCode = "DUPLICATE_ISBN"
+	ErrDuplicateCard    ErrorCode = "DUPLICATE_CARD"
+	ErrDuplicateBarcode ErrorCode = "DUPLICATE_BARCODE"
+	ErrDuplicateAccount ErrorCode = "DUPLICATE_ACCOUNT"
+	ErrBookOutOfStock   ErrorCode = "BOOK_OUT_OF_STOCK"
+	ErrBookInStock      ErrorCode = "BOOK_IN_STOCK"    // a hold is placed on a book that can be borrowed
+	ErrBookOnLoan       ErrorCode = "BOOK_ON_LOAN"     // the book to remove has un-returned copies
+	ErrBookReserved     ErrorCode = "BOOK_RESERVED"    // another patron is waiting for the book
+	ErrCopyUnavailable  ErrorCode = "COPY_UNAVAILABLE" // the copy is on loan, on hold or not in circulation
+	ErrAlreadyBorrowed  ErrorCode = "ALREADY_BORROWED" // the card has not returned the book
+	ErrAlreadyOnHold    ErrorCode = "ALREADY_ON_HOLD"
+	ErrCardHasLoans     ErrorCode = "CARD_HAS_LOANS"     // the card to remove has un-returned books
+	ErrCardHasFines     ErrorCode = "CARD_HAS_FINES"     // the card to remove has unpaid fines
+	ErrLastAdmin        ErrorCode = "LAST_ADMIN"         // the account to remove is the only admin
+	ErrFineOfOtherCard  ErrorCode = "FINE_OF_OTHER_CARD" // the fine to pay is charged to another card
+
+	ErrLoanLimit    ErrorCode = "LOAN_LIMIT"    // the card has reached the limit of concurrent loans
+	ErrFineLimit    ErrorCode = "FINE_LIMIT"    // the card has reached the limit of unpaid fines
+	ErrRenewalLimit ErrorCode = "RENEWAL_LIMIT" // the loan has reached the limit of renewals
+	ErrInternal     ErrorCode = "INTERNAL"      // the request failed in the database, see the server log
+)
+
+// Status returns the HTTP status of a request failed with the code
+func (c ErrorCode) Status() int {
+	switch c {
+	case ErrInvalidArgument:
+		return http.StatusBadRequest
+	case ErrUnauthorized:
+		return http.StatusUnauthorized
+	case ErrForbidden:
+		return http.StatusForbidden
+	case ErrBookNotFound, ErrCardNotFound, ErrCopyNotFound, ErrBorrowNotFound, ErrHoldNotFound, ErrFineNotFound,
+		ErrAccountNotFound:
+		return http.StatusNotFound
+	case ErrDuplicateBook, ErrDuplicateISBN, ErrDuplicateCard, ErrDuplicateBarcode, ErrDuplicateAccount,
+		ErrBookOutOfStock, ErrBookInStock, ErrBookOnLoan, ErrBookReserved, ErrCopyUnavailable,
+		ErrAlreadyBorrowed, ErrAlreadyOnHold, ErrCardHasLoans, ErrCardHasFines, ErrLastAdmin,
+		ErrFineOfOtherCard:
+		return http.StatusConflict
+	case ErrInternal, "":
+		return http.StatusInternalServerError
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NormalizeISBN validates the checksum of an ISBN-10 or ISBN-13 and returns
+// it as ISBN-13 digits without hyphens or spaces.
+//
+//	NormalizeISBN("0-306-40615-2") == "9780306406157"
+func NormalizeISBN(isbn string) (string, error) {
+	digits := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(isbn))
+	switch len(digits) {
+	case 10:
+		sum := 0
+		for i, c := range digits {
+			d := int(c - '0')
+			if c == 'X' && i == 9 {
+				d = 10
+			} else if c < '0' || c > '9' {
+				return "", fmt.Errorf("invalid ISBN %q, unexpected character %q", isbn, c)
+			}
+			sum += (10 - i) * d
+		}
+		if sum%11 != 0 {
+			return "", fmt.Errorf("invalid ISBN %q, checksum mismatch", isbn)
+		}
+		isbn13 := "978" + digits[:9]
+		return isbn13 + isbn13CheckDigit(isbn13), nil
+	case 13:
+		for _, c := range digits {
+			if c < '0' || c > '9' {
+				return "", fmt.Errorf("invalid ISBN %q, unexpected character %q", isbn, c)
+			}
+		}
+		if !strings.HasPrefix(digits, "978") && !strings.HasPrefix(digits, "979") {
+			return "", fmt.Errorf("invalid ISBN %q, expect prefix 978 or 979", isbn)
+		}
+		if isbn13CheckDigit(digits[:12]) != digits[12:] {
+			return "", fmt.Errorf("invalid ISBN %q, checksum mismatch", isbn)
+		}
+		return digits, nil
+	default:
+		return "", fmt.Errorf("invalid ISBN %q, expect 10 or 13 digits", isbn)
+	}
+}
+
+// isbn13CheckDigit returns the check digit of the first 12 digits of an ISBN-13
+func isbn13CheckDigit(digits string) string {
+	sum := 0
+	for i, c := range digits {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(c-'0')
+	}
+	return fmt.Sprint((10 - sum%10) % 10)
+}
@@ -2,6 +2,9 @@ package database
 
 import (
 	"fmt"
+	"math"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -20,17 +23,68 @@ type Book struct {
 	Press       string  `json:"press" gorm:"size:63;not null;uniqueIndex:idx_book"`
 	PublishYear int     `json:"publish_year" gorm:"not null;uniqueIndex:idx_book"`
 	Author      string  `json:"author" gorm:"size:63;not null;uniqueIndex:idx_book"`
+	ISBN        string  `json:"isbn" gorm:"size:13;default:null;uniqueIndex:idx_isbn"` // normalized ISBN-13, optional
 	Price       float64 `json:"price" gorm:"not null;type:decimal(7,2);default:0.00"`
-	Stock       int     `json:"stock" gorm:"not null;default:0"`
+	Stock       int     `json:"stock" gorm:"not null;default:0"` // number of available copies
 	Borrow      Borrow  `gorm:"foreignKey:BookId;references:BookId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Hold        Hold    `json:"-" gorm:"foreignKey:BookId;references:BookId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Copy        Copy    `json:"-" gorm:"foreignKey:BookId;references:BookId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Credit      Credit  `json:"-" gorm:"foreignKey:BookId;references:BookId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+const (
+	CopyAvailable = "available"
+	CopyOnLoan    = "on_loan"
+	CopyOnHold    = "on_hold" // set aside for a ready hold
+	CopyLost      = "lost"
+	CopyInRepair  = "in_repair"
+	CopyWithdrawn = "withdrawn" // kept for the borrow histories
+)
+
+// Copy is a physical item of a book
+type Copy struct {
+	CopyId    int    `json:"copy_id" gorm:"primaryKey;autoIncrement"`
+	BookId    int    `json:"book_id" gorm:"not null;index"`
+	Barcode   string `json:"barcode" gorm:"size:31;not null;uniqueIndex"`
+	Location  string `json:"location" gorm:"size:63;not null;default:''"`
+	Condition string `json:"condition" gorm:"column:copy_condition;size:63;not null;default:''"`
+	Status    string `json:"status" gorm:"size:15;not null;default:available;index"`
+}
+
+// Contributor is a person credited on books, e.g. an author or a translator
+type Contributor struct {
+	ContributorId int    `json:"contributor_id" gorm:"primaryKey;autoIncrement"`
+	Name          string `json:"name" gorm:"size:63;not null;uniqueIndex"`
+	Credit        Credit `json:"-" gorm:"foreignKey:ContributorId;references:ContributorId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+const (
+	RoleAuthor      = "author"
+	RoleEditor      = "editor"
+	RoleTranslator  = "translator"
+	RoleIllustrator = "illustrator"
+)
+
+var Roles = []string{RoleAuthor, RoleEditor, RoleTranslator, RoleIllustrator}
+
+// Credit links a contributor to a book in a role.
+// Book.Author is kept as the display string of the authors.
+type Credit struct {
+	BookId        int    `json:"book_id" gorm:"primaryKey"`
+	ContributorId int    `json:"contributor_id" gorm:"primaryKey;index"`
+	Role          string `json:"role" gorm:"primaryKey;size:15;check:role in ('author', 'editor', 'translator', 'illustrator')"`
+	Position      int    `json:"position" gorm:"not null;default:0"` // order of the credits of a book
 }
 
 type Card struct {
-	CardId     int    `json:"card_id" gorm:"primaryKey;autoIncrement"`
-	Name       string `json:"name" gorm:"size:63;not null;uniqueIndex:idx_card"`
-	Department string `json:"department" gorm:"size:63;not null;uniqueIndex:idx_card"`
-	Type       string `json:"type" gorm:"type:char(1);not null;check:type in ('T', 'S');uniqueIndex:idx_card"`
-	Borrow     Borrow `gorm:"foreignKey:CardId;references:CardId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	CardId     int     `json:"card_id" gorm:"primaryKey;autoIncrement"`
+	Name       string  `json:"name" gorm:"size:63;not null;uniqueIndex:idx_card"`
+	Department string  `json:"department" gorm:"size:63;not null;uniqueIndex:idx_card"`
+	Type       string  `json:"type" gorm:"type:char(1);not null;check:type in ('T', 'S');uniqueIndex:idx_card"`
+	Borrow     Borrow  `gorm:"foreignKey:CardId;references:CardId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Hold       Hold    `json:"-" gorm:"foreignKey:CardId;references:CardId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Fine       Fine    `json:"-" gorm:"foreignKey:CardId;references:CardId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Account    Account `json:"-" gorm:"foreignKey:CardId;references:CardId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 }
 
 type Borrow struct {
@@ -38,13 +92,95 @@ type Borrow struct {
 	BookId     int   `json:"book_id" gorm:"primaryKey"`
 	BorrowTime int64 `json:"borrow_time" gorm:"primaryKey;not null"`
 	ReturnTime int64 `json:"return_time" gorm:"default:0"`
+	DueTime    int64 `json:"due_time" gorm:"not null;default:0"`
+	Renewals   int   `json:"renewals" gorm:"not null;default:0"`
+	CopyId     int   `json:"copy_id" gorm:"not null;default:0"`
+}
+
+const (
+	HoldWaiting   = "waiting"   // in the queue for the book
+	HoldReady     = "ready"     // a copy is set aside for the card until ExpireTime
+	HoldFulfilled = "fulfilled" // the card borrowed the copy set aside
+	HoldCancelled = "cancelled"
+	HoldExpired   = "expired" // the card did not pick up the copy in time
+)
+
+// Hold is a reservation of an out-of-stock book, served first in first out
+type Hold struct {
+	CardId     int    `json:"card_id" gorm:"primaryKey"`
+	BookId     int    `json:"book_id" gorm:"primaryKey;index:idx_hold_queue"`
+	HoldTime   int64  `json:"hold_time" gorm:"primaryKey;not null;index:idx_hold_queue"`
+	Status     string `json:"status" gorm:"size:15;not null;default:waiting"`
+	ReadyTime  int64  `json:"ready_time" gorm:"not null;default:0"`
+	ExpireTime int64  `json:"expire_time" gorm:"not null;default:0"`
+	CopyId     int    `json:"copy_id" gorm:"not null;default:0"` // the copy set aside for a ready hold
+}
+
+// Fine is charged for a borrow returned after its due time
+type Fine struct {
+	FineId     int     `json:"fine_id" gorm:"primaryKey;autoIncrement"`
+	CardId     int     `json:"card_id" gorm:"not null;index"`
+	BookId     int     `json:"book_id" gorm:"not null"`
+	BorrowTime int64   `json:"borrow_time" gorm:"not null"`
+	DaysLate   int     `json:"days_late" gorm:"not null"`
+	Amount     float64 `json:"amount" gorm:"not null;type:decimal(7,2)"`
+	Settled    float64 `json:"settled" gorm:"not null;type:decimal(7,2);default:0.00"` // paid or waived so far
+	CreateTime int64   `json:"create_time" gorm:"not null"`
+	Ledger     Ledger  `json:"-" gorm:"foreignKey:FineId;references:FineId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+const (
+	LedgerPayment = "payment"
+	LedgerWaiver  = "waiver"
+)
+
+// Ledger records a payment or a waiver of (a part of) a fine
+type Ledger struct {
+	LedgerId int     `json:"ledger_id" gorm:"primaryKey;autoIncrement"`
+	FineId   int     `json:"fine_id" gorm:"not null;index"`
+	CardId   int     `json:"card_id" gorm:"not null;index"`
+	Kind     string  `json:"kind" gorm:"size:15;not null;check:kind in ('payment', 'waiver')"`
+	Amount   float64 `json:"amount" gorm:"not null;type:decimal(7,2)"`
+	Time     int64   `json:"time" gorm:"not null"`
+	Note     string  `json:"note" gorm:"size:255;not null;default:''"`
+}
+
+const (
+	AccountAdmin     = "admin"     // manages the accounts, and everything a librarian does
+	AccountLibrarian = "librarian" // manages the books, the cards and the circulation
+	AccountPatron    = "patron"    // serves oneself with the card of the account
+)
+
+var AccountRoles = []string{AccountAdmin, AccountLibrarian, AccountPatron}
+
+// Account is a login of a staff member, or of a patron with the card
+type Account struct {
+	AccountId    int    `json:"account_id" gorm:"primaryKey;autoIncrement"`
+	Username     string `json:"username" gorm:"size:63;not null;uniqueIndex"`
+	Password     string `json:"password,omitempty" gorm:"-"` // only in requests, never stored
+	PasswordHash string `json:"-" gorm:"size:255;not null"`
+	Role         string `json:"role" gorm:"size:15;not null;check:role in ('admin', 'librarian', 'patron')"`
+	CardId       int    `json:"card_id" gorm:"default:null;index"` // the card of a patron, null for staff
+}
+
+// Outstanding returns the amount of the fine not paid or waived yet
+func (f *Fine) Outstanding() float64 {
+	return math.Round((f.Amount-f.Settled)*100) / 100
 }
 
 func (b *Borrow) ResetBorrowTime() {
 	b.BorrowTime = time.Now().UnixMilli()
 }
+
+// ResetReturnTime sets the return time to now, and after the borrow time
+// even if the book is returned within the same millisecond
 func (b *Borrow) ResetReturnTime() {
-	b.ReturnTime = time.Now().UnixMilli()
+	b.ReturnTime = max(time.Now().UnixMilli(), b.BorrowTime+1)
+}
+
+// IsOverdue reports whether the borrow is still open and past its due time at now
+func (b *Borrow) IsOverdue(now int64) bool {
+	return b.ReturnTime == 0 && b.DueTime > 0 && b.DueTime < now
 }
 func CreateBorrow(cardId, bookId int) Borrow {
 	return Borrow{
@@ -55,15 +191,75 @@ func CreateBorrow(cardId, bookId int) Borrow {
 	}
 }
 
+func CreateHold(cardId, bookId int) Hold {
+	return Hold{
+		CardId:   cardId,
+		BookId:   bookId,
+		HoldTime: time.Now().UnixMilli(),
+		Status:   HoldWaiting,
+	}
+}
+
+func (h *Hold) ResetHoldTime() {
+	h.HoldTime = time.Now().UnixMilli()
+}
+
+// SplitAuthors splits the display string of the authors of a book into names,
+// separated by commas, semicolons, ampersands or " and "
+func SplitAuthors(author string) []string {
+	names := make([]string, 0)
+	fields := strings.FieldsFunc(strings.ReplaceAll(author, " and ", ","), func(r rune) bool {
+		return r == ',' || r == ';' || r == '&'
+	})
+	for _, name := range fields {
+		if name = strings.TrimSpace(name); name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// CopyBarcode generates the barcode of the n-th copy of a book
+func CopyBarcode(bookId int, n int) string {
+	return fmt.Sprintf("B%06d-%04d", bookId, n)
+}
+
 func (b *Book) String() string {
-	return fmt.Sprintf("Book{BookId: %v, Category: %v, Title: %v, Press: %v, PublishYear: %v, Author: %v, Price: %v, Stock: %v}",
-		b.BookId, b.Category, b.Title, b.Press, b.PublishYear, b.Author, b.Price, b.Stock)
+	return fmt.Sprintf("Book{BookId: %v, Category: %v, Title: %v, Press: %v, PublishYear: %v, Author: %v, ISBN: %v, Price: %v, Stock: %v}",
+		b.BookId, b.Category, b.Title, b.Press, b.PublishYear, b.Author, b.ISBN, b.Price, b.Stock)
 }
 func (c *Card) String() string {
 	return fmt.Sprintf("Card{CardId: %v, Name: %v, Department: %v, Type: %v}",
 		c.CardId, c.Name, c.Department, c.Type)
 }
 func (b *Borrow) String() string {
-	return fmt.Sprintf("Borrow{CardId: %v, BookId: %v, BorrowTime: %v, ReturnTime: %v}",
-		b.CardId, b.BookId, b.BorrowTime, b.ReturnTime)
+	return fmt.Sprintf("Borrow{CardId: %v, BookId: %v, BorrowTime: %v, ReturnTime: %v, DueTime: %v, Renewals: %v, CopyId: %v}",
+		b.CardId, b.BookId, b.BorrowTime, b.ReturnTime, b.DueTime, b.Renewals, b.CopyId)
+}
+func (h *Hold) String() string {
+	return fmt.Sprintf("Hold{CardId: %v, BookId: %v, HoldTime: %v, Status: %v, ReadyTime: %v, ExpireTime: %v, CopyId: %v}",
+		h.CardId, h.BookId, h.HoldTime, h.Status, h.ReadyTime, h.ExpireTime, h.CopyId)
+}
+func (f *Fine) String() string {
+	return fmt.Sprintf("Fine{FineId: %v, CardId: %v, BookId: %v, BorrowTime: %v, DaysLate: %v, Amount: %v, Settled: %v, CreateTime: %v}",
+		f.FineId, f.CardId, f.BookId, f.BorrowTime, f.DaysLate, f.Amount, f.Settled, f.CreateTime)
+}
+func (l *Ledger) String() string {
+	return fmt.Sprintf("Ledger{LedgerId: %v, FineId: %v, CardId: %v, Kind: %v, Amount: %v, Time: %v, Note: %v}",
+		l.LedgerId, l.FineId, l.CardId, l.Kind, l.Amount, l.Time, l.Note)
+}
+func (c *Contributor) String() string {
+	return fmt.Sprintf("Contributor{ContributorId: %v, Name: %v}", c.ContributorId, c.Name)
+}
+func (c *Credit) String() string {
+	return fmt.Sprintf("Credit{BookId: %v, ContributorId: %v, Role: %v, Position: %v}",
+		c.BookId, c.ContributorId, c.Role, c.Position)
+}
+func (a *Account) String() string {
+	return fmt.Sprintf("Account{AccountId: %v, Username: %v, Role: %v, CardId: %v}",
+		a.AccountId, a.Username, a.Role, a.CardId)
+}
+func (c *Copy) String() string {
+	return fmt.Sprintf("Copy{CopyId: %v, BookId: %v, Barcode: %v, Location: %v, Condition: %v, Status: %v}",
+		c.CopyId, c.BookId, c.Barcode, c.Location, c.Condition, c.Status)
 }
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// SearchIndex is the kind of the full-text index of the catalogue
+type SearchIndex string
+
+const (
+	SearchNone     SearchIndex = ""         // no index, books are searched with like
+	SearchFullText SearchIndex = "fulltext" // the FULLTEXT index of mysql
+	SearchFTS5     SearchIndex = "fts5"     // the FTS5 table of sqlite, kept in sync by triggers
+)
+
+// Search is the full-text index found or created when connecting to the database
+var Search = SearchNone
+
+// the columns of books in the full-text index
+const searchColumns = "title, author, category, press"
+
+// initSearchIndex creates the full-text index of books if the database supports it,
+// or falls back to searching with like
+func initSearchIndex() {
+	var err error
+	switch DB.Dialector.Name() {
+	case DriverMySQL:
+		if !DB.Migrator().HasIndex(&Book{}, "idx_book_search") {
+			logrus.Debug("creating full-text index idx_book_search on table book")
+			err = DB.Exec("alter table books add fulltext index idx_book_search (" + searchColumns + ")").Error
+		}
+		Search = SearchFullText
+	case DriverSQLite:
+		if !DB.Migrator().HasTable("book_search") {
+			logrus.Debug("creating full-text table book_search")
+			err = createFTS5()
+		}
+		Search = SearchFTS5
+	}
+	if err != nil {
+		logrus.WithError(err).Warn("failed to create full-text index, books will be searched with like")
+		Search = SearchNone
+	}
+}
+
+// createFTS5 creates the FTS5 table indexing the books, and the triggers updating it
+func createFTS5() error {
+	statements := []string{
+		"create virtual table book_search using fts5(" + searchColumns + ", content='books', content_rowid='book_id')",
+		`create trigger book_search_insert after insert on books begin
+			insert into book_search(rowid, ` + searchColumns + `) values (new.book_id, new.title, new.author, new.category, new.press);
+		end`,
+		`create trigger book_search_delete after delete on books begin
+			insert into book_search(book_search, rowid, ` + searchColumns + `) values ('delete', old.book_id, old.title, old.author, old.category, old.press);
+		end`,
+		`create trigger book_search_update after update of ` + searchColumns + ` on books begin
+			insert into book_search(book_search, rowid, ` + searchColumns + `) values ('delete', old.book_id, old.title, old.author, old.category, old.press);
+			insert into book_search(rowid, ` + searchColumns + `) values (new.book_id, new.title, new.author, new.category, new.press);
+		end`,
+		// Index the books stored before the table was created
+		"insert into book_search(book_search) values ('rebuild')",
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// dropSearchIndex drops the full-text table of sqlite, whose triggers are dropped along with books
+func dropSearchIndex() {
+	if DB.Dialector.Name() == DriverSQLite {
+		DB.Exec("drop table if exists book_search")
+	}
+}
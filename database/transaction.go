@@ -0,0 +1,52 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"math/rand"
+	"time"
+
+	sqlitedriver "github.com/glebarez/go-sqlite"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// TransactionAttempts is how many times a transaction is run before
+// giving up on deadlocks and serialization failures
+const TransactionAttempts = 8
+
+// Transaction runs fc in a transaction like DB.Transaction, and runs it again
+// if the database aborts it to resolve a conflict with a concurrent transaction.
+//
+// fc may run more than once, so it should not depend on the variables it
+// modified in an aborted attempt.
+func Transaction(fc func(tx *gorm.DB) error, opts ...*sql.TxOptions) error {
+	for attempt := 1; ; attempt++ {
+		err := DB.Transaction(fc, opts...)
+		if err == nil || attempt == TransactionAttempts || !Retryable(err) {
+			return err
+		}
+		logrus.WithError(err).Debugf("retrying transaction, attempt %d", attempt)
+		// Back off exponentially with jitter, so that the conflicting transactions do not meet again
+		backoff := time.Duration(1<<attempt) * time.Millisecond
+		time.Sleep(backoff + time.Duration(rand.Int63n(int64(backoff))))
+	}
+}
+
+// Retryable tells whether the database aborted the transaction for a deadlock,
+// a serialization failure or a lock held by a concurrent transaction
+func Retryable(err error) bool {
+	var mysqlErr *mysqldriver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		// ER_LOCK_DEADLOCK, ER_LOCK_WAIT_TIMEOUT, or any serialization failure
+		return mysqlErr.Number == 1213 || mysqlErr.Number == 1205 || string(mysqlErr.SQLState[:]) == "40001"
+	}
+	var sqliteErr *sqlitedriver.Error
+	if errors.As(err, &sqliteErr) {
+		// SQLITE_BUSY and SQLITE_LOCKED, including their extended codes
+		code := sqliteErr.Code() & 0xff
+		return code == 5 || code == 6
+	}
+	return false
+}
@@ -3,18 +3,25 @@ package database
 import (
 	"fmt"
 
+	"github.com/glebarez/sqlite"
 	"github.com/sirupsen/logrus"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+)
+
 type Config struct {
+	Driver   string `yaml:"driver"` // mysql (default) or sqlite
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 	Host     string `yaml:"host"`
 	Port     string `yaml:"port"`
-	Database string `yaml:"database"`
+	Database string `yaml:"database"` // database name, or file path for sqlite
 	LogLevel string `yaml:"log_level"`
 }
 
@@ -22,6 +29,7 @@ type APIResult struct {
 	Ok      bool        `json:"ok"`
 	Message string      `json:"message"`
 	Payload interface{} `json:"payload"`
+	Code    ErrorCode   `json:"code,omitempty"` // why the request failed, empty if ok
 }
 
 var DB *gorm.DB
@@ -31,8 +39,10 @@ func ResetDatabase() {
 		logrus.Panic("resting database before connecting to it")
 	}
 	logrus.Debug("resetting database")
-	DB.Migrator().DropTable(&Book{}, &Card{}, &Borrow{})
-	DB.AutoMigrate(&Book{}, &Card{}, &Borrow{})
+	dropSearchIndex()
+	DB.Migrator().DropTable(&Book{}, &Card{}, &Borrow{}, &Hold{}, &Fine{}, &Ledger{}, &Copy{}, &Contributor{}, &Credit{}, &Account{})
+	DB.AutoMigrate(&Book{}, &Card{}, &Borrow{}, &Hold{}, &Fine{}, &Ledger{}, &Copy{}, &Contributor{}, &Credit{}, &Account{})
+	initSearchIndex()
 }
 
 func initDatabase() {
@@ -42,6 +52,8 @@ func initDatabase() {
 	logrus.Debug("initing database")
 	if DB.Migrator().HasTable(&Book{}) {
 		logrus.Debug("table book exists")
+		addMissingColumns("book", &Book{}, "ISBN")
+		addMissingIndexes("book", &Book{}, "idx_isbn")
 	} else {
 		logrus.Debug("table book not exists")
 		DB.AutoMigrate(&Book{})
@@ -54,15 +66,201 @@ func initDatabase() {
 	}
 	if DB.Migrator().HasTable(&Borrow{}) {
 		logrus.Debug("table borrow exists")
+		addMissingColumns("borrow", &Borrow{}, "DueTime", "Renewals", "CopyId")
 	} else {
 		logrus.Debug("table borrow not exists")
 		DB.AutoMigrate(&Borrow{})
 	}
+	if DB.Migrator().HasTable(&Hold{}) {
+		logrus.Debug("table hold exists")
+		addMissingColumns("hold", &Hold{}, "CopyId")
+	} else {
+		logrus.Debug("table hold not exists")
+		DB.AutoMigrate(&Hold{})
+	}
+	if DB.Migrator().HasTable(&Copy{}) {
+		logrus.Debug("table copy exists")
+	} else {
+		logrus.Debug("table copy not exists")
+		DB.AutoMigrate(&Copy{})
+		migrateCopies()
+	}
+	if DB.Migrator().HasTable(&Contributor{}) && DB.Migrator().HasTable(&Credit{}) {
+		logrus.Debug("table contributor exists")
+	} else {
+		logrus.Debug("table contributor not exists")
+		DB.AutoMigrate(&Contributor{}, &Credit{})
+		migrateContributors()
+	}
+	if DB.Migrator().HasTable(&Fine{}) {
+		logrus.Debug("table fine exists")
+	} else {
+		logrus.Debug("table fine not exists")
+		DB.AutoMigrate(&Fine{})
+	}
+	if DB.Migrator().HasTable(&Ledger{}) {
+		logrus.Debug("table ledger exists")
+	} else {
+		logrus.Debug("table ledger not exists")
+		DB.AutoMigrate(&Ledger{})
+	}
+	if DB.Migrator().HasTable(&Account{}) {
+		logrus.Debug("table account exists")
+	} else {
+		logrus.Debug("table account not exists")
+		DB.AutoMigrate(&Account{})
+	}
+	initSearchIndex()
+}
+
+// migrateCopies creates the copies of books stored before copies were tracked:
+// one for each unit in stock, each open borrow and each ready hold
+func migrateCopies() {
+	books := make([]Book, 0)
+	if err := DB.Find(&books).Error; err != nil {
+		logrus.WithError(err).Panic("failed to migrate copies")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for _, book := range books {
+			n := 0
+			newCopy := func(status string) (Copy, error) {
+				n++
+				item := Copy{BookId: book.BookId, Barcode: CopyBarcode(book.BookId, n), Status: status}
+				return item, tx.Create(&item).Error
+			}
+			for i := 0; i < book.Stock; i++ {
+				if _, err := newCopy(CopyAvailable); err != nil {
+					return err
+				}
+			}
+			borrows := make([]Borrow, 0)
+			if err := tx.Where("book_id = ? and return_time = 0", book.BookId).Find(&borrows).Error; err != nil {
+				return err
+			}
+			for _, borrow := range borrows {
+				item, err := newCopy(CopyOnLoan)
+				if err != nil {
+					return err
+				}
+				if err := tx.Model(&Borrow{}).
+					Where("card_id = ? and book_id = ? and borrow_time = ?", borrow.CardId, borrow.BookId, borrow.BorrowTime).
+					Update("copy_id", item.CopyId).Error; err != nil {
+					return err
+				}
+			}
+			holds := make([]Hold, 0)
+			if err := tx.Where("book_id = ? and status = ?", book.BookId, HoldReady).Find(&holds).Error; err != nil {
+				return err
+			}
+			for _, hold := range holds {
+				item, err := newCopy(CopyOnHold)
+				if err != nil {
+					return err
+				}
+				if err := tx.Model(&Hold{}).
+					Where("card_id = ? and book_id = ? and hold_time = ?", hold.CardId, hold.BookId, hold.HoldTime).
+					Update("copy_id", item.CopyId).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.WithError(err).Panic("failed to migrate copies")
+	}
+	logrus.Info("created copies of ", len(books), " books")
+}
+
+// migrateContributors credits the authors of books stored before contributors were tracked,
+// by splitting their display string of the authors
+func migrateContributors() {
+	books := make([]Book, 0)
+	if err := DB.Find(&books).Error; err != nil {
+		logrus.WithError(err).Panic("failed to migrate contributors")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for _, book := range books {
+			if err := CreditAuthors(tx, book.BookId, book.Author); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.WithError(err).Panic("failed to migrate contributors")
+	}
+	logrus.Info("credited authors of ", len(books), " books")
+}
+
+// CreditAuthors replaces the author credits of a book with the names in its display string of the authors
+func CreditAuthors(tx *gorm.DB, bookId int, author string) error {
+	if err := tx.Where("book_id = ? and role = ?", bookId, RoleAuthor).Delete(&Credit{}).Error; err != nil {
+		return err
+	}
+	for i, name := range SplitAuthors(author) {
+		contributorId, err := ContributorId(tx, name)
+		if err != nil {
+			return err
+		}
+		credit := Credit{BookId: bookId, ContributorId: contributorId, Role: RoleAuthor, Position: i}
+		if err := tx.Create(&credit).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ContributorId returns the id of the contributor with the name, who is created if not exists
+func ContributorId(tx *gorm.DB, name string) (int, error) {
+	contributor := Contributor{}
+	err := tx.Where(Contributor{Name: name}).FirstOrCreate(&contributor).Error
+	return contributor.ContributorId, err
+}
+
+// addMissingColumns adds the columns introduced after the table was created
+func addMissingColumns(table string, model interface{}, fields ...string) {
+	for _, field := range fields {
+		if !DB.Migrator().HasColumn(model, field) {
+			logrus.Info("adding column ", field, " to table ", table)
+			if err := DB.Migrator().AddColumn(model, field); err != nil {
+				logrus.WithError(err).Panic("failed to add column ", field)
+			}
+		}
+	}
+}
+
+// addMissingIndexes creates the indexes introduced after the table was created
+func addMissingIndexes(table string, model interface{}, names ...string) {
+	for _, name := range names {
+		if !DB.Migrator().HasIndex(model, name) {
+			logrus.Info("creating index ", name, " on table ", table)
+			if err := DB.Migrator().CreateIndex(model, name); err != nil {
+				logrus.WithError(err).Panic("failed to create index ", name)
+			}
+		}
+	}
+}
+
+// dialector opens the database of the driver in config
+func dialector(config Config) gorm.Dialector {
+	switch config.Driver {
+	case DriverSQLite:
+		// wait for the lock instead of failing at once under concurrent writes,
+		// and enforce foreign keys, which sqlite ignores by default
+		dsn := fmt.Sprint("file:", config.Database, "?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)")
+		return sqlite.Open(dsn)
+	case DriverMySQL, "":
+		dsn := fmt.Sprint(config.User, ":", config.Password, "@tcp(", config.Host, ":", config.Port, ")/", config.Database, "?charset=utf8mb4&parseTime=True&loc=Local")
+		return mysql.Open(dsn)
+	default:
+		logrus.Panic("unknown database driver ", config.Driver)
+		return nil
+	}
 }
 
 func ConnectDatabase(config Config) {
 	logrus.Info("connecting to database")
-	dsn := fmt.Sprint(config.User, ":", config.Password, "@tcp(", config.Host, ":", config.Port, ")/", config.Database, "?charset=utf8mb4&parseTime=True&loc=Local")
 	var err error
 
 	logLevel := logger.Default.LogMode(logger.Info)
@@ -77,8 +275,9 @@ func ConnectDatabase(config Config) {
 	default:
 		logLevel = logger.Default.LogMode(logger.Info)
 	}
-	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
-		Logger: logLevel,
+	DB, err = gorm.Open(dialector(config), &gorm.Config{
+		Logger:         logLevel,
+		TranslateError: true, // to tell duplicate keys from other failures
 	})
 	if err != nil {
 		logrus.WithError(err).Panic("failed to connect database")
@@ -13,6 +13,23 @@ for (const [key, component] of Object.entries(ElementPlusIconsVue)) {
     app.component(key, component)
 }
 axios.defaults.baseURL = import.meta.env.VITE_APP_API_BASE_URL;
+// 携带登录令牌，令牌无效时跳转到登录页
+axios.interceptors.request.use(config => {
+    const token = localStorage.getItem('token')
+    if (token) {
+        config.headers.Authorization = 'Bearer ' + token
+    }
+    return config
+})
+axios.interceptors.response.use(response => response, error => {
+    if (error.response?.status === 401) {
+        localStorage.removeItem('token')
+        if (router.currentRoute.value.path !== '/login') {
+            router.push({ path: '/login', query: { redirect: router.currentRoute.value.fullPath } })
+        }
+    }
+    return Promise.reject(error)
+})
 app.use(createPinia())
 app.use(router)
 app.use(ElementPlus)
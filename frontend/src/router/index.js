@@ -2,6 +2,7 @@ import { createRouter, createWebHistory } from 'vue-router'
 import BookVue from '@/components/Book.vue'
 import CardVue from '@/components/Card.vue'
 import BorrowVue from '@/components/Borrow.vue'
+import LoginVue from '@/components/Login.vue'
 
 const router = createRouter({
   history: createWebHistory(import.meta.env.BASE_URL),
@@ -21,6 +22,10 @@ const router = createRouter({
     {
       path: '/borrow',
       component: BorrowVue
+    },
+    {
+      path: '/login',
+      component: LoginVue
     }
   ]
 })
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"library-management-system/database"
 	"library-management-system/server"
+	"library-management-system/server/auth"
+	"library-management-system/server/marc"
+	"library-management-system/server/policy"
 	"os"
 
 	"github.com/sirupsen/logrus"
@@ -16,6 +19,9 @@ var DB *gorm.DB
 type AppConfig struct {
 	Server   server.Config   `yaml:"server"`
 	Database database.Config `yaml:"database"`
+	Policy   policy.Config   `yaml:"policy"`
+	Auth     auth.Config     `yaml:"auth"`
+	MARC     marc.Config     `yaml:"marc"`
 }
 
 func main() {
@@ -38,5 +44,11 @@ func main() {
 	}
 
 	database.ConnectDatabase(config.Database)
+	server.InitMARC(config.MARC)
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+	server.InitPolicy(config.Policy)
+	server.InitAuth(config.Auth)
 	server.InitServer(config.Server)
 }
@@ -0,0 +1,866 @@
+// Package memory implements utils.ServerInterface without a database,
+// following the same rules as server.Server. It is meant for fast tests
+// and demos.
+//
+// Holds, fines and the other features outside utils.ServerInterface
+// are not modeled: no fine is charged for a late return, and the
+// unpaid fines limit of the policy never applies.
+package memory
+
+import (
+	"cmp"
+	"fmt"
+	"library-management-system/database"
+	"library-management-system/server/policy"
+	"library-management-system/server/queries"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Server struct {
+	mutex   sync.Mutex
+	policy  policy.Policy
+	books   map[int]*database.Book
+	cards   map[int]*database.Card
+	copies  map[int]*database.Copy
+	borrows []*database.Borrow
+
+	nextBookId int
+	nextCardId int
+	nextCopyId int
+}
+
+// New returns an empty library lending by the policy
+func New(policy policy.Policy) *Server {
+	s := &Server{policy: policy}
+	s.Reset()
+	return s
+}
+
+// Reset removes all books, cards and borrows, and restarts the ids from 1
+func (s *Server) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.books = make(map[int]*database.Book)
+	s.cards = make(map[int]*database.Card)
+	s.copies = make(map[int]*database.Copy)
+	s.borrows = make([]*database.Borrow, 0)
+	s.nextBookId, s.nextCardId, s.nextCopyId = 1, 1, 1
+}
+
+/* Interface for books */
+
+// StoreBook
+// register a book, and its copies in stock.
+//
+// @param book all attributes of the book
+func (s *Server) StoreBook(book *database.Book) database.APIResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := normalizeISBN(book); err != nil {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to store book, " + err.Error(),
+			Payload: nil,
+			Code:    database.ErrInvalidISBN,
+		}
+	}
+	code := s.conflict(book, nil)
+	if code == "" && book.BookId != 0 && s.books[book.BookId] != nil {
+		code = database.ErrDuplicateBook
+	}
+	if code != "" {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to store book, maybe the book or its ISBN already exists",
+			Payload: nil,
+			Code:    code,
+		}
+	}
+	s.insertBook(book)
+	return database.APIResult{
+		Ok:      true,
+		Message: "Book stored successfully",
+		Payload: book,
+	}
+}
+
+// IncBookStock
+// increase the book's inventory by bookId & deltaStock.
+// copies are added, or the latest available copies are withdrawn.
+//
+// @param bookId book's BookID
+// @param deltaStock increase count to book's stock, must be greater
+func (s *Server) IncBookStock(bookId int, deltaStock int) database.APIResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	book, ok := s.books[bookId]
+	if !ok {
+		return database.APIResult{
+			Ok:      false,
+			Message: "This book does not exist",
+			Payload: nil,
+			Code:    database.ErrBookNotFound,
+		}
+	}
+	if book.Stock+deltaStock < 0 {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Stock deltaStock becomes invalid after incrementing, please check the arguments",
+			Payload: nil,
+			Code:    database.ErrInvalidStock,
+		}
+	}
+
+	if deltaStock > 0 {
+		s.addCopies(bookId, deltaStock)
+	}
+	copies := s.copiesOf(bookId)
+	for i := len(copies) - 1; i >= 0 && deltaStock < 0; i-- {
+		if copies[i].Status == database.CopyAvailable {
+			copies[i].Status = database.CopyWithdrawn
+			deltaStock++
+		}
+	}
+	s.syncStock(bookId)
+	return database.APIResult{
+		Ok:      true,
+		Message: "Book stock incremented successfully",
+		Payload: nil,
+	}
+}
+
+// StoreBooks
+// batch store books. if one of the books fails to store,
+// none of them is stored. the stored books with their BookIDs
+// are returned by database.APIResult.payload as {@link queries.BookList}.
+//
+// @param books list of books to be stored
+func (s *Server) StoreBooks(books []*database.Book) database.APIResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Check the books against the library and each other
+	isbns := make(map[string]bool)
+	for i, book := range books {
+		if err := normalizeISBN(book); err != nil {
+			return database.APIResult{
+				Ok:      false,
+				Message: "Failed to store books, " + err.Error(),
+				Payload: nil,
+				Code:    database.ErrInvalidISBN,
+			}
+		}
+		if book.ISBN != "" && isbns[book.ISBN] {
+			return database.APIResult{
+				Ok:      false,
+				Message: "Failed to store books, duplicate ISBN " + book.ISBN + " in the batch",
+				Payload: nil,
+				Code:    database.ErrDuplicateISBN,
+			}
+		}
+		isbns[book.ISBN] = true
+		code := s.conflict(book, nil)
+		if code == "" && slices.ContainsFunc(books[:i], func(other *database.Book) bool {
+			return sameBook(book, other)
+		}) {
+			code = database.ErrDuplicateBook
+		}
+		if code != "" {
+			for _, book := range books {
+				book.BookId = 0
+			}
+			return database.APIResult{
+				Ok:      false,
+				Message: "Failed to store books, maybe one of them or its ISBN already exists",
+				Payload: nil,
+				Code:    code,
+			}
+		}
+	}
+
+	for _, book := range books {
+		book.BookId = 0
+		s.insertBook(book)
+	}
+	stored := queries.BookList{
+		Count: len(books),
+		Books: make([]database.Book, 0, len(books)),
+	}
+	for _, book := range books {
+		stored.Books = append(stored.Books, *book)
+	}
+	return database.APIResult{
+		Ok:      true,
+		Message: "Books stored successfully",
+		Payload: stored,
+	}
+}
+
+// RemoveBook
+// remove a book, its copies and its borrow histories.
+// the book is not removed if someone has not returned it.
+//
+// @param bookId the book to be removed
+func (s *Server) RemoveBook(bookId int) database.APIResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if slices.ContainsFunc(s.borrows, func(borrow *database.Borrow) bool {
+		return borrow.BookId == bookId && borrow.ReturnTime == 0
+	}) {
+		return database.APIResult{
+			Ok:      false,
+			Message: "This book has some un-returned copies",
+			Payload: nil,
+			Code:    database.ErrBookOnLoan,
+		}
+	}
+	if _, ok := s.books[bookId]; !ok {
+		return database.APIResult{
+			Ok:      false,
+			Message: "This book does not exist, maybe it was already removed",
+			Payload: nil,
+			Code:    database.ErrBookNotFound,
+		}
+	}
+
+	delete(s.books, bookId)
+	for copyId, item := range s.copies {
+		if item.BookId == bookId {
+			delete(s.copies, copyId)
+		}
+	}
+	s.borrows = slices.DeleteFunc(s.borrows, func(borrow *database.Borrow) bool {
+		return borrow.BookId == bookId
+	})
+	return database.APIResult{
+		Ok:      true,
+		Message: "Book removed successfully",
+		Payload: nil,
+	}
+}
+
+// ModifyBookInfo
+// modify a book's information by BookID. empty attributes, the
+// BookID and the stock are not modified.
+//
+// @param book the book to be modified
+func (s *Server) ModifyBookInfo(book *database.Book) database.APIResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	orig, ok := s.books[book.BookId]
+	if !ok {
+		return database.APIResult{
+			Ok:      false,
+			Message: "That book that does not exist, you cannot modify book_id",
+			Payload: nil,
+			Code:    database.ErrBookNotFound,
+		}
+	}
+	if err := normalizeISBN(book); err != nil {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to modify book info, " + err.Error(),
+			Payload: nil,
+			Code:    database.ErrInvalidISBN,
+		}
+	}
+
+	modified := *orig
+	modified.Category = cmp.Or(book.Category, orig.Category)
+	modified.Title = cmp.Or(book.Title, orig.Title)
+	modified.Press = cmp.Or(book.Press, orig.Press)
+	modified.PublishYear = cmp.Or(book.PublishYear, orig.PublishYear)
+	modified.Author = cmp.Or(book.Author, orig.Author)
+	modified.ISBN = cmp.Or(book.ISBN, orig.ISBN)
+	modified.Price = cmp.Or(roundPrice(book.Price), orig.Price)
+	if code := s.conflict(&modified, orig); code != "" {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to modify book info",
+			Payload: nil,
+			Code:    code,
+		}
+	}
+	*orig = modified
+	return database.APIResult{
+		Ok:      true,
+		Message: "Book info modified successfully",
+		Payload: book,
+	}
+}
+
+// QueryBooks
+// query books by the conditions, sorted by the column and then
+// by BookID in ascending order.
+//
+// @param conditions query conditions
+//
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.BookQueryResults}
+func (s *Server) QueryBooks(conditions queries.BookQueryConditions) database.APIResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	isbn := ""
+	if conditions.ISBN != "" {
+		var err error
+		if isbn, err = database.NormalizeISBN(conditions.ISBN); err != nil {
+			return database.APIResult{
+				Ok:      false,
+				Message: "Failed to query books, " + err.Error(),
+				Payload: nil,
+				Code:    database.ErrInvalidISBN,
+			}
+		}
+	}
+	compare := queries.GetComparator(cmp.Or(conditions.SortBy, queries.BookId))
+	if compare == nil || (conditions.SortOrder != "" && !slices.Contains(queries.SortOrders, conditions.SortOrder)) {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to query books, invalid sort_by or sort_order",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		}
+	}
+	match := like
+	switch conditions.Match {
+	case "", queries.Fuzzy:
+	case queries.Exact:
+		match = func(s string, value string) bool {
+			return value == "" || s == value
+		}
+	default:
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to query books, invalid match",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		}
+	}
+	cursor, err := conditions.PageCursor()
+	if err != nil {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to query books, " + err.Error(),
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		}
+	}
+
+	terms := queries.SearchTerms(conditions.Q)
+	relevance := make(map[*database.Book]float64)
+	matches := make([]*database.Book, 0)
+	for _, book := range s.books {
+		if len(terms) > 0 {
+			if relevance[book] = queries.Relevance(book, terms); relevance[book] == 0 {
+				continue
+			}
+		}
+		// The contributors of a book are credited from its authors, as database.CreditAuthors does,
+		// all in the author role. The author filters match them as the server matches the credits.
+		contributors := database.SplitAuthors(book.Author)
+		if match(book.Category, conditions.Category) &&
+			match(book.Title, conditions.Title) &&
+			match(book.Press, conditions.Press) &&
+			(conditions.Author == "" || match(book.Author, conditions.Author) ||
+				slices.ContainsFunc(contributors, func(name string) bool {
+					return match(name, conditions.Author)
+				})) &&
+			(len(conditions.Categories) == 0 || slices.Contains(conditions.Categories, book.Category)) &&
+			(len(conditions.Presses) == 0 || slices.Contains(conditions.Presses, book.Press)) &&
+			(len(conditions.Authors) == 0 || containsAny(contributors, conditions.Authors)) &&
+			!slices.Contains(conditions.ExcludeCategories, book.Category) &&
+			!slices.Contains(conditions.ExcludePresses, book.Press) &&
+			!containsAny(contributors, conditions.ExcludeAuthors) &&
+			(!conditions.InStock || book.Stock > 0) &&
+			(conditions.Contributor == "" ||
+				(cmp.Or(conditions.Role, database.RoleAuthor) == database.RoleAuthor &&
+					slices.Contains(contributors, conditions.Contributor))) &&
+			(isbn == "" || book.ISBN == isbn) &&
+			(conditions.MinPublishYear == 0 || book.PublishYear >= conditions.MinPublishYear) &&
+			(conditions.MaxPublishYear == 0 || book.PublishYear <= conditions.MaxPublishYear) &&
+			(conditions.MinPrice == 0 || book.Price >= conditions.MinPrice) &&
+			(conditions.MaxPrice == 0 || book.Price <= conditions.MaxPrice) {
+			matches = append(matches, book)
+		}
+	}
+	comparator := queries.BookComparator(compare)
+	if conditions.SortOrder == queries.Desc {
+		comparator = comparator.Reverse()
+	}
+	comparator = comparator.ThenByIdAsc()
+	if conditions.Ranked() { // the most relevant first
+		comparator = func(a, b *database.Book) int {
+			return cmp.Or(cmp.Compare(relevance[b], relevance[a]), queries.BookIdCmp(a, b))
+		}
+	}
+	slices.SortFunc(matches, comparator)
+
+	// Take the page after the cursor or the offset
+	books := queries.BookQueryResults{
+		Total:   len(matches),
+		Results: make([]database.Book, 0),
+	}
+	if conditions.Facets {
+		books.Facets = bookFacets(matches)
+	}
+	start := min(conditions.Offset, len(matches))
+	if cursor != nil {
+		after := cursor.Book()
+		start, _ = slices.BinarySearchFunc(matches, &after, func(book *database.Book, after *database.Book) int {
+			return cmp.Or(comparator(book, after), -1) // the books equal to the cursor come before it
+		})
+	}
+	end := len(matches)
+	if conditions.Limit > 0 && start+conditions.Limit < end {
+		end = start + conditions.Limit
+		if !conditions.Ranked() {
+			books.NextCursor = queries.NewCursor(matches[end-1], conditions.SortBy, conditions.SortOrder)
+		}
+	}
+	for _, book := range matches[start:end] {
+		books.Results = append(books.Results, *book)
+	}
+	books.Count = len(books.Results)
+	if len(terms) > 0 {
+		books.Highlights = make(map[int]queries.Highlight, len(books.Results))
+		for i := range books.Results {
+			books.Highlights[books.Results[i].BookId] = queries.Highlights(&books.Results[i], terms)
+		}
+	}
+	return database.APIResult{
+		Ok:      true,
+		Message: "Books queried successfully",
+		Payload: books,
+	}
+}
+
+/* Interface for borrow & return books */
+
+// BorrowBook
+// a user borrows one book with the specific card, by the same
+// rules as server.Server except for the unpaid fines.
+//
+// @param borrow information, include borrower &
+// book's id & time, and optionally the copy's id
+func (s *Server) BorrowBook(borrow database.Borrow) database.APIResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	borrow.ReturnTime = 0
+	reject := func(code database.ErrorCode, reason string) database.APIResult {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to borrow book, " + reason,
+			Payload: nil,
+			Code:    code,
+		}
+	}
+	card, ok := s.cards[borrow.CardId]
+	if !ok {
+		return reject(database.ErrCardNotFound, "card does not exist")
+	}
+	book, ok := s.books[borrow.BookId]
+	if !ok {
+		return reject(database.ErrBookNotFound, "book does not exist")
+	}
+	if book.Stock <= 0 {
+		return reject(database.ErrBookOutOfStock, "book out of stock")
+	}
+
+	loans, categoryLoans := 0, 0
+	for _, other := range s.borrows {
+		if other.CardId != borrow.CardId {
+			continue
+		}
+		if other.BookId == borrow.BookId && other.ReturnTime == 0 {
+			return reject(database.ErrAlreadyBorrowed, "user has not returned the book")
+		}
+		if other.BookId == borrow.BookId && other.BorrowTime == borrow.BorrowTime {
+			return reject(database.ErrAlreadyBorrowed, "user has borrowed the book at the same time")
+		}
+		if other.ReturnTime == 0 {
+			loans++
+			if s.books[other.BookId].Category == book.Category {
+				categoryLoans++
+			}
+		}
+	}
+	limits := s.policy.Resolve(card.Type, book.Category)
+	if limits.MaxLoans > 0 && loans >= limits.MaxLoans {
+		return reject(database.ErrLoanLimit, fmt.Sprintf("card has reached the limit of %d concurrent loans", limits.MaxLoans))
+	}
+	if limits.MaxCategoryLoans > 0 && categoryLoans >= limits.MaxCategoryLoans {
+		return reject(database.ErrLoanLimit, fmt.Sprintf("card has reached the limit of %d concurrent loans in category %s",
+			limits.MaxCategoryLoans, book.Category))
+	}
+	borrow.DueTime = borrow.BorrowTime + limits.LoanPeriod().Milliseconds()
+
+	// Choose the copy scanned at the desk, or any available one
+	i := slices.IndexFunc(s.copiesOf(book.BookId), func(item *database.Copy) bool {
+		return item.Status == database.CopyAvailable && (borrow.CopyId == 0 || item.CopyId == borrow.CopyId)
+	})
+	if i < 0 {
+		return reject(database.ErrCopyUnavailable, "copy is not available")
+	}
+	item := s.copiesOf(book.BookId)[i]
+	item.Status = database.CopyOnLoan
+	borrow.CopyId = item.CopyId
+	s.borrows = append(s.borrows, &borrow)
+	s.syncStock(book.BookId)
+	return database.APIResult{
+		Ok:      true,
+		Message: "Book borrowed successfully",
+		Payload: nil,
+	}
+}
+
+// ReturnBook
+// a user returns one book with the specific card.
+//
+// @param borrow
+// borrow information, include borrower & book's id & return time
+func (s *Server) ReturnBook(borrow database.Borrow) database.APIResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if borrow.ReturnTime <= borrow.BorrowTime {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Return time should be later than borrow time",
+			Payload: nil,
+			Code:    database.ErrInvalidTime,
+		}
+	}
+	i := slices.IndexFunc(s.borrows, func(open *database.Borrow) bool {
+		return open.CardId == borrow.CardId && open.BookId == borrow.BookId && open.ReturnTime == 0
+	})
+	if i < 0 {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to return book, no borrow record found, maybe the user have returned the book or the book is not borrowed",
+			Payload: nil,
+			Code:    database.ErrBorrowNotFound,
+		}
+	}
+	open := s.borrows[i]
+	open.ReturnTime = borrow.ReturnTime
+	if item, ok := s.copies[open.CopyId]; ok {
+		item.Status = database.CopyAvailable
+	}
+	s.syncStock(open.BookId)
+	return database.APIResult{
+		Ok:      true,
+		Message: "Book returned successfully",
+		Payload: nil,
+	}
+}
+
+// ShowBorrowHistories
+// list all borrow histories of a card, order by borrow time
+// in descending order and then by BookID in ascending order.
+//
+// @param cardId show which card's borrow history
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.BorrowHistories}
+func (s *Server) ShowBorrowHistories(cardId int) database.APIResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	history := queries.BorrowHistories{
+		Items: make([]queries.BorrowItem, 0),
+	}
+	card, now := s.cards[cardId], time.Now().UnixMilli()
+	for _, borrow := range s.borrows {
+		book, ok := s.books[borrow.BookId]
+		if borrow.CardId != cardId || !ok {
+			continue
+		}
+		item := queries.BorrowItem{
+			Borrow:     *borrow,
+			Title:      book.Title,
+			Author:     book.Author,
+			Category:   book.Category,
+			Price:      book.Price,
+			Name:       card.Name,
+			Department: card.Department,
+		}
+		item.Resolve(now)
+		history.Items = append(history.Items, item)
+	}
+	slices.SortFunc(history.Items, func(a, b queries.BorrowItem) int {
+		if a.BorrowTime != b.BorrowTime {
+			return cmp.Compare(b.BorrowTime, a.BorrowTime)
+		}
+		return cmp.Compare(a.BookId, b.BookId)
+	})
+	history.Count = len(history.Items)
+	return database.APIResult{
+		Ok:      true,
+		Message: "Borrow histories fetched successfully",
+		Payload: history,
+	}
+}
+
+/* Interface for cards */
+
+// RegisterCard
+// register a card. CardID is stored to card after registering it.
+//
+// @param card all attributes of the card
+func (s *Server) RegisterCard(card *database.Card) database.APIResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if card.Type != "T" && card.Type != "S" {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Invalid card type, should be 'T' or 'S'",
+			Payload: nil,
+			Code:    database.ErrInvalidCardType,
+		}
+	}
+	for _, other := range s.cards {
+		if other.Name == card.Name && other.Department == card.Department && other.Type == card.Type {
+			return database.APIResult{
+				Ok:      false,
+				Message: "Failed to register card, maybe the card already exists",
+				Payload: nil,
+				Code:    database.ErrDuplicateCard,
+			}
+		}
+	}
+	if s.cards[card.CardId] != nil {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to register card, maybe the card already exists",
+			Payload: nil,
+			Code:    database.ErrDuplicateCard,
+		}
+	}
+	if card.CardId == 0 {
+		card.CardId = s.nextCardId
+	}
+	s.nextCardId = max(s.nextCardId, card.CardId+1)
+	stored := *card
+	s.cards[card.CardId] = &stored
+	return database.APIResult{
+		Ok:      true,
+		Message: "Card registered successfully",
+		Payload: card.CardId,
+	}
+}
+
+// RemoveCard
+// remove a card and its borrow histories. the card is not
+// removed if there exists any un-returned books under it.
+//
+// @param cardId card to be removed
+func (s *Server) RemoveCard(cardId int) database.APIResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if slices.ContainsFunc(s.borrows, func(borrow *database.Borrow) bool {
+		return borrow.CardId == cardId && borrow.ReturnTime == 0
+	}) {
+		return database.APIResult{
+			Ok:      false,
+			Message: "This user has un-returned books",
+			Payload: nil,
+			Code:    database.ErrCardHasLoans,
+		}
+	}
+	if _, ok := s.cards[cardId]; !ok {
+		return database.APIResult{
+			Ok:      false,
+			Message: "This card does not exist, maybe it was already removed",
+			Payload: nil,
+			Code:    database.ErrCardNotFound,
+		}
+	}
+
+	delete(s.cards, cardId)
+	s.borrows = slices.DeleteFunc(s.borrows, func(borrow *database.Borrow) bool {
+		return borrow.CardId == cardId
+	})
+	return database.APIResult{
+		Ok:      true,
+		Message: "Card removed successfully",
+		Payload: nil,
+	}
+}
+
+// ShowCards
+// list all cards order by card_id.
+//
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.CardList}
+func (s *Server) ShowCards() database.APIResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	cards := queries.CardList{
+		Cards: make([]database.Card, 0, len(s.cards)),
+	}
+	for _, card := range s.cards {
+		cards.Cards = append(cards.Cards, *card)
+	}
+	slices.SortFunc(cards.Cards, func(a, b database.Card) int {
+		return cmp.Compare(a.CardId, b.CardId)
+	})
+	cards.Count = len(cards.Cards)
+	return database.APIResult{
+		Ok:      true,
+		Message: "Cards fetched successfully",
+		Payload: cards,
+	}
+}
+
+// insertBook stores a copy of the book with its copies in stock, and sets its BookID
+func (s *Server) insertBook(book *database.Book) {
+	if book.BookId == 0 {
+		book.BookId = s.nextBookId
+	}
+	s.nextBookId = max(s.nextBookId, book.BookId+1)
+	stored := *book
+	stored.Price = roundPrice(book.Price)
+	s.books[book.BookId] = &stored
+	s.addCopies(book.BookId, book.Stock)
+}
+
+// conflicts reports whether a book other than self has the same key or ISBN as the book
+func (s *Server) conflict(book *database.Book, self *database.Book) database.ErrorCode {
+	for _, other := range s.books {
+		if other == self {
+			continue
+		} else if book.ISBN != "" && book.ISBN == other.ISBN {
+			return database.ErrDuplicateISBN
+		} else if sameBook(book, other) {
+			return database.ErrDuplicateBook
+		}
+	}
+	return ""
+}
+
+// addCopies adds n available copies of a book with generated barcodes
+func (s *Server) addCopies(bookId int, n int) {
+	existing := len(s.copiesOf(bookId))
+	for i := 1; i <= n; i++ {
+		s.copies[s.nextCopyId] = &database.Copy{
+			CopyId:  s.nextCopyId,
+			BookId:  bookId,
+			Barcode: database.CopyBarcode(bookId, existing+i),
+			Status:  database.CopyAvailable,
+		}
+		s.nextCopyId++
+	}
+}
+
+// copiesOf returns the copies of a book order by copy_id
+func (s *Server) copiesOf(bookId int) []*database.Copy {
+	copies := make([]*database.Copy, 0)
+	for _, item := range s.copies {
+		if item.BookId == bookId {
+			copies = append(copies, item)
+		}
+	}
+	slices.SortFunc(copies, func(a, b *database.Copy) int {
+		return cmp.Compare(a.CopyId, b.CopyId)
+	})
+	return copies
+}
+
+// syncStock sets the stock of a book to the number of its available copies
+func (s *Server) syncStock(bookId int) {
+	stock := 0
+	for _, item := range s.copiesOf(bookId) {
+		if item.Status == database.CopyAvailable {
+			stock++
+		}
+	}
+	s.books[bookId].Stock = stock
+}
+
+// sameBook reports whether two books have the same key
+func sameBook(a, b *database.Book) bool {
+	return a.Category == b.Category && a.Title == b.Title && a.Press == b.Press &&
+		a.PublishYear == b.PublishYear && a.Author == b.Author
+}
+
+// normalizeISBN stores the ISBN of a book as ISBN-13 if it is given
+func normalizeISBN(book *database.Book) error {
+	if book.ISBN == "" {
+		return nil
+	}
+	isbn, err := database.NormalizeISBN(book.ISBN)
+	if err != nil {
+		return err
+	}
+	book.ISBN = isbn
+	return nil
+}
+
+// like matches a pattern case-insensitively, as the like operator of the database
+func like(s string, pattern string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(pattern))
+}
+
+// containsAny tells whether any of the values is in s
+func containsAny(s []string, values []string) bool {
+	return slices.ContainsFunc(s, func(v string) bool {
+		return slices.Contains(values, v)
+	})
+}
+
+// roundPrice rounds a price to cents, as the decimal column of the database
+func roundPrice(price float64) float64 {
+	return math.Round(price*100) / 100
+}
+
+// bookFacets counts the books by category, press, author, publish year and price
+func bookFacets(books []*database.Book) *queries.Facets {
+	categories, presses, authors := make([]string, 0), make([]string, 0), make([]string, 0)
+	years, prices := make(map[int]int), make(map[int]int)
+	for _, book := range books {
+		categories = append(categories, book.Category)
+		presses = append(presses, book.Press)
+		authors = append(authors, database.SplitAuthors(book.Author)...)
+		years[queries.YearBucket(book.PublishYear)]++
+		prices[queries.PriceBucket(book.Price)]++
+	}
+	facets := queries.Facets{
+		Category:    queries.CountValues(categories),
+		Press:       queries.CountValues(presses),
+		Author:      queries.CountValues(authors),
+		PublishYear: make([]queries.FacetCount, 0),
+		Price:       make([]queries.FacetCount, 0),
+	}
+	for _, year := range sortedKeys(years) {
+		facets.PublishYear = append(facets.PublishYear, queries.YearFacet(year, years[year]))
+	}
+	for _, price := range sortedKeys(prices) {
+		facets.Price = append(facets.Price, queries.PriceFacet(price, prices[price]))
+	}
+	return &facets
+}
+
+// sortedKeys returns the keys of the counts in ascending order
+func sortedKeys(counts map[int]int) []int {
+	keys := make([]int, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"library-management-system/server/policy"
+	"library-management-system/utils/apitest"
+	"testing"
+)
+
+var defaultPolicy, _ = policy.New(policy.Config{})
+var server = New(defaultPolicy)
+
+// target is the server under the shared test scenarios
+func target() apitest.Target {
+	return apitest.Target{
+		Server: server,
+		Reset:  server.Reset,
+		Policy: server.policy,
+	}
+}
+
+func TestBookRegister(t *testing.T) {
+	apitest.BookRegister(t, target())
+}
+
+func TestIncBookStock(t *testing.T) {
+	apitest.IncBookStock(t, target())
+}
+
+func TestBulkRegisterBook(t *testing.T) {
+	apitest.BulkRegisterBook(t, target())
+}
+
+func TestRemoveBook(t *testing.T) {
+	apitest.RemoveBook(t, target())
+}
+
+func TestModifyBookInfo(t *testing.T) {
+	apitest.ModifyBookInfo(t, target())
+}
+
+func TestQueryBook(t *testing.T) {
+	apitest.QueryBook(t, target())
+}
+
+func TestBorrowAndReturnBook(t *testing.T) {
+	apitest.BorrowAndReturnBook(t, target())
+}
+
+func TestParallelBorrowBook(t *testing.T) {
+	apitest.ParallelBorrowBook(t, target())
+}
+
+func TestRegisterAndShowAndRemoveCard(t *testing.T) {
+	apitest.RegisterAndShowAndRemoveCard(t, target())
+}
+
+func TestErrorCodes(t *testing.T) {
+	apitest.ErrorCodes(t, target())
+}
+
+func TestPaginateBooks(t *testing.T) {
+	apitest.PaginateBooks(t, target())
+}
+
+func TestSearchBooks(t *testing.T) {
+	apitest.SearchBooks(t, target())
+}
+
+func TestFacetBooks(t *testing.T) {
+	apitest.FacetBooks(t, target())
+}
+
+func TestFilterAuthors(t *testing.T) {
+	apitest.FilterAuthors(t, target())
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"library-management-system/database"
+	"net/http"
+	"strconv"
+)
+
+// loginRequest is the body of a login
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	var login loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+		server.Response(w, database.APIResult{
+			Ok:      false,
+			Message: "Invalid Arguments: failed to parse request body",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		})
+		return
+	}
+	res := server.Login(login.Username, login.Password)
+	server.Response(w, res)
+}
+
+func whoAmIHandler(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	claims, _ := identity(r)
+	server.Response(w, database.APIResult{
+		Ok:      true,
+		Message: "Logged in as " + claims.Username,
+		Payload: claims,
+	})
+}
+
+func showAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	result := server.ShowAccounts()
+	server.Response(w, result)
+}
+
+func registerAccountHandler(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	var account database.Account
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		server.Response(w, database.APIResult{
+			Ok:      false,
+			Message: "Invalid Arguments: failed to parse request body",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		})
+		return
+	}
+	account.AccountId = 0 // AccountID is assigned by the library
+	res := server.RegisterAccount(&account)
+	server.Response(w, res)
+}
+
+func removeAccountHandler(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	accountId, err := strconv.Atoi(r.URL.Query().Get("account_id"))
+	if err != nil || accountId <= 0 {
+		server.Response(w, database.APIResult{
+			Ok:      false,
+			Message: "Invalid Arguments: failed to parse request parameter, expect positive integer",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		})
+		return
+	}
+	res := server.RemoveAccount(accountId)
+	server.Response(w, res)
+}
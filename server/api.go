@@ -1,18 +1,70 @@
 package server
 
 import (
+	"cmp"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
 	"library-management-system/database"
+	"library-management-system/server/auth"
+	"library-management-system/server/csvio"
+	"library-management-system/server/marc"
 	"library-management-system/server/queries"
+	"math"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 )
 
 type Server struct{}
 
+// rejection is returned from a transaction when a request breaks
+// the rules of the library rather than failing in the database
+type rejection struct {
+	code   database.ErrorCode
+	reason string
+}
+
+func (r rejection) Error() string {
+	return r.reason
+}
+
+// conflict returns code if err violates a unique constraint, or logs
+// err and returns database.ErrInternal if it fails otherwise
+func conflict(err error, code database.ErrorCode) database.ErrorCode {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return code
+	}
+	logrus.WithError(err).Error("request failed in the database")
+	return database.ErrInternal
+}
+
+// bookConflict tells whether storing or modifying books failed with
+// an ISBN of another book, or with the same book as another one.
+// the ISBNs are looked up in db, which is the transaction of the
+// books if it is not rolled back yet.
+func bookConflict(db *gorm.DB, err error, books ...*database.Book) database.ErrorCode {
+	code := conflict(err, database.ErrDuplicateBook)
+	if code != database.ErrDuplicateBook {
+		return code
+	}
+	for _, book := range books {
+		var count int64
+		if book.ISBN != "" && db.Model(&database.Book{}).
+			Where("isbn = ? and book_id <> ?", book.ISBN, book.BookId).
+			Count(&count).Error == nil && count > 0 {
+			return database.ErrDuplicateISBN
+		}
+	}
+	return code
+}
+
 /**
  * Note:
  *      (1) all functions in this interface will be regarded as a
@@ -38,17 +90,34 @@ type Server struct{}
 //	         completing this operation.
 //	     (2) you should not register this book if the book already
 //	         exists in the library system.
+//	     (3) the ISBN is optional, and is stored as ISBN-13.
 //
 //	@param book all attributes of the book
 func (s *Server) StoreBook(book *database.Book) database.APIResult {
-	// Store the book
+	if err := normalizeISBN(book); err != nil {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to store book, " + err.Error(),
+			Payload: nil,
+			Code:    database.ErrInvalidISBN,
+		}
+	}
+
+	// Store the book and its copies
 	// BookID is set via gorm
 	// the database prevents duplicate book entries by primary key constraint
-	if err := database.DB.Create(book).Error; err != nil {
+	bookId := book.BookId
+	err := database.Transaction(func(tx *gorm.DB) error {
+		book.BookId = bookId // set by an aborted attempt
+		return storeBook(tx, book)
+	})
+	if err != nil {
+		book.BookId = bookId // the transaction is rolled back
 		return database.APIResult{
 			Ok:      false,
-			Message: "Failed to store book, maybe the book already exists",
-			Payload: err,
+			Message: "Failed to store book, maybe the book or its ISBN already exists",
+			Payload: nil,
+			Code:    bookConflict(database.DB, err, book),
 		}
 	}
 	return database.APIResult{
@@ -58,6 +127,17 @@ func (s *Server) StoreBook(book *database.Book) database.APIResult {
 	}
 }
 
+// storeBook creates the book with its authors and copies
+func storeBook(tx *gorm.DB, book *database.Book) error {
+	if err := tx.Create(book).Error; err != nil {
+		return err
+	}
+	if err := database.CreditAuthors(tx, book.BookId, book.Author); err != nil {
+		return err
+	}
+	return addCopies(tx, book.BookId, book.Stock)
+}
+
 // IncBookStock
 // increase the book's inventory by bookId & deltaStock.
 //
@@ -67,6 +147,9 @@ func (s *Server) StoreBook(book *database.Book) database.APIResult {
 //	(2) deltaStock can be negative, but make sure that
 //	    the result of book.stock + deltaStock is not negative!
 //
+// copies are added with generated barcodes, or the latest available
+// copies are withdrawn.
+//
 // @param bookId book's BookID
 // @param deltaStock increase count to book's stock, must be greater
 func (s *Server) IncBookStock(bookId int, deltaStock int) database.APIResult {
@@ -77,6 +160,7 @@ func (s *Server) IncBookStock(bookId int, deltaStock int) database.APIResult {
 			Ok:      false,
 			Message: "This book does not exist",
 			Payload: nil,
+			Code:    database.ErrBookNotFound,
 		}
 	}
 
@@ -86,17 +170,58 @@ func (s *Server) IncBookStock(bookId int, deltaStock int) database.APIResult {
 			Ok:      false,
 			Message: "Stock deltaStock becomes invalid after incrementing, please check the arguments",
 			Payload: nil,
+			Code:    database.ErrInvalidStock,
 		}
 	}
 
 	// Performing the increment operation
-	// By default, gorm perform write (create/update/delete) operations
-	// run inside a transaction to ensure data consistency
-	if err := database.DB.Model(&book).Update("stock", book.Stock+deltaStock).Error; err != nil {
+	// by adding new copies or withdrawing available ones
+	err := database.Transaction(func(tx *gorm.DB) error {
+		if deltaStock > 0 {
+			if err := addCopies(tx, bookId, deltaStock); err != nil {
+				return err
+			}
+		} else if deltaStock < 0 {
+			copyIds := make([]int, 0)
+			if err := tx.Model(&database.Copy{}).
+				Where("book_id = ? and status = ?", bookId, database.CopyAvailable).
+				Order("copy_id desc").
+				Limit(-deltaStock).
+				Pluck("copy_id", &copyIds).Error; err != nil {
+				return err
+			}
+			if len(copyIds) < -deltaStock { // withdrawn or borrowed concurrently
+				return rejection{database.ErrInvalidStock, "not enough available copies to withdraw"}
+			}
+			// status = available again, so that a copy borrowed or withdrawn concurrently is not withdrawn
+			result := tx.Model(&database.Copy{}).
+				Where("copy_id in ? and status = ?", copyIds, database.CopyAvailable).
+				Update("status", database.CopyWithdrawn)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != int64(len(copyIds)) {
+				return rejection{database.ErrInvalidStock, "not enough available copies to withdraw"}
+			}
+		}
+		// New copies are set aside for waiting holds before going to stock
+		return serveHolds(tx, bookId, time.Now().UnixMilli())
+	})
+	var reason rejection
+	if errors.As(err, &reason) {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to increment book stock, " + reason.Error(),
+			Payload: nil,
+			Code:    reason.code,
+		}
+	} else if err != nil {
+		logrus.WithError(err).Error("failed to increment book stock")
 		return database.APIResult{
 			Ok:      false,
 			Message: "Failed to increment book stock",
 			Payload: nil,
+			Code:    database.ErrInternal,
 		}
 	}
 	return database.APIResult{
@@ -107,7 +232,8 @@ func (s *Server) IncBookStock(bookId int, deltaStock int) database.APIResult {
 }
 
 // StoreBooks
-// batch store books.
+// batch store books. the stored books with their BookIDs are
+// returned by database.APIResult.payload as {@link queries.BookList}.
 //
 // Note that:
 //
@@ -123,16 +249,52 @@ func (s *Server) IncBookStock(bookId int, deltaStock int) database.APIResult {
 //
 // @param books list of books to be stored
 func (s *Server) StoreBooks(books []*database.Book) database.APIResult {
+	// Check the ISBNs within the batch
+	isbns := make(map[string]bool)
+	for _, book := range books {
+		if err := normalizeISBN(book); err != nil {
+			return database.APIResult{
+				Ok:      false,
+				Message: "Failed to store books, " + err.Error(),
+				Payload: nil,
+				Code:    database.ErrInvalidISBN,
+			}
+		}
+		if book.ISBN == "" {
+			continue
+		}
+		if isbns[book.ISBN] {
+			return database.APIResult{
+				Ok:      false,
+				Message: "Failed to store books, duplicate ISBN " + book.ISBN + " in the batch",
+				Payload: nil,
+				Code:    database.ErrDuplicateISBN,
+			}
+		}
+		isbns[book.ISBN] = true
+	}
+
 	// Batch store books via transaction in gorm
-	err := database.DB.Transaction(func(tx *gorm.DB) error {
+	err := database.Transaction(func(tx *gorm.DB) error {
 		// Add creation of each book to the transaction
 		for _, book := range books {
 			book.BookId = 0
 			if err := tx.Create(book).Error; err != nil {
 				return err
 			}
+			if err := database.CreditAuthors(tx, book.BookId, book.Author); err != nil {
+				return err
+			}
 		}
-		return nil
+		// Then the copies of all books
+		copies := make([]database.Copy, 0)
+		for _, book := range books {
+			copies = append(copies, newCopies(book.BookId, 0, book.Stock)...)
+		}
+		if len(copies) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&copies, 500).Error
 	})
 	if err != nil {
 		// Restore BookId, which is assigned by gorm before inserting into the database
@@ -142,14 +304,22 @@ func (s *Server) StoreBooks(books []*database.Book) database.APIResult {
 		}
 		return database.APIResult{
 			Ok:      false,
-			Message: "Failed to store books, maybe one of them already exists",
-			Payload: err,
+			Message: "Failed to store books, maybe one of them or its ISBN already exists",
+			Payload: nil,
+			Code:    bookConflict(database.DB, err, books...),
 		}
 	}
+	stored := queries.BookList{
+		Count: len(books),
+		Books: make([]database.Book, 0, len(books)),
+	}
+	for _, book := range books {
+		stored.Books = append(stored.Books, *book)
+	}
 	return database.APIResult{
 		Ok:      true,
 		Message: "Books stored successfully",
-		Payload: nil,
+		Payload: stored,
 	}
 }
 
@@ -162,30 +332,47 @@ func (s *Server) StoreBooks(books []*database.Book) database.APIResult {
 //
 //	@param bookId the book to be removed
 func (s *Server) RemoveBook(bookId int) database.APIResult {
-	// Check if someone has not returned this book
-	var count int64
-	database.DB.Model(&database.Borrow{}).Where("book_id = ? and return_time = 0", bookId).Count(&count)
-	if count > 0 {
-		return database.APIResult{
-			Ok:      false,
-			Message: "This book has some un-returned copies",
-			Payload: nil,
-		}
+	// Serializable, so that the book is not borrowed between the check and the removal,
+	// which would remove the borrow along with the book
+	opts := sql.TxOptions{
+		Isolation: sql.LevelSerializable,
+		ReadOnly:  false,
 	}
+	err := database.Transaction(func(tx *gorm.DB) error {
+		// Check if someone has not returned this book
+		var count int64
+		if err := tx.Model(&database.Borrow{}).Where("book_id = ? and return_time = 0", bookId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return rejection{database.ErrBookOnLoan, "this book has some un-returned copies"}
+		}
 
-	// Remove the book
-	result := database.DB.Delete(&database.Book{}, bookId)
-	if result.Error != nil {
+		// Remove the book
+		result := tx.Delete(&database.Book{}, bookId)
+		if result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 { // Delete will succeed even if the book does not exist
+			return rejection{database.ErrBookNotFound, "this book does not exist, maybe it was already removed"}
+		}
+		return nil
+	}, &opts)
+
+	var reason rejection
+	if errors.As(err, &reason) {
 		return database.APIResult{
 			Ok:      false,
-			Message: "Failed to remove book",
-			Payload: result.Error,
+			Message: "Failed to remove book, " + reason.Error(),
+			Payload: nil,
+			Code:    reason.code,
 		}
-	} else if result.RowsAffected == 0 { // Delete will succeed even if the book does not exist
+	} else if err != nil {
+		logrus.WithError(err).Error("failed to remove book")
 		return database.APIResult{
 			Ok:      false,
-			Message: "This book does not exist, maybe it was already removed",
+			Message: "Failed to remove book",
 			Payload: nil,
+			Code:    database.ErrInternal,
 		}
 	}
 
@@ -211,15 +398,35 @@ func (s *Server) ModifyBookInfo(book *database.Book) database.APIResult {
 			Ok:      false,
 			Message: "That book that does not exist, you cannot modify book_id",
 			Payload: nil,
+			Code:    database.ErrBookNotFound,
+		}
+	}
+
+	if err := normalizeISBN(book); err != nil {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to modify book info, " + err.Error(),
+			Payload: nil,
+			Code:    database.ErrInvalidISBN,
 		}
 	}
 
-	// Modify the book info
-	if err := database.DB.Model(book).Omit("book_id", "stock").Updates(book).Error; err != nil {
+	// Modify the book info, and the author credits along with the authors
+	err := database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(book).Omit("book_id", "stock").Updates(book).Error; err != nil {
+			return err
+		}
+		if book.Author == "" || book.Author == origBook.Author {
+			return nil
+		}
+		return database.CreditAuthors(tx, book.BookId, book.Author)
+	})
+	if err != nil {
 		return database.APIResult{
 			Ok:      false,
 			Message: "Failed to modify book info",
-			Payload: err,
+			Payload: nil,
+			Code:    bookConflict(database.DB, err, book),
 		}
 	}
 	return database.APIResult{
@@ -251,18 +458,95 @@ func (s *Server) QueryBooks(conditions queries.BookQueryConditions) database.API
 		Results: make([]database.Book, 0),
 	}
 
+	// Check the sort column and order, which are put into the query as they are
+	if queries.GetComparator(cmp.Or(conditions.SortBy, queries.BookId)) == nil ||
+		(conditions.SortOrder != "" && !slices.Contains(queries.SortOrders, conditions.SortOrder)) {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to query books, invalid sort_by or sort_order",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		}
+	}
+	if conditions.Match != "" && !slices.Contains(queries.MatchModes, conditions.Match) {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to query books, invalid match",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		}
+	}
+	cursor, err := conditions.PageCursor()
+	if err != nil {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to query books, " + err.Error(),
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		}
+	}
+
 	query := database.DB.Model(&database.Book{})
+	if conditions.ISBN != "" {
+		isbn, err := database.NormalizeISBN(conditions.ISBN)
+		if err != nil {
+			return database.APIResult{
+				Ok:      false,
+				Message: "Failed to query books, " + err.Error(),
+				Payload: nil,
+				Code:    database.ErrInvalidISBN,
+			}
+		}
+		query = query.Where("isbn = ?", isbn)
+	}
+	// match compares a column with the pattern of a value in the match mode
+	match, pattern := "%s like ?", func(value string) string { return "%" + value + "%" }
+	if conditions.Match == queries.Exact {
+		match, pattern = "%s = ?", func(value string) string { return value }
+	}
 	if conditions.Category != "" {
-		query = query.Where("category like ?", "%"+conditions.Category+"%")
+		query = query.Where(fmt.Sprintf(match, "category"), pattern(conditions.Category))
 	}
 	if conditions.Title != "" {
-		query = query.Where("title like ?", "%"+conditions.Title+"%")
+		query = query.Where(fmt.Sprintf(match, "title"), pattern(conditions.Title))
 	}
 	if conditions.Press != "" {
-		query = query.Where("press like ?", "%"+conditions.Press+"%")
+		query = query.Where(fmt.Sprintf(match, "press"), pattern(conditions.Press))
 	}
 	if conditions.Author != "" {
-		query = query.Where("author like ?", "%"+conditions.Author+"%")
+		query = query.Where(fmt.Sprintf(match+" or book_id in (?)", "author"), pattern(conditions.Author),
+			creditedBooks(fmt.Sprintf(match, "contributors.name"), pattern(conditions.Author)))
+	}
+	if len(conditions.Categories) > 0 {
+		query = query.Where("category in ?", conditions.Categories)
+	}
+	if len(conditions.Presses) > 0 {
+		query = query.Where("press in ?", conditions.Presses)
+	}
+	if len(conditions.Authors) > 0 {
+		query = query.Where("book_id in (?)",
+			creditedBooks("contributors.name in ?", conditions.Authors))
+	}
+	if len(conditions.ExcludeCategories) > 0 {
+		query = query.Where("category not in ?", conditions.ExcludeCategories)
+	}
+	if len(conditions.ExcludePresses) > 0 {
+		query = query.Where("press not in ?", conditions.ExcludePresses)
+	}
+	if len(conditions.ExcludeAuthors) > 0 {
+		query = query.Where("book_id not in (?)",
+			creditedBooks("contributors.name in ?", conditions.ExcludeAuthors))
+	}
+	if conditions.InStock {
+		query = query.Where("stock > 0")
+	}
+	if conditions.Contributor != "" {
+		if conditions.Role != "" {
+			query = query.Where("book_id in (?)",
+				creditedBooks("contributors.name = ? and credits.role = ?", conditions.Contributor, conditions.Role))
+		} else {
+			query = query.Where("book_id in (?)", creditedBooks("contributors.name = ?", conditions.Contributor))
+		}
 	}
 	if conditions.MinPublishYear != 0 {
 		query = query.Where("publish_year >= ?", conditions.MinPublishYear)
@@ -276,6 +560,11 @@ func (s *Server) QueryBooks(conditions queries.BookQueryConditions) database.API
 	if conditions.MaxPrice != 0 {
 		query = query.Where("price <= ?", conditions.MaxPrice)
 	}
+	terms := queries.SearchTerms(conditions.Q)
+	var relevance clause.Expr
+	if len(terms) > 0 {
+		query, relevance = searchBooks(query, terms)
+	}
 	sortBy := "book_id"
 	sortOrder := "asc"
 	if conditions.SortBy != "" {
@@ -285,19 +574,78 @@ func (s *Server) QueryBooks(conditions queries.BookQueryConditions) database.API
 		sortOrder = string(conditions.SortOrder)
 	}
 	sortCondition := fmt.Sprintf("%v %v", sortBy, sortOrder)
-	if !(conditions.SortBy == queries.BookId && conditions.SortOrder == queries.Desc) {
+	if sortBy != string(queries.BookId) {
 		sortCondition += ", book_id asc"
 	}
-	result := query.Order(sortCondition).Scan(&books.Results)
 
-	if result.Error != nil {
+	// Count all matching books, then fetch the page
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logrus.WithError(err).Error("failed to count books")
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to query books",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	if conditions.Facets {
+		facets, err := bookFacets(query)
+		if err != nil {
+			logrus.WithError(err).Error("failed to count facets of books")
+			return database.APIResult{
+				Ok:      false,
+				Message: "Failed to query books",
+				Payload: nil,
+				Code:    database.ErrInternal,
+			}
+		}
+		books.Facets = facets
+	}
+	page := query.Order(sortCondition)
+	if conditions.Ranked() { // the most relevant first
+		page = query.Order(clause.OrderBy{Expression: clause.Expr{SQL: "? desc, book_id asc", Vars: []interface{}{relevance}}})
+	}
+	if cursor != nil {
+		// Continue after the book of the cursor in the order of the sort column, then book_id
+		operator := map[string]string{"asc": ">", "desc": "<"}[sortOrder]
+		if sortBy == string(queries.BookId) {
+			page = page.Where(fmt.Sprintf("book_id %s ?", operator), cursor.BookId)
+		} else {
+			page = page.Where(fmt.Sprintf("%s %s ? or (%s = ? and book_id > ?)", sortBy, operator, sortBy),
+				cursor.Value, cursor.Value, cursor.BookId)
+		}
+	}
+	if conditions.Limit > 0 {
+		// Fetch one more book to tell whether there is a next page
+		page = page.Offset(conditions.Offset).Limit(conditions.Limit + 1)
+	}
+	if err := page.Scan(&books.Results).Error; err != nil {
+		logrus.WithError(err).Error("failed to query books")
 		return database.APIResult{
 			Ok:      false,
 			Message: "Failed to query books",
-			Payload: result.Error,
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	if conditions.Limit == 0 { // OFFSET needs LIMIT in SQL
+		books.Results = books.Results[min(conditions.Offset, len(books.Results)):]
+	} else if len(books.Results) > conditions.Limit {
+		books.Results = books.Results[:conditions.Limit]
+		if !conditions.Ranked() {
+			books.NextCursor = queries.NewCursor(&books.Results[conditions.Limit-1], conditions.SortBy, conditions.SortOrder)
+		}
+	}
+	books.Count = len(books.Results)
+	books.Total = int(total)
+	if len(terms) > 0 {
+		books.Highlights = make(map[int]queries.Highlight, len(books.Results))
+		for i := range books.Results {
+			books.Highlights[books.Results[i].BookId] = queries.Highlights(&books.Results[i], terms)
 		}
 	}
-	books.Count = int(result.RowsAffected)
 	return database.APIResult{
 		Ok:      true,
 		Message: "Books queried successfully",
@@ -305,6 +653,102 @@ func (s *Server) QueryBooks(conditions queries.BookQueryConditions) database.API
 	}
 }
 
+// QueryBook
+// look up a book by its BookID.
+//
+// @param bookId book's BookID
+//
+// @return the book should be returned by database.APIResult.payload
+func (s *Server) QueryBook(bookId int) database.APIResult {
+	book := database.Book{}
+	result := database.DB.Where("book_id = ?", bookId).Limit(1).Find(&book)
+	if result.Error != nil {
+		logrus.WithError(result.Error).Error("failed to query book")
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to query book",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	if result.RowsAffected == 0 {
+		return database.APIResult{
+			Ok:      false,
+			Message: "This book does not exist",
+			Payload: nil,
+			Code:    database.ErrBookNotFound,
+		}
+	}
+	return database.APIResult{
+		Ok:      true,
+		Message: "Book queried successfully",
+		Payload: book,
+	}
+}
+
+// QueryBookByISBN
+// look up a book by its ISBN-10 or ISBN-13.
+//
+// @param isbn the ISBN, hyphens and spaces are ignored
+//
+// @return the book should be returned by database.APIResult.payload
+func (s *Server) QueryBookByISBN(isbn string) database.APIResult {
+	normalized, err := database.NormalizeISBN(isbn)
+	if err != nil {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to query book, " + err.Error(),
+			Payload: nil,
+			Code:    database.ErrInvalidISBN,
+		}
+	}
+	book := database.Book{}
+	result := database.DB.Where("isbn = ?", normalized).Limit(1).Find(&book)
+	if result.Error != nil {
+		logrus.WithError(result.Error).Error("failed to query book")
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to query book",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	if result.RowsAffected == 0 {
+		return database.APIResult{
+			Ok:      false,
+			Message: "No book with ISBN " + normalized,
+			Payload: nil,
+			Code:    database.ErrBookNotFound,
+		}
+	}
+	return database.APIResult{
+		Ok:      true,
+		Message: "Book queried successfully",
+		Payload: book,
+	}
+}
+
+// creditedBooks is a subquery of the ids of books with credits satisfying the condition
+func creditedBooks(condition string, args ...interface{}) *gorm.DB {
+	return database.DB.Model(&database.Credit{}).
+		Select("credits.book_id").
+		Joins("join contributors on contributors.contributor_id = credits.contributor_id").
+		Where(condition, args...)
+}
+
+// normalizeISBN stores the ISBN of a book as ISBN-13 if it is given
+func normalizeISBN(book *database.Book) error {
+	if book.ISBN == "" {
+		return nil
+	}
+	isbn, err := database.NormalizeISBN(book.ISBN)
+	if err != nil {
+		return err
+	}
+	book.ISBN = isbn
+	return nil
+}
+
 /* Interface for borrow & return books */
 
 // BorrowBook
@@ -312,10 +756,13 @@ func (s *Server) QueryBooks(conditions queries.BookQueryConditions) database.API
 // a user borrows one book with the specific card.
 // the borrow operation will success iff there are
 // enough books in stock & the user has not borrowed
-// the book or has returned it.
+// the book or has returned it & the card is within the
+// loan limits of its card type and the book's category
+// & the card has fewer unpaid fines than the limit.
+// the due time is set from the loan period of the policy.
 //
 // @param borrow information, include borrower &
-// book's id & time
+// book's id & time, and optionally the copy's id
 func (s *Server) BorrowBook(borrow database.Borrow) database.APIResult {
 	borrow.ReturnTime = 0
 	// Set the isolation level to handle concurrency transactions
@@ -324,26 +771,104 @@ func (s *Server) BorrowBook(borrow database.Borrow) database.APIResult {
 		ReadOnly:  false,
 	}
 	// Use the time from borrow.BorrowTime
-	err := database.DB.Transaction(func(tx *gorm.DB) error {
-		// Check if there are enough books in stock
-		var stock int
-		err := tx.Model(&database.Book{}).Select("stock").
-			Where("book_id = ?", borrow.BookId).Row().
-			Scan(&stock)
-		if err != nil {
+	copyId := borrow.CopyId
+	err := database.Transaction(func(tx *gorm.DB) error {
+		borrow.CopyId = copyId // chosen by an aborted attempt
+		card := database.Card{}
+		if err := tx.First(&card, borrow.CardId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return rejection{database.ErrCardNotFound, "card does not exist"}
+			}
+			return err
+		}
+		if err := expireHolds(tx, borrow.BookId, time.Now().UnixMilli()); err != nil {
+			return err
+		}
+		book := database.Book{}
+		if err := tx.First(&book, borrow.BookId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return rejection{database.ErrBookNotFound, "book does not exist"}
+			}
 			return err
 		}
-		if stock <= 0 {
-			return fmt.Errorf("book out of stock")
+
+		// Check if there are enough books in stock, or a copy is set aside for the card
+		hold := database.Hold{}
+		result := tx.Where("card_id = ? and book_id = ? and status = ?", borrow.CardId, borrow.BookId, database.HoldReady).
+			Limit(1).Find(&hold)
+		if result.Error != nil {
+			return result.Error
+		}
+		held := result.RowsAffected > 0
+		if !held && book.Stock <= 0 {
+			return rejection{database.ErrBookOutOfStock, "book out of stock"}
 		}
 
 		// Check if the user has not borrowed the book or has returned it
 		var count int64
-		tx.Model(&database.Borrow{}).
+		if err := tx.Model(&database.Borrow{}).
 			Where("card_id = ? and book_id = ? and return_time = 0", borrow.CardId, borrow.BookId).
-			Count(&count)
+			Count(&count).Error; err != nil {
+			return err
+		}
 		if count > 0 { // There is a borrow record without return time
-			return fmt.Errorf("user has not returned the book")
+			return rejection{database.ErrAlreadyBorrowed, "user has not returned the book"}
+		}
+
+		// Check the loan limits of the card type and the book category
+		limits := Policy.Resolve(card.Type, book.Category)
+		if limits.MaxLoans > 0 {
+			count = 0
+			if err := tx.Model(&database.Borrow{}).
+				Where("card_id = ? and return_time = 0", borrow.CardId).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count >= int64(limits.MaxLoans) {
+				return rejection{database.ErrLoanLimit, fmt.Sprintf("card has reached the limit of %d concurrent loans", limits.MaxLoans)}
+			}
+		}
+		if limits.MaxCategoryLoans > 0 {
+			count = 0
+			if err := tx.Model(&database.Borrow{}).
+				Joins("join books on books.book_id = borrows.book_id").
+				Where("borrows.card_id = ? and borrows.return_time = 0 and books.category = ?", borrow.CardId, book.Category).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count >= int64(limits.MaxCategoryLoans) {
+				return rejection{database.ErrLoanLimit, fmt.Sprintf("card has reached the limit of %d concurrent loans in category %s",
+					limits.MaxCategoryLoans, book.Category)}
+			}
+		}
+		if limits.MaxUnpaidFines > 0 {
+			balance, err := unpaidFines(tx, borrow.CardId)
+			if err != nil {
+				return err
+			}
+			if balance >= limits.MaxUnpaidFines {
+				return rejection{database.ErrFineLimit, fmt.Sprintf("card has %.2f unpaid fines, reaching the limit of %.2f",
+					balance, limits.MaxUnpaidFines)}
+			}
+		}
+		borrow.DueTime = borrow.BorrowTime + limits.LoanPeriod().Milliseconds()
+
+		// Choose the copy set aside for the card, the copy scanned at the desk, or any available one
+		if held {
+			borrow.CopyId = hold.CopyId
+		} else {
+			item := database.Copy{}
+			query := tx.Where("book_id = ? and status = ?", borrow.BookId, database.CopyAvailable)
+			if borrow.CopyId != 0 {
+				query = query.Where("copy_id = ?", borrow.CopyId)
+			}
+			err := query.Order("copy_id asc").Take(&item).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return rejection{database.ErrCopyUnavailable, "copy is not available"}
+			} else if err != nil {
+				return err
+			}
+			borrow.CopyId = item.CopyId
 		}
 
 		/* Check is OKay */
@@ -351,23 +876,40 @@ func (s *Server) BorrowBook(borrow database.Borrow) database.APIResult {
 		if err := tx.Create(&borrow).Error; err != nil {
 			return err
 		}
-		// Update the stock of the book
-		if err := tx.Model(&database.Book{}).
-			Where("book_id = ?", borrow.BookId).
-			Update("stock", gorm.Expr("stock - 1")).Error; err != nil {
+		if err := tx.Model(&database.Copy{}).
+			Where("copy_id = ?", borrow.CopyId).
+			Update("status", database.CopyOnLoan).Error; err != nil {
 			return err
 		}
+		// Fulfill the hold of the copy set aside
+		if held {
+			if err := tx.Model(&database.Hold{}).
+				Where("card_id = ? and book_id = ? and hold_time = ?", hold.CardId, hold.BookId, hold.HoldTime).
+				Update("status", database.HoldFulfilled).Error; err != nil {
+				return err
+			}
+		}
 
-		// Return nil to commit the transaction
-		return nil
+		// Update the stock of the book, and return nil to commit the transaction
+		return syncStock(tx, borrow.BookId)
 	}, &opts)
 
 	// If transaction failed, return error
-	if err != nil {
+	var reason rejection
+	if errors.As(err, &reason) {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to borrow book, " + reason.Error(),
+			Payload: nil,
+			Code:    reason.code,
+		}
+	} else if err != nil {
+		// the same borrow is recorded within the millisecond
 		return database.APIResult{
 			Ok:      false,
-			Message: "Failed to borrow book, maybe the user haven't returned the book or the book is out of stock",
-			Payload: err,
+			Message: "Failed to borrow book",
+			Payload: nil,
+			Code:    conflict(err, database.ErrAlreadyBorrowed),
 		}
 	}
 	return database.APIResult{
@@ -380,6 +922,8 @@ func (s *Server) BorrowBook(borrow database.Borrow) database.APIResult {
 // ReturnBook
 //
 // A user return one book with specific card.
+// a fine is charged if the book is returned after its due time,
+// and returned by database.APIResult.payload.
 //
 // @param borrow
 // borrow information, include borrower & book's id & return time
@@ -389,36 +933,87 @@ func (s *Server) ReturnBook(borrow database.Borrow) database.APIResult {
 			Ok:      false,
 			Message: "Return time should be later than borrow time",
 			Payload: nil,
+			Code:    database.ErrInvalidTime,
 		}
 	}
 	borrow.BorrowTime = 0 // cannot modify borrow time
-	err := database.DB.Transaction(func(tx *gorm.DB) error {
+	notBorrowed := rejection{database.ErrBorrowNotFound, "no borrow record found, maybe the user have returned the book or the book is not borrowed"}
+	var fine *database.Fine
+	err := database.Transaction(func(tx *gorm.DB) error {
+		fine = nil // charged by an aborted attempt
 		// return_time = 0 because a book can be borrowed
 		// multiple times by the same card (but not the same time)
+		open := database.Borrow{}
+		err := tx.Where("card_id = ? and book_id = ? and return_time = 0", borrow.CardId, borrow.BookId).
+			Take(&open).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return notBorrowed
+		} else if err != nil {
+			return err
+		}
+		// return_time = 0 again, so that only one of concurrent returns of the loan succeeds
 		result := tx.Model(&database.Borrow{}).
-			Where("card_id = ? and book_id = ? and return_time = 0", borrow.CardId, borrow.BookId).
+			Where("card_id = ? and book_id = ? and borrow_time = ? and return_time = 0", open.CardId, open.BookId, open.BorrowTime).
 			Update("return_time", borrow.ReturnTime)
-		if err := result.Error; err != nil {
-			return err
-		} else if result.RowsAffected == 0 {
-			return fmt.Errorf("no borrow record found, maybe the user have returned the book or the book is not borrowed")
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return notBorrowed
 		}
 
-		// Update the stock of the book
-		if err := tx.Model(&database.Book{}).
-			Where("book_id = ?", borrow.BookId).
-			Update("stock", gorm.Expr("stock + 1")).Error; err != nil {
-			return err
+		// Charge a fine if the book is returned after its due time
+		if daysLate := queries.DaysLate(open.DueTime, borrow.ReturnTime); open.DueTime > 0 && daysLate > 0 {
+			card := database.Card{}
+			if err := tx.First(&card, open.CardId).Error; err != nil {
+				return err
+			}
+			book := database.Book{}
+			if err := tx.First(&book, open.BookId).Error; err != nil {
+				return err
+			}
+			if amount := Policy.Resolve(card.Type, book.Category).Fine(daysLate); amount > 0 {
+				fine = &database.Fine{
+					CardId:     open.CardId,
+					BookId:     open.BookId,
+					BorrowTime: open.BorrowTime,
+					DaysLate:   daysLate,
+					Amount:     amount,
+					CreateTime: borrow.ReturnTime,
+				}
+				if err := tx.Create(fine).Error; err != nil {
+					return err
+				}
+			}
 		}
-		return nil
+
+		// Set the copy aside for the next hold in the queue, or put it back to stock
+		return releaseCopy(tx, open.BookId, open.CopyId, borrow.ReturnTime)
 	})
 
 	// If transaction failed, return error
-	if err != nil {
+	var reason rejection
+	if errors.As(err, &reason) {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to return book, " + reason.Error(),
+			Payload: nil,
+			Code:    reason.code,
+		}
+	} else if err != nil {
+		logrus.WithError(err).Error("failed to return book")
 		return database.APIResult{
 			Ok:      false,
-			Message: "Failed to return book, maybe the user have returned the book or the book is not borrowed",
-			Payload: err,
+			Message: "Failed to return book",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	if fine != nil {
+		return database.APIResult{
+			Ok:      true,
+			Message: fmt.Sprintf("Book returned successfully, %d days late with a fine of %.2f", fine.DaysLate, fine.Amount),
+			Payload: fine,
 		}
 	}
 	return database.APIResult{
@@ -428,8 +1023,95 @@ func (s *Server) ReturnBook(borrow database.Borrow) database.APIResult {
 	}
 }
 
+// RenewBorrow
+//
+// A user renews one book with the specific card.
+// the renewal will success iff the user has not returned
+// the book & nobody is waiting for the book & the loan has
+// been renewed fewer times than the policy allows. the new
+// due time is one loan period after the renewal.
+//
+// @param borrow borrow information, include borrower & book's id
+//
+// @return the renewed borrow should be returned by database.APIResult.payload
+func (s *Server) RenewBorrow(borrow database.Borrow) database.APIResult {
+	opts := sql.TxOptions{
+		Isolation: sql.LevelSerializable,
+		ReadOnly:  false,
+	}
+	renewTime := time.Now().UnixMilli()
+	renewed := database.Borrow{}
+	err := database.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("card_id = ? and book_id = ? and return_time = 0", borrow.CardId, borrow.BookId).
+			First(&renewed).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return rejection{database.ErrBorrowNotFound, "no borrow record found, maybe the user have returned the book or the book is not borrowed"}
+		} else if err != nil {
+			return err
+		}
+		card := database.Card{}
+		if err := tx.First(&card, renewed.CardId).Error; err != nil {
+			return err
+		}
+		book := database.Book{}
+		if err := tx.First(&book, renewed.BookId).Error; err != nil {
+			return err
+		}
+
+		// Check if another patron is waiting for the book
+		var waiting int64
+		if err := tx.Model(&database.Hold{}).
+			Where("book_id = ? and status = ?", renewed.BookId, database.HoldWaiting).
+			Count(&waiting).Error; err != nil {
+			return err
+		}
+		if waiting > 0 {
+			return rejection{database.ErrBookReserved, "another patron is waiting for the book"}
+		}
+
+		// Check the renewal limit of the card type and the book category
+		limits := Policy.Resolve(card.Type, book.Category)
+		if renewed.Renewals >= limits.MaxRenewals {
+			return rejection{database.ErrRenewalLimit, fmt.Sprintf("loan has reached the limit of %d renewals", limits.MaxRenewals)}
+		}
+
+		renewed.Renewals++
+		renewed.DueTime = max(renewed.DueTime, renewTime+limits.LoanPeriod().Milliseconds())
+		return tx.Model(&database.Borrow{}).
+			Where("card_id = ? and book_id = ? and borrow_time = ?", renewed.CardId, renewed.BookId, renewed.BorrowTime).
+			Updates(map[string]interface{}{"renewals": renewed.Renewals, "due_time": renewed.DueTime}).Error
+	}, &opts)
+
+	var reason rejection
+	if errors.As(err, &reason) {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to renew book, " + reason.Error(),
+			Payload: nil,
+			Code:    reason.code,
+		}
+	} else if err != nil {
+		logrus.WithError(err).Error("failed to renew book")
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to renew book",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	return database.APIResult{
+		Ok:      true,
+		Message: "Book renewed successfully",
+		Payload: renewed,
+	}
+}
+
+// borrowItemColumns are the columns of {@link queries.BorrowItem}
+// from borrows joined with books and cards
+const borrowItemColumns = "borrows.*, books.title, books.author, books.category, books.price, cards.name, cards.department"
+
 // ShowBorrowHistories
-// list all borrow histories for a specific card.
+// list all borrow histories for a specific card, with the details of the books.
 // the returned records should be sorted by borrowTime DESC, bookId ASC
 //
 // @param cardId show which card's borrow history
@@ -438,20 +1120,28 @@ func (s *Server) ReturnBook(borrow database.Borrow) database.APIResult {
 //	and should be an instance of {@link queries.BorrowHistories}
 func (s *Server) ShowBorrowHistories(cardId int) database.APIResult {
 	history := queries.BorrowHistories{
-		Items: make([]database.Borrow, 0),
+		Items: make([]queries.BorrowItem, 0),
 	}
 	err := database.DB.Model(&database.Borrow{}).
-		Joins("natural join books").
+		Select(borrowItemColumns).
+		Joins("join books on books.book_id = borrows.book_id").
+		Joins("join cards on cards.card_id = borrows.card_id").
 		Where("borrows.card_id = ?", cardId).
-		Order("borrow_time desc, book_id asc").
+		Order("borrows.borrow_time desc, borrows.book_id asc").
 		Scan(&history.Items).Error
 	if err != nil {
+		logrus.WithError(err).Error("failed to fetch borrow histories")
 		return database.APIResult{
 			Ok:      false,
 			Message: "Failed to fetch borrow histories",
-			Payload: err,
+			Payload: nil,
+			Code:    database.ErrInternal,
 		}
 	}
+	now := time.Now().UnixMilli()
+	for i := range history.Items {
+		history.Items[i].Resolve(now)
+	}
 	history.Count = len(history.Items)
 	return database.APIResult{
 		Ok:      true,
@@ -460,99 +1150,1814 @@ func (s *Server) ShowBorrowHistories(cardId int) database.APIResult {
 	}
 }
 
-// RegisterCard
-// create a new borrow card. do nothing and return failed if
-// the card already exists.
+// SearchBorrows
+// search the borrows of all cards by the conditions, sorted by the column
+// and then by CardID, BookID and BorrowTime in ascending order.
 //
-// Note that card_id should be stored to card after successfully
-// completing this operation.
+// @param conditions query conditions
+// @return query results should be returned by database.APIResult.payload
 //
-// @param card all attributes of the card
-func (s *Server) RegisterCard(card *database.Card) database.APIResult {
-	if card.Type != "T" && card.Type != "S" {
+//	and should be an instance of {@link queries.BorrowQueryResults}
+func (s *Server) SearchBorrows(conditions queries.BorrowQueryConditions) database.APIResult {
+	if err := conditions.Check(); err != nil {
 		return database.APIResult{
 			Ok:      false,
-			Message: "Invalid card type, should be 'T' or 'S'",
+			Message: "Failed to search borrows, " + err.Error(),
 			Payload: nil,
+			Code:    database.ErrInvalidArgument,
 		}
 	}
-	// Create a new borrow card
-	if err := database.DB.Create(card).Error; err != nil {
+	borrows := queries.BorrowQueryResults{
+		Items: make([]queries.BorrowItem, 0),
+	}
+
+	query := database.DB.Model(&database.Borrow{}).
+		Joins("join books on books.book_id = borrows.book_id").
+		Joins("join cards on cards.card_id = borrows.card_id")
+	if conditions.BookId != 0 {
+		query = query.Where("borrows.book_id = ?", conditions.BookId)
+	}
+	if conditions.CardId != 0 {
+		query = query.Where("borrows.card_id = ?", conditions.CardId)
+	}
+	if conditions.Department != "" {
+		query = query.Where("cards.department = ?", conditions.Department)
+	}
+	if conditions.CardType != "" {
+		query = query.Where("cards.type = ?", conditions.CardType)
+	}
+	switch conditions.Status {
+	case queries.Open:
+		query = query.Where("borrows.return_time = 0")
+	case queries.Returned:
+		query = query.Where("borrows.return_time > 0")
+	}
+	if conditions.MinBorrowTime != 0 {
+		query = query.Where("borrows.borrow_time >= ?", conditions.MinBorrowTime)
+	}
+	if conditions.MaxBorrowTime != 0 {
+		query = query.Where("borrows.borrow_time <= ?", conditions.MaxBorrowTime)
+	}
+	if conditions.MinReturnTime != 0 || conditions.MaxReturnTime != 0 {
+		query = query.Where("borrows.return_time > 0")
+	}
+	if conditions.MinReturnTime != 0 {
+		query = query.Where("borrows.return_time >= ?", conditions.MinReturnTime)
+	}
+	if conditions.MaxReturnTime != 0 {
+		query = query.Where("borrows.return_time <= ?", conditions.MaxReturnTime)
+	}
+
+	// Sort by the column of its table, then by the primary key of borrows
+	sortBy, sortOrder := "borrows."+string(queries.BorrowTime), string(queries.Desc)
+	switch conditions.SortBy {
+	case "":
+	case queries.BookTitle:
+		sortBy, sortOrder = "books.title", string(queries.Asc)
+	case queries.CardName:
+		sortBy, sortOrder = "cards.name", string(queries.Asc)
+	default:
+		sortBy, sortOrder = "borrows."+string(conditions.SortBy), string(queries.Asc)
+	}
+	if conditions.SortOrder != "" {
+		sortOrder = string(conditions.SortOrder)
+	}
+	sortCondition := fmt.Sprintf("%s %s, borrows.card_id asc, borrows.book_id asc, borrows.borrow_time asc", sortBy, sortOrder)
+
+	// Count all matching borrows, then fetch the page
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logrus.WithError(err).Error("failed to count borrows")
 		return database.APIResult{
 			Ok:      false,
-			Message: "Failed to register card, maybe the card already exists",
-			Payload: err,
+			Message: "Failed to search borrows",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	page := query.Select(borrowItemColumns).Order(sortCondition)
+	if conditions.Limit > 0 {
+		page = page.Offset(conditions.Offset).Limit(conditions.Limit)
+	}
+	if err := page.Scan(&borrows.Items).Error; err != nil {
+		logrus.WithError(err).Error("failed to search borrows")
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to search borrows",
+			Payload: nil,
+			Code:    database.ErrInternal,
 		}
 	}
+	if conditions.Limit == 0 { // OFFSET needs LIMIT in SQL
+		borrows.Items = borrows.Items[min(conditions.Offset, len(borrows.Items)):]
+	}
+	now := time.Now().UnixMilli()
+	for i := range borrows.Items {
+		borrows.Items[i].Resolve(now)
+	}
+	borrows.Count = len(borrows.Items)
+	borrows.Total = int(total)
 	return database.APIResult{
 		Ok:      true,
-		Message: "Card registered successfully",
-		Payload: card.CardId,
+		Message: "Borrows searched successfully",
+		Payload: borrows,
 	}
 }
 
-// RemoveCard
-// simply remove a card.
+// ShowOverdueBorrows
+// list all borrows that are not returned and past their due time.
+// the returned records should be sorted by dueTime ASC, cardId ASC, bookId ASC
 //
-// Note that if there exists any un-returned books under this user,
-// this card should not be removed.
+// @param now the time to check due times against
+// @return query results should be returned by database.APIResult.payload
 //
-// @param cardId card to be removed
-func (s *Server) RemoveCard(cardId int) database.APIResult {
-	// Check if there exists any un-returned books under this user
-	var count int64
-	database.DB.Model(&database.Borrow{}).Where("card_id = ? and return_time = 0", cardId).Count(&count)
-	if count > 0 {
+//	and should be an instance of {@link queries.OverdueBorrows}
+func (s *Server) ShowOverdueBorrows(now int64) database.APIResult {
+	overdue := queries.OverdueBorrows{
+		Items: make([]queries.OverdueItem, 0),
+	}
+	err := database.DB.Model(&database.Borrow{}).
+		Select("borrows.card_id, cards.name, cards.department, borrows.book_id, books.title, "+
+			"borrows.borrow_time, borrows.due_time").
+		Joins("join cards on cards.card_id = borrows.card_id").
+		Joins("join books on books.book_id = borrows.book_id").
+		Where("borrows.return_time = 0 and borrows.due_time > 0 and borrows.due_time < ?", now).
+		Order("borrows.due_time asc, borrows.card_id asc, borrows.book_id asc").
+		Scan(&overdue.Items).Error
+	if err != nil {
+		logrus.WithError(err).Error("failed to fetch overdue borrows")
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to fetch overdue borrows",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	for i := range overdue.Items {
+		overdue.Items[i].DaysLate = queries.DaysLate(overdue.Items[i].DueTime, now)
+	}
+	overdue.Count = len(overdue.Items)
+	return database.APIResult{
+		Ok:      true,
+		Message: "Overdue borrows fetched successfully",
+		Payload: overdue,
+	}
+}
+
+/* Interface for contributors */
+
+// ModifyContributors
+// replace the contributors of a book. contributors are identified by
+// name and created if not exist. the display string of the authors
+// of the book is updated from the contributors in the author role.
+//
+// @param bookId book's BookID
+// @param contributors the contributors of the book in order
+func (s *Server) ModifyContributors(bookId int, contributors []queries.ContributorItem) database.APIResult {
+	// Check the contributors
+	authors := make([]string, 0)
+	for i, contributor := range contributors {
+		if contributor.Name == "" || !slices.Contains(database.Roles, contributor.Role) {
+			return database.APIResult{
+				Ok:      false,
+				Message: "Invalid Arguments: expect name and role of contributors, role in " + strings.Join(database.Roles, ", "),
+				Payload: nil,
+				Code:    database.ErrInvalidContributor,
+			}
+		}
+		for _, other := range contributors[:i] {
+			if other.Name == contributor.Name && other.Role == contributor.Role {
+				return database.APIResult{
+					Ok:      false,
+					Message: "Invalid Arguments: duplicate contributor " + contributor.Name + " as " + contributor.Role,
+					Payload: nil,
+					Code:    database.ErrInvalidContributor,
+				}
+			}
+		}
+		if contributor.Role == database.RoleAuthor {
+			authors = append(authors, contributor.Name)
+		}
+	}
+
+	err := database.Transaction(func(tx *gorm.DB) error {
+		book := database.Book{}
+		if err := tx.First(&book, bookId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return rejection{database.ErrBookNotFound, "book does not exist"}
+			}
+			return err
+		}
+		if err := tx.Where("book_id = ?", bookId).Delete(&database.Credit{}).Error; err != nil {
+			return err
+		}
+		for i, contributor := range contributors {
+			contributorId, err := database.ContributorId(tx, contributor.Name)
+			if err != nil {
+				return err
+			}
+			credit := database.Credit{BookId: bookId, ContributorId: contributorId, Role: contributor.Role, Position: i}
+			if err := tx.Create(&credit).Error; err != nil {
+				return err
+			}
+		}
+		// Keep the display string within its column
+		if len(authors) == 0 {
+			return nil
+		}
+		author := strings.Join(authors, ", ")
+		if len(author) > 63 {
+			author = authors[0] + " et al."
+		}
+		return tx.Model(&book).Update("author", author).Error
+	})
+
+	var reason rejection
+	if errors.As(err, &reason) {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to modify contributors, " + reason.Error(),
+			Payload: nil,
+			Code:    reason.code,
+		}
+	} else if err != nil {
 		return database.APIResult{
 			Ok:      false,
-			Message: "This user has un-returned books",
+			Message: "Failed to modify contributors, maybe the book already exists with these authors",
 			Payload: nil,
+			Code:    conflict(err, database.ErrDuplicateBook),
 		}
 	}
+	return s.ShowContributors(bookId)
+}
 
-	// Remove the card
-	result := database.DB.Delete(&database.Card{}, cardId)
+// ShowContributors
+// list the contributors of a book in order.
+//
+// @param bookId show which book's contributors
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.ContributorList}
+func (s *Server) ShowContributors(bookId int) database.APIResult {
+	contributors := queries.ContributorList{
+		Contributors: make([]queries.ContributorItem, 0),
+	}
+	result := database.DB.Model(&database.Credit{}).
+		Select("contributors.contributor_id, contributors.name, credits.role").
+		Joins("join contributors on contributors.contributor_id = credits.contributor_id").
+		Where("credits.book_id = ?", bookId).
+		Order("credits.position asc, credits.role asc, contributors.name asc").
+		Scan(&contributors.Contributors)
 	if result.Error != nil {
+		logrus.WithError(result.Error).Error("failed to fetch contributors")
 		return database.APIResult{
 			Ok:      false,
-			Message: "Failed to remove card",
-			Payload: result.Error,
+			Message: "Failed to fetch contributors",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	contributors.Count = int(result.RowsAffected)
+	return database.APIResult{
+		Ok:      true,
+		Message: "Contributors fetched successfully",
+		Payload: contributors,
+	}
+}
+
+/* Interface for copies */
+
+// AddCopy
+// add a copy of a book. a barcode is generated if it is empty.
+// the copy is set aside for a waiting hold or put to stock.
+//
+// Note that CopyID should be stored to copy after successfully
+// completing this operation.
+//
+// @param copy all attributes of the copy
+func (s *Server) AddCopy(copy *database.Copy) database.APIResult {
+	copy.CopyId = 0
+	copy.Status = database.CopyAvailable
+	barcode := copy.Barcode
+	err := database.Transaction(func(tx *gorm.DB) error {
+		copy.CopyId, copy.Barcode = 0, barcode // set by an aborted attempt
+		// Lock the book, so that concurrent adds do not number their copies the same
+		book := database.Book{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&book, copy.BookId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return rejection{database.ErrBookNotFound, "book does not exist"}
+			}
+			return err
+		}
+		if copy.Barcode == "" {
+			var count int64
+			if err := tx.Model(&database.Copy{}).Where("book_id = ?", copy.BookId).Count(&count).Error; err != nil {
+				return err
+			}
+			copy.Barcode = database.CopyBarcode(copy.BookId, int(count)+1)
+		}
+		if err := tx.Create(copy).Error; err != nil {
+			return err
+		}
+		return serveHolds(tx, copy.BookId, time.Now().UnixMilli())
+	})
+
+	var reason rejection
+	if errors.As(err, &reason) {
+		copy.CopyId = 0
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to add copy, " + reason.Error(),
+			Payload: nil,
+			Code:    reason.code,
 		}
-	} else if result.RowsAffected == 0 {
+	} else if err != nil {
+		copy.CopyId = 0
 		return database.APIResult{
 			Ok:      false,
-			Message: "This card does not exist, maybe it was already removed",
+			Message: "Failed to add copy, maybe the barcode already exists",
 			Payload: nil,
+			Code:    conflict(err, database.ErrDuplicateBarcode),
 		}
 	}
 	return database.APIResult{
 		Ok:      true,
-		Message: "Card removed successfully",
-		Payload: nil,
+		Message: "Copy added successfully",
+		Payload: copy,
 	}
 }
 
-// ShowCards
-// list all cards order by card_id.
+// ModifyCopy
+// modify the barcode, location, condition or status of a copy by CopyID.
+//
+// Note that the status of a copy on loan or on hold cannot be modified,
+// and the status can only be modified to available, lost, in repair
+// or withdrawn.
+//
+// @param copy the copy to be modified, empty attributes are not modified
+func (s *Server) ModifyCopy(copy *database.Copy) database.APIResult {
+	modified := database.Copy{}
+	err := database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&modified, copy.CopyId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return rejection{database.ErrCopyNotFound, "copy does not exist"}
+			}
+			return err
+		}
+		if copy.Status != "" && copy.Status != modified.Status {
+			switch copy.Status {
+			case database.CopyAvailable, database.CopyLost, database.CopyInRepair, database.CopyWithdrawn:
+			default:
+				return rejection{database.ErrInvalidStatus, "invalid status " + copy.Status}
+			}
+			if modified.Status == database.CopyOnLoan || modified.Status == database.CopyOnHold {
+				return rejection{database.ErrCopyUnavailable, "copy is " + modified.Status}
+			}
+		}
+		if err := tx.Model(&modified).
+			Select("barcode", "location", "copy_condition", "status").
+			Updates(database.Copy{
+				Barcode:   cmp.Or(copy.Barcode, modified.Barcode),
+				Location:  cmp.Or(copy.Location, modified.Location),
+				Condition: cmp.Or(copy.Condition, modified.Condition),
+				Status:    cmp.Or(copy.Status, modified.Status),
+			}).Error; err != nil {
+			return err
+		}
+		// A copy back from repair may be set aside for a waiting hold
+		if err := serveHolds(tx, modified.BookId, time.Now().UnixMilli()); err != nil {
+			return err
+		}
+		return tx.First(&modified, copy.CopyId).Error
+	})
+
+	var reason rejection
+	if errors.As(err, &reason) {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to modify copy, " + reason.Error(),
+			Payload: nil,
+			Code:    reason.code,
+		}
+	} else if err != nil {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to modify copy, maybe the barcode already exists",
+			Payload: nil,
+			Code:    conflict(err, database.ErrDuplicateBarcode),
+		}
+	}
+	return database.APIResult{
+		Ok:      true,
+		Message: "Copy modified successfully",
+		Payload: modified,
+	}
+}
+
+// ShowCopies
+// list all copies of a book order by copy_id, or the copy with
+// the barcode if bookId is 0.
 //
+// @param bookId show which book's copies
+// @param barcode show the copy with which barcode
 // @return query results should be returned by database.APIResult.payload
 //
-//	and should be an instance of {@link queries.CardList}
-func (s *Server) ShowCards() database.APIResult {
-	cards := queries.CardList{}
-	result := database.DB.Order("card_id asc").Find(&cards.Cards)
+//	and should be an instance of {@link queries.CopyList}
+func (s *Server) ShowCopies(bookId int, barcode string) database.APIResult {
+	copies := queries.CopyList{
+		Copies: make([]database.Copy, 0),
+	}
+	query := database.DB.Order("copy_id asc")
+	if bookId != 0 {
+		query = query.Where("book_id = ?", bookId)
+	} else {
+		query = query.Where("barcode = ?", barcode)
+	}
+	result := query.Find(&copies.Copies)
 	if result.Error != nil {
+		logrus.WithError(result.Error).Error("failed to fetch copies")
 		return database.APIResult{
 			Ok:      false,
-			Message: "Failed to fetch cards",
-			Payload: result.Error,
+			Message: "Failed to fetch copies",
+			Payload: nil,
+			Code:    database.ErrInternal,
 		}
 	}
-	cards.Count = int(result.RowsAffected)
+	copies.Count = int(result.RowsAffected)
 	return database.APIResult{
 		Ok:      true,
-		Message: "Cards fetched successfully",
-		Payload: cards,
+		Message: "Copies fetched successfully",
+		Payload: copies,
+	}
+}
+
+// newCopies returns n available copies of a book numbered after the first existing ones
+func newCopies(bookId int, existing int, n int) []database.Copy {
+	copies := make([]database.Copy, 0, n)
+	for i := 1; i <= n; i++ {
+		copies = append(copies, database.Copy{
+			BookId:  bookId,
+			Barcode: database.CopyBarcode(bookId, existing+i),
+			Status:  database.CopyAvailable,
+		})
+	}
+	return copies
+}
+
+// addCopies creates n available copies of a book with generated barcodes
+func addCopies(tx *gorm.DB, bookId int, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	// Lock the book, so that concurrent adds do not number their copies the same
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("book_id").First(&database.Book{}, bookId).Error; err != nil {
+		return err
+	}
+	var count int64
+	if err := tx.Model(&database.Copy{}).Where("book_id = ?", bookId).Count(&count).Error; err != nil {
+		return err
+	}
+	copies := newCopies(bookId, int(count), n)
+	return tx.CreateInBatches(&copies, 500).Error
+}
+
+// syncStock sets the stock of a book to the number of its available copies
+func syncStock(tx *gorm.DB, bookId int) error {
+	available := tx.Session(&gorm.Session{NewDB: true}).
+		Model(&database.Copy{}).
+		Select("count(*)").
+		Where("book_id = ? and status = ?", bookId, database.CopyAvailable)
+	return tx.Model(&database.Book{}).
+		Where("book_id = ?", bookId).
+		Update("stock", available).Error
+}
+
+/* Interface for holds */
+
+// PlaceHold
+//
+// a user places a hold on a book that is out of stock.
+// the hold will success iff the book is out of stock &
+// the user has not borrowed the book & the user has no
+// waiting or ready hold on the book.
+//
+// @param hold information, include card & book's id & hold time
+//
+// @return the placed hold should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.HoldItem}
+func (s *Server) PlaceHold(hold database.Hold) database.APIResult {
+	hold.Status = database.HoldWaiting
+	hold.ReadyTime = 0
+	hold.ExpireTime = 0
+	opts := sql.TxOptions{
+		Isolation: sql.LevelSerializable,
+		ReadOnly:  false,
+	}
+	item := queries.HoldItem{}
+	err := database.Transaction(func(tx *gorm.DB) error {
+		card := database.Card{}
+		if err := tx.First(&card, hold.CardId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return rejection{database.ErrCardNotFound, "card does not exist"}
+			}
+			return err
+		}
+		if err := expireHolds(tx, hold.BookId, time.Now().UnixMilli()); err != nil {
+			return err
+		}
+		book := database.Book{}
+		if err := tx.First(&book, hold.BookId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return rejection{database.ErrBookNotFound, "book does not exist"}
+			}
+			return err
+		}
+		if book.Stock > 0 {
+			return rejection{database.ErrBookInStock, "book is in stock, borrow it instead"}
+		}
+
+		var count int64
+		if err := tx.Model(&database.Borrow{}).
+			Where("card_id = ? and book_id = ? and return_time = 0", hold.CardId, hold.BookId).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return rejection{database.ErrAlreadyBorrowed, "user has not returned the book"}
+		}
+		count = 0
+		if err := tx.Model(&database.Hold{}).
+			Where("card_id = ? and book_id = ? and status in ?", hold.CardId, hold.BookId,
+				[]string{database.HoldWaiting, database.HoldReady}).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return rejection{database.ErrAlreadyOnHold, "user already has a hold on the book"}
+		}
+
+		if err := tx.Omit(clause.Associations).Create(&hold).Error; err != nil {
+			return err
+		}
+		return holdItems(tx).
+			Where("holds.card_id = ? and holds.book_id = ? and holds.hold_time = ?", hold.CardId, hold.BookId, hold.HoldTime).
+			Take(&item).Error
+	}, &opts)
+
+	var reason rejection
+	if errors.As(err, &reason) {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to place hold, " + reason.Error(),
+			Payload: nil,
+			Code:    reason.code,
+		}
+	} else if err != nil {
+		logrus.WithError(err).Error("failed to place hold")
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to place hold",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	return database.APIResult{
+		Ok:      true,
+		Message: "Hold placed successfully",
+		Payload: item,
+	}
+}
+
+// CancelHold
+//
+// a user cancels the waiting or ready hold on a book.
+// a copy set aside for the hold goes to the next hold in
+// the queue, or back to stock.
+//
+// @param hold information, include card & book's id
+func (s *Server) CancelHold(hold database.Hold) database.APIResult {
+	err := database.Transaction(func(tx *gorm.DB) error {
+		active := database.Hold{}
+		err := tx.Where("card_id = ? and book_id = ? and status in ?", hold.CardId, hold.BookId,
+			[]string{database.HoldWaiting, database.HoldReady}).
+			Take(&active).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return rejection{database.ErrHoldNotFound, "no waiting or ready hold found"}
+		} else if err != nil {
+			return err
+		}
+		if err := tx.Model(&database.Hold{}).
+			Where("card_id = ? and book_id = ? and hold_time = ?", active.CardId, active.BookId, active.HoldTime).
+			Update("status", database.HoldCancelled).Error; err != nil {
+			return err
+		}
+		if active.Status == database.HoldReady {
+			return releaseCopy(tx, active.BookId, active.CopyId, time.Now().UnixMilli())
+		}
+		return nil
+	})
+
+	var reason rejection
+	if errors.As(err, &reason) {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to cancel hold, " + reason.Error(),
+			Payload: nil,
+			Code:    reason.code,
+		}
+	} else if err != nil {
+		logrus.WithError(err).Error("failed to cancel hold")
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to cancel hold",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	return database.APIResult{
+		Ok:      true,
+		Message: "Hold cancelled successfully",
+		Payload: nil,
+	}
+}
+
+// ShowHolds
+// list the holds of a card, or the holds on a book if cardId is 0.
+// the returned records should be sorted by holdTime ASC, bookId ASC, cardId ASC
+//
+// @param cardId show which card's holds
+// @param bookId show holds on which book
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.HoldList}
+func (s *Server) ShowHolds(cardId int, bookId int) database.APIResult {
+	holds := queries.HoldList{
+		Items: make([]queries.HoldItem, 0),
+	}
+	err := database.Transaction(func(tx *gorm.DB) error {
+		if err := expireHolds(tx, bookId, time.Now().UnixMilli()); err != nil {
+			return err
+		}
+		query := holdItems(tx)
+		if cardId != 0 {
+			query = query.Where("holds.card_id = ?", cardId)
+		}
+		if bookId != 0 {
+			query = query.Where("holds.book_id = ?", bookId)
+		}
+		return query.Order("holds.hold_time asc, holds.book_id asc, holds.card_id asc").
+			Scan(&holds.Items).Error
+	})
+	if err != nil {
+		logrus.WithError(err).Error("failed to fetch holds")
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to fetch holds",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	holds.Count = len(holds.Items)
+	return database.APIResult{
+		Ok:      true,
+		Message: "Holds fetched successfully",
+		Payload: holds,
+	}
+}
+
+// holdItems selects holds with the book title and the position of waiting holds in the queue
+func holdItems(tx *gorm.DB) *gorm.DB {
+	return tx.Model(&database.Hold{}).
+		Select("holds.*, books.title, (case when holds.status = ? then "+
+			"(select count(*) from holds queue where queue.book_id = holds.book_id and queue.status = ? and "+
+			"(queue.hold_time < holds.hold_time or (queue.hold_time = holds.hold_time and queue.card_id <= holds.card_id))) "+
+			"else 0 end) as position", database.HoldWaiting, database.HoldWaiting).
+		Joins("join books on books.book_id = holds.book_id")
+}
+
+// serveHolds sets available copies of a book aside for the oldest waiting holds,
+// and updates the stock of the book
+func serveHolds(tx *gorm.DB, bookId int, at int64) error {
+	holds := make([]database.Hold, 0)
+	if err := tx.Where("book_id = ? and status = ?", bookId, database.HoldWaiting).
+		Order("hold_time asc, card_id asc").
+		Find(&holds).Error; err != nil {
+		return err
+	}
+	copies := make([]database.Copy, 0)
+	if len(holds) > 0 {
+		if err := tx.Where("book_id = ? and status = ?", bookId, database.CopyAvailable).
+			Order("copy_id asc").
+			Limit(len(holds)).
+			Find(&copies).Error; err != nil {
+			return err
+		}
+	}
+	for i, item := range copies {
+		hold := holds[i]
+		if err := tx.Model(&database.Hold{}).
+			Where("card_id = ? and book_id = ? and hold_time = ?", hold.CardId, hold.BookId, hold.HoldTime).
+			Updates(map[string]interface{}{
+				"status":      database.HoldReady,
+				"ready_time":  at,
+				"expire_time": at + Policy.PickupWindow().Milliseconds(),
+				"copy_id":     item.CopyId,
+			}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&database.Copy{}).
+			Where("copy_id = ?", item.CopyId).
+			Update("status", database.CopyOnHold).Error; err != nil {
+			return err
+		}
+	}
+	return syncStock(tx, bookId)
+}
+
+// releaseCopy sets a copy of a book aside for the next waiting hold, or puts it back to stock
+func releaseCopy(tx *gorm.DB, bookId int, copyId int, at int64) error {
+	if err := tx.Model(&database.Copy{}).
+		Where("copy_id = ?", copyId).
+		Update("status", database.CopyAvailable).Error; err != nil {
+		return err
+	}
+	return serveHolds(tx, bookId, at)
+}
+
+// expireHolds expires the ready holds of a book (or of all books if bookId is 0)
+// that were not picked up before now, and releases their copies
+func expireHolds(tx *gorm.DB, bookId int, now int64) error {
+	holds := make([]database.Hold, 0)
+	query := tx.Where("status = ? and expire_time < ?", database.HoldReady, now)
+	if bookId != 0 {
+		query = query.Where("book_id = ?", bookId)
+	}
+	if err := query.Order("expire_time asc").Find(&holds).Error; err != nil {
+		return err
+	}
+	for _, hold := range holds {
+		if err := tx.Model(&database.Hold{}).
+			Where("card_id = ? and book_id = ? and hold_time = ?", hold.CardId, hold.BookId, hold.HoldTime).
+			Update("status", database.HoldExpired).Error; err != nil {
+			return err
+		}
+		if err := releaseCopy(tx, hold.BookId, hold.CopyId, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* Interface for fines */
+
+// ShowFines
+// list all fines and the ledger of payments and waivers of a card.
+// fines should be sorted by createTime ASC, fineId ASC, and the ledger
+// should be sorted by time ASC, ledgerId ASC
+//
+// @param cardId show which card's fines
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.FineList}
+func (s *Server) ShowFines(cardId int) database.APIResult {
+	fines := queries.FineList{
+		Fines:  make([]database.Fine, 0),
+		Ledger: make([]database.Ledger, 0),
+	}
+	err := database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("card_id = ?", cardId).
+			Order("create_time asc, fine_id asc").
+			Find(&fines.Fines).Error; err != nil {
+			return err
+		}
+		return tx.Where("card_id = ?", cardId).
+			Order("time asc, ledger_id asc").
+			Find(&fines.Ledger).Error
+	})
+	if err != nil {
+		logrus.WithError(err).Error("failed to fetch fines")
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to fetch fines",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	for _, fine := range fines.Fines {
+		fines.Balance += fine.Outstanding()
+	}
+	fines.Balance = math.Round(fines.Balance*100) / 100
+	fines.Count = len(fines.Fines)
+	return database.APIResult{
+		Ok:      true,
+		Message: "Fines fetched successfully",
+		Payload: fines,
+	}
+}
+
+// PayFine
+// pay the fines of a card. the payment settles the fine
+// with FineId, or the oldest unpaid fines if FineId is 0.
+// the payment should not exceed the unpaid amount.
+//
+// @param payment information, include card & amount & time,
+// and optionally the fine's id
+//
+// @return the ledger entries recorded should be returned by
+// database.APIResult.payload
+func (s *Server) PayFine(payment database.Ledger) database.APIResult {
+	payment.Kind = database.LedgerPayment
+	return settleFines(payment, "Failed to pay fine", "Fine paid successfully")
+}
+
+// WaiveFine
+// waive (a part of) the fine with FineId. the whole unpaid
+// amount is waived if the amount is 0.
+//
+// @param waiver information, include fine's id & amount & time & note
+//
+// @return the ledger entries recorded should be returned by
+// database.APIResult.payload
+func (s *Server) WaiveFine(waiver database.Ledger) database.APIResult {
+	waiver.Kind = database.LedgerWaiver
+	if waiver.FineId == 0 {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to waive fine, fine_id is required",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		}
+	}
+	return settleFines(waiver, "Failed to waive fine", "Fine waived successfully")
+}
+
+// settleFines records a payment or a waiver in the ledger and settles the fines it covers
+func settleFines(entry database.Ledger, failure string, success string) database.APIResult {
+	entry.Amount = math.Round(entry.Amount*100) / 100
+	if entry.Amount < 0 || (entry.Amount == 0 && entry.Kind == database.LedgerPayment) {
+		return database.APIResult{
+			Ok:      false,
+			Message: failure + ", amount should be positive",
+			Payload: nil,
+			Code:    database.ErrInvalidAmount,
+		}
+	}
+	// Serializable, so that concurrent payments cannot both settle the same balance
+	opts := sql.TxOptions{
+		Isolation: sql.LevelSerializable,
+		ReadOnly:  false,
+	}
+	ledger := make([]database.Ledger, 0)
+	err := database.Transaction(func(tx *gorm.DB) error {
+		ledger = ledger[:0] // recorded by an aborted attempt
+		fines := make([]database.Fine, 0)
+		query := tx.Where("amount > settled")
+		if entry.FineId != 0 {
+			query = query.Where("fine_id = ?", entry.FineId)
+		} else {
+			query = query.Where("card_id = ?", entry.CardId)
+		}
+		if err := query.Order("create_time asc, fine_id asc").Find(&fines).Error; err != nil {
+			return err
+		}
+		if len(fines) == 0 {
+			return rejection{database.ErrFineNotFound, "no unpaid fine found"}
+		}
+		if entry.CardId != 0 && fines[0].CardId != entry.CardId {
+			return rejection{database.ErrFineOfOtherCard, "the fine is charged to another card"}
+		}
+
+		var balance float64
+		for _, fine := range fines {
+			balance += fine.Outstanding()
+		}
+		remaining := entry.Amount
+		if remaining == 0 {
+			remaining = balance
+		} else if remaining > math.Round(balance*100)/100 {
+			return rejection{database.ErrInvalidAmount, fmt.Sprintf("amount exceeds the unpaid %.2f", balance)}
+		}
+
+		for _, fine := range fines {
+			if remaining <= 0 {
+				break
+			}
+			part := min(fine.Outstanding(), remaining)
+			remaining = math.Round((remaining-part)*100) / 100
+			if err := tx.Model(&database.Fine{}).
+				Where("fine_id = ?", fine.FineId).
+				Update("settled", gorm.Expr("settled + ?", part)).Error; err != nil {
+				return err
+			}
+			record := database.Ledger{
+				FineId: fine.FineId,
+				CardId: fine.CardId,
+				Kind:   entry.Kind,
+				Amount: part,
+				Time:   entry.Time,
+				Note:   entry.Note,
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+			ledger = append(ledger, record)
+		}
+		return nil
+	}, &opts)
+
+	var reason rejection
+	if errors.As(err, &reason) {
+		return database.APIResult{
+			Ok:      false,
+			Message: failure + ", " + reason.Error(),
+			Payload: nil,
+			Code:    reason.code,
+		}
+	} else if err != nil {
+		logrus.WithError(err).Error(failure)
+		return database.APIResult{
+			Ok:      false,
+			Message: failure,
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	return database.APIResult{
+		Ok:      true,
+		Message: success,
+		Payload: ledger,
+	}
+}
+
+// unpaidFines returns the amount of fines of a card not paid or waived yet
+func unpaidFines(tx *gorm.DB, cardId int) (float64, error) {
+	var balance float64
+	err := tx.Model(&database.Fine{}).
+		Select("coalesce(sum(amount - settled), 0)").
+		Where("card_id = ?", cardId).
+		Row().Scan(&balance)
+	return math.Round(balance*100) / 100, err
+}
+
+// RegisterCard
+// create a new borrow card. do nothing and return failed if
+// the card already exists.
+//
+// Note that card_id should be stored to card after successfully
+// completing this operation.
+//
+// @param card all attributes of the card
+func (s *Server) RegisterCard(card *database.Card) database.APIResult {
+	if card.Type != "T" && card.Type != "S" {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Invalid card type, should be 'T' or 'S'",
+			Payload: nil,
+			Code:    database.ErrInvalidCardType,
+		}
+	}
+	// Create a new borrow card
+	if err := database.DB.Create(card).Error; err != nil {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to register card, maybe the card already exists",
+			Payload: nil,
+			Code:    conflict(err, database.ErrDuplicateCard),
+		}
+	}
+	return database.APIResult{
+		Ok:      true,
+		Message: "Card registered successfully",
+		Payload: card.CardId,
+	}
+}
+
+// RemoveCard
+// simply remove a card.
+//
+// Note that if there exists any un-returned books or unpaid fines
+// under this user, this card should not be removed.
+//
+// @param cardId card to be removed
+func (s *Server) RemoveCard(cardId int) database.APIResult {
+	// Serializable, so that the card does not borrow between the checks and the removal,
+	// which would remove the borrow along with the card
+	opts := sql.TxOptions{
+		Isolation: sql.LevelSerializable,
+		ReadOnly:  false,
+	}
+	err := database.Transaction(func(tx *gorm.DB) error {
+		// Check if there exists any un-returned books under this user
+		var count int64
+		if err := tx.Model(&database.Borrow{}).Where("card_id = ? and return_time = 0", cardId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return rejection{database.ErrCardHasLoans, "this user has un-returned books"}
+		}
+		// Check if there exists any unpaid fines under this user
+		if balance, err := unpaidFines(tx, cardId); err != nil {
+			return err
+		} else if balance > 0 {
+			return rejection{database.ErrCardHasFines, "this user has unpaid fines"}
+		}
+
+		// Remove the card, copies set aside for its holds go to the next in queue
+		holds := make([]database.Hold, 0)
+		if err := tx.Where("card_id = ? and status = ?", cardId, database.HoldReady).Find(&holds).Error; err != nil {
+			return err
+		}
+		for _, hold := range holds {
+			if err := tx.Model(&database.Hold{}).
+				Where("card_id = ? and book_id = ? and hold_time = ?", hold.CardId, hold.BookId, hold.HoldTime).
+				Update("status", database.HoldCancelled).Error; err != nil {
+				return err
+			}
+			if err := releaseCopy(tx, hold.BookId, hold.CopyId, time.Now().UnixMilli()); err != nil {
+				return err
+			}
+		}
+		result := tx.Delete(&database.Card{}, cardId)
+		if result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 {
+			return rejection{database.ErrCardNotFound, "this card does not exist, maybe it was already removed"}
+		}
+		return nil
+	}, &opts)
+
+	var reason rejection
+	if errors.As(err, &reason) {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to remove card, " + reason.Error(),
+			Payload: nil,
+			Code:    reason.code,
+		}
+	} else if err != nil {
+		logrus.WithError(err).Error("failed to remove card")
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to remove card",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	return database.APIResult{
+		Ok:      true,
+		Message: "Card removed successfully",
+		Payload: nil,
+	}
+}
+
+// ShowCards
+// list all cards order by card_id.
+//
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.CardList}
+func (s *Server) ShowCards() database.APIResult {
+	cards := queries.CardList{}
+	result := database.DB.Order("card_id asc").Find(&cards.Cards)
+	if result.Error != nil {
+		logrus.WithError(result.Error).Error("failed to fetch cards")
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to fetch cards",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	cards.Count = int(result.RowsAffected)
+	return database.APIResult{
+		Ok:      true,
+		Message: "Cards fetched successfully",
+		Payload: cards,
+	}
+}
+
+/* Interface for accounts */
+
+// Login
+// check the password of an account, and issue a token of it.
+//
+// @param username username of the account
+// @param password password of the account
+//
+// @return the token should be returned by database.APIResult.payload
+// as {@link queries.Session}
+func (s *Server) Login(username string, password string) database.APIResult {
+	account := database.Account{}
+	result := database.DB.Where("username = ?", username).Limit(1).Find(&account)
+	if result.Error != nil {
+		logrus.WithError(result.Error).Error("failed to log in")
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to log in",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	// Fail in the same way, and as slowly, whether the username or the password is wrong
+	hash := account.PasswordHash
+	if result.RowsAffected == 0 {
+		hash = auth.DummyHash
+	}
+	if !auth.CheckPassword(hash, password) || result.RowsAffected == 0 {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to log in, wrong username or password",
+			Payload: nil,
+			Code:    database.ErrUnauthorized,
+		}
+	}
+	token, claims := Auth.Sign(auth.Claims{
+		AccountId: account.AccountId,
+		Username:  account.Username,
+		Role:      account.Role,
+		CardId:    account.CardId,
+	}, time.Now())
+	return database.APIResult{
+		Ok:      true,
+		Message: "Logged in successfully",
+		Payload: queries.Session{
+			Token:     token,
+			ExpiresAt: claims.ExpiresAt * 1000,
+			Account:   account,
+		},
+	}
+}
+
+// RegisterAccount
+// create an account of a staff member, or of a patron with a card.
+//
+// Note that AccountID should be stored to account after successfully
+// completing this operation, and the password is not kept.
+//
+// @param account the username, password, role and the card of a patron
+func (s *Server) RegisterAccount(account *database.Account) database.APIResult {
+	invalid := func(reason string) database.APIResult {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to register account, " + reason,
+			Payload: nil,
+			Code:    database.ErrInvalidAccount,
+		}
+	}
+	if account.Username == "" {
+		return invalid("username is required")
+	} else if len(account.Password) < auth.MinPasswordLength {
+		return invalid(fmt.Sprintf("password should have at least %d characters", auth.MinPasswordLength))
+	} else if !slices.Contains(database.AccountRoles, account.Role) {
+		return invalid("role should be one of " + strings.Join(database.AccountRoles, ", "))
+	} else if account.Role == database.AccountPatron && account.CardId == 0 {
+		return invalid("card_id is required for a patron")
+	} else if account.Role != database.AccountPatron && account.CardId != 0 {
+		return invalid("card_id is only for a patron")
+	}
+	if account.CardId != 0 {
+		var count int64
+		database.DB.Model(&database.Card{}).Where("card_id = ?", account.CardId).Count(&count)
+		if count == 0 {
+			return database.APIResult{
+				Ok:      false,
+				Message: "Failed to register account, card does not exist",
+				Payload: nil,
+				Code:    database.ErrCardNotFound,
+			}
+		}
+	}
+
+	hash, err := auth.HashPassword(account.Password)
+	if err != nil {
+		logrus.WithError(err).Error("failed to hash password")
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to register account",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	account.Password, account.PasswordHash = "", hash
+	if err := database.DB.Create(account).Error; err != nil {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to register account, maybe the username already exists",
+			Payload: nil,
+			Code:    conflict(err, database.ErrDuplicateAccount),
+		}
+	}
+	return database.APIResult{
+		Ok:      true,
+		Message: "Account registered successfully",
+		Payload: account.AccountId,
+	}
+}
+
+// RemoveAccount
+// remove an account, except the last admin.
+//
+// @param accountId account to be removed
+func (s *Server) RemoveAccount(accountId int) database.APIResult {
+	err := database.Transaction(func(tx *gorm.DB) error {
+		account := database.Account{}
+		if err := tx.Take(&account, accountId).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return rejection{database.ErrAccountNotFound, "account does not exist"}
+		} else if err != nil {
+			return err
+		}
+		if account.Role == database.AccountAdmin {
+			var admins int64
+			if err := tx.Model(&database.Account{}).Where("role = ?", database.AccountAdmin).Count(&admins).Error; err != nil {
+				return err
+			}
+			if admins <= 1 {
+				return rejection{database.ErrLastAdmin, "the library needs at least one admin"}
+			}
+		}
+		return tx.Delete(&account).Error
+	})
+
+	var reason rejection
+	if errors.As(err, &reason) {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to remove account, " + reason.Error(),
+			Payload: nil,
+			Code:    reason.code,
+		}
+	} else if err != nil {
+		logrus.WithError(err).Error("failed to remove account")
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to remove account",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	return database.APIResult{
+		Ok:      true,
+		Message: "Account removed successfully",
+		Payload: nil,
+	}
+}
+
+// ShowAccounts
+// list all accounts order by account_id.
+//
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.AccountList}
+func (s *Server) ShowAccounts() database.APIResult {
+	accounts := queries.AccountList{}
+	result := database.DB.Order("account_id asc").Find(&accounts.Accounts)
+	if result.Error != nil {
+		logrus.WithError(result.Error).Error("failed to fetch accounts")
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to fetch accounts",
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	accounts.Count = int(result.RowsAffected)
+	return database.APIResult{
+		Ok:      true,
+		Message: "Accounts fetched successfully",
+		Payload: accounts,
+	}
+}
+
+/* Interface for import */
+
+// ImportBooks
+// import books from CSV with a header, see {@link csvio.BookColumns}.
+// each valid row is stored as {@link StoreBook} does, in a savepoint of
+// one transaction, so that a row conflicting with the library or with
+// a previous row is reported by its line. nothing is imported if any
+// row fails in AllOrNothing mode, and a dry run always rolls back.
+//
+// @param r the CSV
+// @param options the mode, dry run and mapping of the header
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.ImportResult}
+func (s *Server) ImportBooks(r io.Reader, options queries.ImportOptions) database.APIResult {
+	reader, err := csvio.NewBookReader(r, options.Columns)
+	return importRows("books", reader, err, options, func(row csvio.Row) (func(tx *gorm.DB) error, error) {
+		book, err := row.Book()
+		if err != nil {
+			return nil, err
+		}
+		return func(tx *gorm.DB) error {
+			return storeNewBook(tx, book)
+		}, nil
+	})
+}
+
+// storeNewBook stores the book as {@link storeBook}, rejecting it if it or its ISBN
+// already exists, as StoreBook tells, but against the previous books of the transaction as well
+func storeNewBook(tx *gorm.DB, book *database.Book) error {
+	book.BookId = 0 // set by an aborted attempt
+	err := storeBook(tx, book)
+	if !errors.Is(err, gorm.ErrDuplicatedKey) {
+		return err
+	}
+	if bookConflict(tx, err, book) == database.ErrDuplicateISBN {
+		return rejection{database.ErrDuplicateISBN, "a book with ISBN " + book.ISBN + " already exists"}
+	}
+	return rejection{database.ErrDuplicateBook, "the book already exists"}
+}
+
+// ImportCards
+// import cards from CSV with a header, see {@link csvio.CardColumns},
+// as {@link ImportBooks}.
+//
+// @param r the CSV
+// @param options the mode, dry run and mapping of the header
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.ImportResult}
+func (s *Server) ImportCards(r io.Reader, options queries.ImportOptions) database.APIResult {
+	reader, err := csvio.NewCardReader(r, options.Columns)
+	return importRows("cards", reader, err, options, func(row csvio.Row) (func(tx *gorm.DB) error, error) {
+		card, err := row.Card()
+		if err != nil {
+			return nil, err
+		}
+		return func(tx *gorm.DB) error {
+			card.CardId = 0 // set by an aborted attempt
+			err := tx.Create(card).Error
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return rejection{database.ErrDuplicateCard, "the card already exists"}
+			}
+			return err
+		}, nil
+	})
+}
+
+// importRows parses the rows of the reader, which failed to read the header with err if not nil,
+// then stores the valid rows in a transaction, each in a savepoint, see {@link ImportBooks}.
+// parse returns how to store a row, which is rejected if it conflicts with the library.
+func importRows(what string, reader *csvio.Reader, err error, options queries.ImportOptions,
+	parse func(row csvio.Row) (func(tx *gorm.DB) error, error)) database.APIResult {
+	mode := cmp.Or(options.Mode, queries.AllOrNothing)
+	if err == nil && !slices.Contains(queries.ImportModes, mode) {
+		err = errors.New("invalid mode, expect all or best_effort")
+	}
+	if err != nil {
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to import " + what + ", " + err.Error(),
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		}
+	}
+
+	// Parse all rows, and report the invalid ones by line
+	result := queries.ImportResult{
+		Mode:   mode,
+		DryRun: options.DryRun,
+		Errors: make([]queries.RowError, 0),
+	}
+	type parsedRow struct {
+		line  int
+		store func(tx *gorm.DB) error
+	}
+	rows := make([]parsedRow, 0)
+	for {
+		row, line, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil && line == 0 {
+			return database.APIResult{
+				Ok:      false,
+				Message: "Failed to import " + what + ", " + err.Error(),
+				Payload: nil,
+				Code:    database.ErrInvalidArgument,
+			}
+		}
+		result.Rows++
+		if err != nil {
+			result.Errors = append(result.Errors, queries.RowError{Line: line, Message: err.Error(), Code: database.ErrInvalidArgument})
+			continue
+		}
+		store, err := parse(row)
+		if err != nil {
+			result.Errors = append(result.Errors, queries.RowError{Line: line, Message: err.Error(), Code: database.ErrInvalidArgument})
+			continue
+		}
+		rows = append(rows, parsedRow{line, store})
+	}
+
+	// Store the valid rows, each in a savepoint to go on after a conflict,
+	// then roll back if nothing should be imported
+	invalid := len(result.Errors)
+	rollback := errors.New("rolled back")
+	err = database.Transaction(func(tx *gorm.DB) error {
+		result.Errors, result.Valid = result.Errors[:invalid], 0
+		for _, row := range rows {
+			var reason rejection
+			if err := tx.Transaction(row.store); errors.As(err, &reason) {
+				result.Errors = append(result.Errors, queries.RowError{Line: row.line, Message: reason.reason, Code: reason.code})
+				continue
+			} else if err != nil {
+				return err
+			}
+			result.Valid++
+		}
+		if options.DryRun || (mode == queries.AllOrNothing && len(result.Errors) > 0) {
+			return rollback
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, rollback) {
+		logrus.WithError(err).Error("failed to import " + what)
+		return database.APIResult{
+			Ok:      false,
+			Message: "Failed to import " + what,
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}
+	}
+	if err == nil {
+		result.Imported = result.Valid
+	}
+	slices.SortStableFunc(result.Errors, func(a, b queries.RowError) int {
+		return a.Line - b.Line
+	})
+	if mode == queries.AllOrNothing && len(result.Errors) > 0 {
+		return database.APIResult{
+			Ok:      false,
+			Message: fmt.Sprintf("Failed to import %s, %d of %d rows cannot be imported", what, len(result.Errors), result.Rows),
+			Payload: result,
+			Code:    database.ErrInvalidRows,
+		}
+	}
+	message := fmt.Sprintf("%d of %d %s imported successfully", result.Imported, result.Rows, what)
+	if options.DryRun {
+		message = fmt.Sprintf("%d of %d %s can be imported", result.Valid, result.Rows, what)
+	}
+	return database.APIResult{
+		Ok:      true,
+		Message: message,
+		Payload: result,
+	}
+}
+
+// ImportMARC
+// import books from MARC21 records, in ISO 2709 or MARCXML, see {@link marc.Record#Book}
+// for the mapping. the records that cannot be mapped are skipped and reported,
+// and the others are stored by {@link StoreBooks} in one batch. if the batch fails,
+// the record of the first book rejected is reported as well.
+//
+// @param r the records
+// @param options the format and the field of the category
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.MARCImportResult}
+func (s *Server) ImportMARC(r io.Reader, options queries.MARCOptions) database.APIResult {
+	mapping, err := marcMapping(options.CategoryField)
+	if err != nil {
+		return invalidMARC(err)
+	}
+	var reader marc.RecordReader
+	format := cmp.Or(options.Format, queries.ISO2709)
+	switch format {
+	case queries.ISO2709:
+		reader = marc.NewReader(r)
+	case queries.MARCXML:
+		reader = marc.NewXMLReader(r)
+	default:
+		return invalidMARC(errors.New("invalid format, expect marc or marcxml"))
+	}
+
+	// Map the records, skipping those which are malformed or miss a field
+	result := queries.MARCImportResult{
+		Format: format,
+		Errors: make([]queries.RecordError, 0),
+	}
+	books := make([]*database.Book, 0)
+	sources := make([]queries.RecordError, 0) // the record of each book
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil && !errors.Is(err, marc.ErrFormat) {
+			return invalidMARC(err)
+		}
+		result.Records++
+		var book *database.Book
+		if err == nil {
+			book, err = record.Book(mapping)
+		}
+		source := queries.RecordError{Record: result.Records}
+		if record != nil {
+			source.Control = record.Control("001")
+		}
+		if err != nil {
+			source.Message = err.Error()
+			result.Errors = append(result.Errors, source)
+			continue
+		}
+		books = append(books, book)
+		sources = append(sources, source)
+	}
+
+	// Store the books in one batch
+	if len(books) > 0 {
+		if stored := s.StoreBooks(books); !stored.Ok {
+			if i, reason := rejectedBook(books); i >= 0 {
+				sources[i].Message = reason.reason
+				result.Errors = append(result.Errors, sources[i])
+				slices.SortStableFunc(result.Errors, func(a, b queries.RecordError) int {
+					return a.Record - b.Record
+				})
+			}
+			return database.APIResult{
+				Ok:      false,
+				Message: stored.Message,
+				Payload: result,
+				Code:    stored.Code,
+			}
+		}
+	}
+	result.Imported = len(books)
+	return database.APIResult{
+		Ok:      true,
+		Message: fmt.Sprintf("%d of %d records imported successfully", result.Imported, result.Records),
+		Payload: result,
+	}
+}
+
+// rejectedBook stores the books again one by one, as {@link StoreBooks} failed to store them in a batch,
+// and returns the index of the first book rejected and why, or -1 if none is. nothing is stored.
+func rejectedBook(books []*database.Book) (int, rejection) {
+	rejected, reason := -1, rejection{}
+	rollback := errors.New("rolled back")
+	err := database.Transaction(func(tx *gorm.DB) error {
+		rejected = -1
+		for i, book := range books {
+			err := normalizeISBN(book)
+			if err != nil {
+				err = rejection{database.ErrInvalidISBN, err.Error()}
+			} else {
+				err = storeNewBook(tx, book)
+			}
+			if errors.As(err, &reason) {
+				rejected = i
+				break
+			} else if err != nil {
+				return err
+			}
+		}
+		return rollback
+	})
+	if err != nil && !errors.Is(err, rollback) {
+		logrus.WithError(err).Error("failed to find the book rejected from the batch")
+	}
+	for _, book := range books {
+		book.BookId = 0
+	}
+	return rejected, reason
+}
+
+// marcMapping returns the mapping of MARC records with the field of the category if given
+func marcMapping(category string) (marc.Mapping, error) {
+	mapping := MARC
+	if category == "" {
+		return mapping, nil
+	}
+	var err error
+	mapping.Category, err = marc.ParseFieldSpec(category)
+	return mapping, err
+}
+
+func invalidMARC(err error) database.APIResult {
+	return database.APIResult{
+		Ok:      false,
+		Message: "Failed to import records, " + err.Error(),
+		Payload: nil,
+		Code:    database.ErrInvalidArgument,
+	}
+}
+
+/* Interface for reports */
+
+// ReportTopBooks
+// count the loans of each book within the window of the conditions.
+// the returned books should be sorted by loans DESC, bookId ASC
+//
+// @param conditions the window and the number of books
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.TopBooks}
+func (s *Server) ReportTopBooks(conditions queries.ReportConditions) database.APIResult {
+	if err := conditions.Check(); err != nil {
+		return invalidReport(err)
+	}
+	books := queries.TopBooks{
+		Items: make([]queries.BookLoans, 0),
+	}
+	err := loansWithin(conditions).
+		Select("borrows.book_id, books.title, books.author, books.category, count(*) as loans").
+		Joins("join books on books.book_id = borrows.book_id").
+		Group("borrows.book_id, books.title, books.author, books.category").
+		Order("loans desc, borrows.book_id asc").
+		Limit(cmp.Or(conditions.Limit, queries.DefaultTopBooks)).
+		Scan(&books.Items).Error
+	if err != nil {
+		return failedReport(err)
+	}
+	books.Count = len(books.Items)
+	return database.APIResult{
+		Ok:      true,
+		Message: "Report generated successfully",
+		Payload: books,
+	}
+}
+
+// ReportLoansByCategory
+// count the loans within the window of the conditions by the category of the book.
+// the returned categories should be sorted by loans DESC, category ASC
+//
+// @param conditions the window
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.LoansByGroup}
+func (s *Server) ReportLoansByCategory(conditions queries.ReportConditions) database.APIResult {
+	return loansByGroup(conditions, "category", "join books on books.book_id = borrows.book_id", "books.category")
+}
+
+// ReportLoansByDepartment
+// count the loans within the window of the conditions by the department of the card.
+// the returned departments should be sorted by loans DESC, department ASC
+//
+// @param conditions the window
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.LoansByGroup}
+func (s *Server) ReportLoansByDepartment(conditions queries.ReportConditions) database.APIResult {
+	return loansByGroup(conditions, "department", "join cards on cards.card_id = borrows.card_id", "cards.department")
+}
+
+// ReportLoanDuration
+// average the duration of the returned loans borrowed within the window of the conditions
+//
+// @param conditions the window
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.LoanDuration}
+func (s *Server) ReportLoanDuration(conditions queries.ReportConditions) database.APIResult {
+	if err := conditions.Check(); err != nil {
+		return invalidReport(err)
+	}
+	var duration struct {
+		Returned int
+		Average  float64
+	}
+	err := loansWithin(conditions).
+		Select("count(*) as returned, coalesce(avg(borrows.return_time - borrows.borrow_time), 0) as average").
+		Where("borrows.return_time > 0").
+		Scan(&duration).Error
+	if err != nil {
+		return failedReport(err)
+	}
+	average := int64(math.Round(duration.Average))
+	return database.APIResult{
+		Ok:      true,
+		Message: "Report generated successfully",
+		Payload: queries.LoanDuration{
+			Returned:    duration.Returned,
+			Average:     average,
+			AverageDays: math.Round(float64(average)/float64((24*time.Hour).Milliseconds())*100) / 100,
+		},
+	}
+}
+
+// ReportCardActivity
+// count the cards that borrowed books within the window of the conditions
+// as active, and the others as dormant
+//
+// @param conditions the window
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.CardActivity}
+func (s *Server) ReportCardActivity(conditions queries.ReportConditions) database.APIResult {
+	if err := conditions.Check(); err != nil {
+		return invalidReport(err)
+	}
+	var total, active int64
+	if err := database.DB.Model(&database.Card{}).Count(&total).Error; err != nil {
+		return failedReport(err)
+	}
+	if err := loansWithin(conditions).Distinct("borrows.card_id").Count(&active).Error; err != nil {
+		return failedReport(err)
+	}
+	return database.APIResult{
+		Ok:      true,
+		Message: "Report generated successfully",
+		Payload: queries.CardActivity{
+			Total:   int(total),
+			Active:  int(active),
+			Dormant: int(total - active),
+		},
+	}
+}
+
+// ReportLoanSeries
+// count the loans within the window of the conditions by the period of
+// the interval, from the period of the first loan to the one of the last
+//
+// @param conditions the window and the interval
+// @return query results should be returned by database.APIResult.payload
+//
+//	and should be an instance of {@link queries.LoanSeries}
+func (s *Server) ReportLoanSeries(conditions queries.ReportConditions) database.APIResult {
+	if err := conditions.Check(); err != nil {
+		return invalidReport(err)
+	}
+	// Count by day in SQL, then by the period of the interval
+	var days []struct {
+		Start int64
+		Loans int
+	}
+	err := loansWithin(conditions).
+		Select(fmt.Sprintf("borrows.borrow_time - borrows.borrow_time %% %d as start, count(*) as loans", (24 * time.Hour).Milliseconds())).
+		Group("start").
+		Scan(&days).Error
+	if err != nil {
+		return failedReport(err)
+	}
+	loans := make(map[int64]int, len(days))
+	for _, day := range days {
+		loans[day.Start] = day.Loans
+	}
+	return database.APIResult{
+		Ok:      true,
+		Message: "Report generated successfully",
+		Payload: queries.Series(loans, cmp.Or(conditions.Interval, queries.Daily)),
+	}
+}
+
+// loansWithin returns the borrows within the window of the conditions
+func loansWithin(conditions queries.ReportConditions) *gorm.DB {
+	query := database.DB.Model(&database.Borrow{})
+	if conditions.From != 0 {
+		query = query.Where("borrows.borrow_time >= ?", conditions.From)
+	}
+	if conditions.To != 0 {
+		query = query.Where("borrows.borrow_time <= ?", conditions.To)
+	}
+	return query
+}
+
+// loansByGroup counts the loans within the window of the conditions by the column of the joined table
+func loansByGroup(conditions queries.ReportConditions, groupBy string, join string, column string) database.APIResult {
+	if err := conditions.Check(); err != nil {
+		return invalidReport(err)
+	}
+	loans := queries.LoansByGroup{
+		GroupBy: groupBy,
+		Items:   make([]queries.GroupLoans, 0),
+	}
+	err := loansWithin(conditions).
+		Select(column + " as group_name, count(*) as loans").
+		Joins(join).
+		Group(column).
+		Order("loans desc, " + column + " asc").
+		Scan(&loans.Items).Error
+	if err != nil {
+		return failedReport(err)
+	}
+	loans.Count = len(loans.Items)
+	return database.APIResult{
+		Ok:      true,
+		Message: "Report generated successfully",
+		Payload: loans,
+	}
+}
+
+// invalidReport is the failure of a report with invalid conditions
+func invalidReport(err error) database.APIResult {
+	return database.APIResult{
+		Ok:      false,
+		Message: "Failed to generate report, " + err.Error(),
+		Payload: nil,
+		Code:    database.ErrInvalidArgument,
+	}
+}
+
+// failedReport is the failure of a report failed in the database
+func failedReport(err error) database.APIResult {
+	logrus.WithError(err).Error("failed to generate report")
+	return database.APIResult{
+		Ok:      false,
+		Message: "Failed to generate report",
+		Payload: nil,
+		Code:    database.ErrInternal,
 	}
 }
 
@@ -3,838 +3,1173 @@ package server
 import (
 	"fmt"
 	"library-management-system/database"
+	"library-management-system/server/auth"
+	"library-management-system/server/marc"
+	"library-management-system/server/policy"
 	"library-management-system/server/queries"
 	"library-management-system/utils"
-	"math/rand"
-	"os"
-	"slices"
-	"sort"
+	"library-management-system/utils/apitest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-playground/assert/v2"
-	"gopkg.in/yaml.v3"
 )
 
-type AppConfig struct {
-	Server   Config          `yaml:"server"`
-	Database database.Config `yaml:"database"`
-}
-
 func TestMain(m *testing.M) {
-	file, err := os.Open("../config.yaml")
+	config, cleanup, err := apitest.ConnectDatabase("../config.yaml")
 	if err != nil {
-		fmt.Println("Failed to open config file: ", err)
-		return
-	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			fmt.Println("Failed to close config file: ", err)
-		}
-	}(file)
-
-	var config AppConfig
-	if err := yaml.NewDecoder(file).Decode(&config); err != nil {
-		fmt.Println("Failed to parse config file: ", err)
+		fmt.Println("Failed to connect database: ", err)
 		return
 	}
+	defer cleanup()
 
-	database.ConnectDatabase(config.Database)
+	InitPolicy(config)
+	InitAuth(auth.Config{Secret: "test"})
 	m.Run()
 }
 
+// target is the server under the shared test scenarios
+func target() apitest.Target {
+	return apitest.Target{
+		Server: &Server{},
+		Reset:  database.ResetDatabase,
+		Policy: Policy,
+	}
+}
+
 func TestBookRegister(t *testing.T) {
+	apitest.BookRegister(t, target())
+}
+
+func TestIncBookStock(t *testing.T) {
+	apitest.IncBookStock(t, target())
+}
+
+func TestBulkRegisterBook(t *testing.T) {
+	apitest.BulkRegisterBook(t, target())
+}
+
+func TestRemoveBook(t *testing.T) {
+	apitest.RemoveBook(t, target())
+}
+
+func TestModifyBookInfo(t *testing.T) {
+	apitest.ModifyBookInfo(t, target())
+}
+
+func TestQueryBook(t *testing.T) {
+	apitest.QueryBook(t, target())
+}
+
+func TestISBN(t *testing.T) {
 	server := Server{}
 	database.ResetDatabase()
 
-	b0 := database.Book{
-		Category: "Computer Science", Title: "Database System Concepts",
-		Press: "Machine Industry Press", PublishYear: 2023,
-		Author: "Mike", Price: 188.88, Stock: 10,
+	// ISBN-10 is normalized to ISBN-13, and checksums are validated
+	for isbn, expected := range map[string]string{
+		"0-306-40615-2":     "9780306406157",
+		"978-0-306-40615-7": "9780306406157",
+		"0 8044 2957 x":     "9780804429573",
+		"979-10-90636-07-1": "9791090636071",
+	} {
+		normalized, err := database.NormalizeISBN(isbn)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, normalized, expected)
 	}
-	assert.Equal(t, server.StoreBook(&b0).Ok, true)
-
-	/* Not allowed to create duplicated records */
-	b1 := database.Book{
-		Category: "Computer Science", Title: "Database System Concepts",
-		Press: "Machine Industry Press", PublishYear: 2023,
-		Author: "Mike", Price: 188.88, Stock: 5,
-	}
-	b2 := database.Book{
-		Category: "Computer Science", Title: "Database System Concepts",
-		Press: "Machine Industry Press", PublishYear: 2023,
-		Author: "Mike", Price: 99.99, Stock: 10,
+	for _, isbn := range []string{"0-306-40615-3", "978-0-306-40615-8", "977-0-306-40615-7", "12345", "X306406152"} {
+		_, err := database.NormalizeISBN(isbn)
+		assert.NotEqual(t, err, nil)
 	}
+
+	b0 := utils.RandomBook()
+	b0.ISBN = "0-306-40615-2"
+	assert.Equal(t, server.StoreBook(&b0).Ok, true)
+	assert.Equal(t, b0.ISBN, "9780306406157")
+	b1 := utils.RandomBook()
+	b1.ISBN = "9780306406157"
 	assert.Equal(t, server.StoreBook(&b1).Ok, false)
-	assert.Equal(t, server.StoreBook(&b2).Ok, false)
-
-	/* check equal function */
-	// records all books generated by test case, include duplicate book
-	originBookList := []*database.Book{&b0, &b1, &b2}
-	// records which books should exist in database
-	actualBookList := make(utils.BookSet)
-	actualBookList.InsertPtr(&b0) // b0 already inserted to database
-	// corresponding to originBookList, mark whether a book is duplicated
-	bookValid := []bool{false, false, false} // b0 already inserted to database, so bookValid[0] is false
-	// Check the books
-	for i, book := range originBookList {
-		if actualBookList.Contains(*book) {
-			assert.Equal(t, bookValid[i], false)
-		} else {
-			actualBookList.InsertPtr(book)
-			assert.Equal(t, bookValid[i], true)
-		}
-	}
-	assert.Equal(t, 1, len(actualBookList))
-
-	/* Generate some books */
-	for i := 0; i < 50; i++ {
-		b := utils.RandomBook()
-		originBookList = append(originBookList, &b)
-		if actualBookList.Contains(b) {
-			bookValid = append(bookValid, false)
-		} else {
-			actualBookList.InsertPtr(&b)
-			bookValid = append(bookValid, true)
-		}
-	}
-	assert.Equal(t, len(originBookList), len(bookValid))
-	assert.Equal(t, len(originBookList) > len(actualBookList), true)
-
-	/* generate some duplicate books */
-	for i := 0; i < 10; i++ {
-		dupIndex := rand.Intn(len(originBookList))
-		ob := originBookList[dupIndex]
-		if bookValid[i] {
-			assert.Equal(t, actualBookList.Contains(*ob), true)
-			cb := *ob
-			// randomly change some attributes
-			if rand.Intn(2) == 0 {
-				cb.Stock = utils.RandomStock()
-				cb.Price = utils.RandomPrice()
-			}
-			assert.Equal(t, actualBookList.Contains(cb), true)
-			originBookList = append(originBookList, &cb)
-			bookValid = append(bookValid, false)
+	b1.ISBN = "0-306-40615-3"
+	assert.Equal(t, server.StoreBook(&b1).Ok, false)
+	b1.ISBN = ""
+	assert.Equal(t, server.StoreBook(&b1).Ok, true)
+	b2 := utils.RandomBook()
+	assert.Equal(t, server.StoreBook(&b2).Ok, true)
+
+	// Lookup and query by ISBN
+	result := server.QueryBookByISBN("978-0-306-40615-7")
+	assert.Equal(t, result.Ok, true)
+	assert.Equal(t, result.Payload.(database.Book).BookId, b0.BookId)
+	assert.Equal(t, server.QueryBookByISBN("9780804429573").Ok, false)
+	assert.Equal(t, server.QueryBookByISBN("0-306-40615-3").Ok, false)
+	result = server.QueryBooks(queries.BookQueryConditions{ISBN: "0306406152"})
+	assert.Equal(t, result.Ok, true)
+	assert.Equal(t, result.Payload.(queries.BookQueryResults).Results, []database.Book{b0})
+
+	// Duplicate ISBNs are rejected within a batch
+	b3, b4 := utils.RandomBook(), utils.RandomBook()
+	b3.ISBN, b4.ISBN = "0-8044-2957-X", "9780804429573"
+	result = server.StoreBooks([]*database.Book{&b3, &b4})
+	assert.Equal(t, result.Ok, false)
+	assert.Equal(t, result.Message, "Failed to store books, duplicate ISBN 9780804429573 in the batch")
+	b4.ISBN = ""
+	assert.Equal(t, server.StoreBooks([]*database.Book{&b3, &b4}).Ok, true)
+
+	// Modify the ISBN
+	b2.ISBN = "979-10-90636-07-1"
+	assert.Equal(t, server.ModifyBookInfo(&b2).Ok, true)
+	assert.Equal(t, server.QueryBookByISBN("9791090636071").Payload.(database.Book).BookId, b2.BookId)
+	b2.ISBN = b0.ISBN
+	assert.Equal(t, server.ModifyBookInfo(&b2).Ok, false)
+}
+
+func TestContributors(t *testing.T) {
+	server := Server{}
+	database.ResetDatabase()
+
+	assert.Equal(t, database.SplitAuthors("Abraham Silberschatz, Henry F. Korth and S. Sudarshan"),
+		[]string{"Abraham Silberschatz", "Henry F. Korth", "S. Sudarshan"})
+	assert.Equal(t, database.SplitAuthors(" Kernighan & Ritchie; Kernighan "), []string{"Kernighan", "Ritchie"})
+
+	b0 := utils.RandomBook()
+	b0.Author = "Abraham Silberschatz, Henry F. Korth and S. Sudarshan"
+	b1 := utils.RandomBook()
+	b1.Author = "Henry F. Korth"
+	b2 := utils.RandomBook()
+	b2.Author = "Henry Kissinger"
+	assert.Equal(t, server.StoreBooks([]*database.Book{&b0, &b1, &b2}).Ok, true)
+	names := func(bookId int) []string {
+		result := server.ShowContributors(bookId)
+		assert.Equal(t, result.Ok, true)
+		names := make([]string, 0)
+		for _, item := range result.Payload.(queries.ContributorList).Contributors {
+			names = append(names, item.Role+":"+item.Name)
 		}
+		return names
 	}
-	assert.Equal(t, len(originBookList), len(bookValid))
-	assert.Equal(t, len(originBookList) > len(actualBookList), true)
-
-	/* Bulk load these books */
-	for i, book := range originBookList {
-		if bookValid[i] {
-			assert.Equal(t, server.StoreBook(book).Ok, true)
-		} else {
-			assert.Equal(t, server.StoreBook(book).Ok, false)
+	bookIds := func(conditions queries.BookQueryConditions) []int {
+		result := server.QueryBooks(conditions)
+		assert.Equal(t, result.Ok, true)
+		bookIds := make([]int, 0)
+		for _, book := range result.Payload.(queries.BookQueryResults).Results {
+			bookIds = append(bookIds, book.BookId)
 		}
+		return bookIds
 	}
 
-	/* Use query interface to check correctness */
-	queryResult := server.QueryBooks(queries.BookQueryConditions{})
-	assert.Equal(t, queryResult.Ok, true)
-	selectedResults := queryResult.Payload.(queries.BookQueryResults)
-	assert.Equal(t, len(selectedResults.Results), selectedResults.Count)
+	// Authors are credited from the display string
+	assert.Equal(t, names(b0.BookId), []string{"author:Abraham Silberschatz", "author:Henry F. Korth", "author:S. Sudarshan"})
+	assert.Equal(t, bookIds(queries.BookQueryConditions{Contributor: "Henry F. Korth"}), []int{b0.BookId, b1.BookId})
+	assert.Equal(t, bookIds(queries.BookQueryConditions{Author: "Henry"}), []int{b0.BookId, b1.BookId, b2.BookId})
 
-	// Sort actual book list by its PK
-	compareBooks := actualBookList.List()
-	sort.Slice(compareBooks, func(i, j int) bool {
-		return compareBooks[i].BookId < compareBooks[j].BookId
+	// Editors and translators are matched as well
+	result := server.ModifyContributors(b2.BookId, []queries.ContributorItem{
+		{Name: "Henry Kissinger", Role: database.RoleAuthor},
+		{Name: "S. Sudarshan", Role: database.RoleTranslator},
+		{Name: "Henry F. Korth", Role: database.RoleEditor},
+	})
+	assert.Equal(t, result.Ok, true)
+	assert.Equal(t, result.Payload.(queries.ContributorList).Count, 3)
+	assert.Equal(t, bookIds(queries.BookQueryConditions{Contributor: "S. Sudarshan"}), []int{b0.BookId, b2.BookId})
+	assert.Equal(t, bookIds(queries.BookQueryConditions{Contributor: "S. Sudarshan", Role: database.RoleTranslator}), []int{b2.BookId})
+	assert.Equal(t, bookIds(queries.BookQueryConditions{Author: "Sudarshan"}), []int{b0.BookId, b2.BookId})
+	assert.Equal(t, bookIds(queries.BookQueryConditions{Authors: []string{"S. Sudarshan"}}), []int{b0.BookId, b2.BookId})
+	assert.Equal(t, bookIds(queries.BookQueryConditions{ExcludeAuthors: []string{"S. Sudarshan"}}), []int{b1.BookId})
+	assert.Equal(t, server.ModifyContributors(b2.BookId, []queries.ContributorItem{{Name: "X", Role: "reviewer"}}).Ok, false)
+	assert.Equal(t, server.ModifyContributors(b2.BookId+100, []queries.ContributorItem{}).Ok, false)
+
+	// The display string follows the authors, and the author credits follow the display string
+	result = server.ModifyContributors(b1.BookId, []queries.ContributorItem{
+		{Name: "Henry F. Korth", Role: database.RoleAuthor},
+		{Name: "Abraham Silberschatz", Role: database.RoleAuthor},
 	})
+	assert.Equal(t, result.Ok, true)
+	books := server.QueryBooks(queries.BookQueryConditions{Contributor: "Abraham Silberschatz"}).Payload.(queries.BookQueryResults)
+	assert.Equal(t, books.Results[1].Author, "Henry F. Korth, Abraham Silberschatz")
+	b2.Author = "Henry Kissinger and S. Sudarshan"
+	assert.Equal(t, server.ModifyBookInfo(&b2).Ok, true)
+	assert.Equal(t, names(b2.BookId), []string{"author:Henry Kissinger", "author:S. Sudarshan", "translator:S. Sudarshan", "editor:Henry F. Korth"})
+
+	// Credits are removed along with the book
+	assert.Equal(t, server.RemoveBook(b0.BookId).Ok, true)
+	assert.Equal(t, names(b0.BookId), []string{})
+}
 
-	assert.Equal(t, len(compareBooks), selectedResults.Count)
-	for i := 0; i < len(compareBooks); i++ {
-		// Pointer and Value comparison: just compare the value
-		assert.Equal(t, compareBooks[i], selectedResults.Results[i])
-	}
+func TestBorrowAndReturnBook(t *testing.T) {
+	apitest.BorrowAndReturnBook(t, target())
 }
 
-func TestIncBookStock(t *testing.T) {
+func TestParallelBorrowBook(t *testing.T) {
+	apitest.ParallelBorrowBook(t, target())
+}
+
+func TestOverdueBorrows(t *testing.T) {
 	server := Server{}
 	database.ResetDatabase()
 
-	const numBooks = 50
-	const numRandomTests = 1000
-	/* simply insert some books to database */
+	library := utils.CreateLibrary(3, 2, 0, &server)
+	now := time.Now().UnixMilli()
+	day := (24 * time.Hour).Milliseconds()
+	loanPeriod := Policy.Resolve(library.Cards[0].Type, library.Books[0].Category).LoanPeriod().Milliseconds()
+
+	// Borrowed long ago and not returned: overdue
+	late := database.CreateBorrow(library.Cards[0].CardId, library.Books[0].BookId)
+	late.BorrowTime = now - loanPeriod - 3*day + 1
+	assert.Equal(t, server.BorrowBook(late).Ok, true)
+	// Borrowed just now: not overdue
+	fresh := database.CreateBorrow(library.Cards[1].CardId, library.Books[1].BookId)
+	assert.Equal(t, server.BorrowBook(fresh).Ok, true)
+	// Borrowed long ago but returned: not overdue
+	returned := database.CreateBorrow(library.Cards[1].CardId, library.Books[2].BookId)
+	returned.BorrowTime = now - loanPeriod - 10*day
+	assert.Equal(t, server.BorrowBook(returned).Ok, true)
+	returned.ResetReturnTime()
+	assert.Equal(t, server.ReturnBook(returned).Ok, true)
+
+	result := server.ShowOverdueBorrows(now)
+	assert.Equal(t, result.Ok, true)
+	overdue := result.Payload.(queries.OverdueBorrows)
+	assert.Equal(t, 1, overdue.Count)
+	item := overdue.Items[0]
+	assert.Equal(t, late.CardId, item.CardId)
+	assert.Equal(t, late.BookId, item.BookId)
+	assert.Equal(t, library.Cards[0].Name, item.Name)
+	assert.Equal(t, library.Books[0].Title, item.Title)
+	assert.Equal(t, late.BorrowTime+loanPeriod, item.DueTime)
+	assert.Equal(t, 3, item.DaysLate)
+
+	// The histories tell the status of each loan
+	histories := server.ShowBorrowHistories(library.Cards[0].CardId).Payload.(queries.BorrowHistories)
+	assert.Equal(t, queries.Overdue, histories.Items[0].Status)
+	assert.Equal(t, histories.Items[0].DaysLate >= 3, true) // late by now
+	histories = server.ShowBorrowHistories(library.Cards[1].CardId).Payload.(queries.BorrowHistories)
+	assert.Equal(t, 2, histories.Count)
+	assert.Equal(t, queries.OnLoan, histories.Items[0].Status)
+	assert.Equal(t, queries.ReturnedLate, histories.Items[1].Status)
+	assert.Equal(t, library.Books[2].Title, histories.Items[1].Title)
+}
+
+func TestSearchBorrows(t *testing.T) {
+	server := Server{}
 	database.ResetDatabase()
-	var books = make(map[database.Book]int) // Use map to avoid duplicated books
-	var bookIds = make(map[int]int)
-	for i := 0; i < numBooks; i++ {
+
+	books := make([]*database.Book, 0)
+	for _, title := range []string{"Compilers", "Algorithms"} {
 		book := utils.RandomBook()
-		books[book] = i
+		book.Title, book.Category, book.Stock = title, "Computer Science", 3
+		assert.Equal(t, server.StoreBook(&book).Ok, true)
+		books = append(books, &book)
+	}
+	cards := []*database.Card{
+		{Name: "Alice", Department: "Law", Type: "S"},
+		{Name: "Bob", Department: "Law", Type: "T"},
+		{Name: "Carol", Department: "Architecture", Type: "S"},
+	}
+	for _, card := range cards {
+		assert.Equal(t, server.RegisterCard(card).Ok, true)
+	}
+	day := (24 * time.Hour).Milliseconds()
+	start := time.Now().UnixMilli() - 30*day
+	borrows := []database.Borrow{
+		{CardId: cards[0].CardId, BookId: books[0].BookId, BorrowTime: start},
+		{CardId: cards[1].CardId, BookId: books[0].BookId, BorrowTime: start + day},
+		{CardId: cards[2].CardId, BookId: books[1].BookId, BorrowTime: start + 2*day},
+		{CardId: cards[0].CardId, BookId: books[1].BookId, BorrowTime: start + 3*day},
+	}
+	for i := range borrows {
+		assert.Equal(t, server.BorrowBook(borrows[i]).Ok, true)
+	}
+	// the first two are returned
+	for i := range borrows[:2] {
+		borrows[i].ReturnTime = start + 10*day + int64(i)
+		assert.Equal(t, server.ReturnBook(borrows[i]).Ok, true)
 	}
 
-	var bookList = make([]*database.Book, 0, len(books))
-	for book, i := range books {
-		result := server.StoreBook(&book)
+	search := func(conditions queries.BorrowQueryConditions) queries.BorrowQueryResults {
+		t.Helper()
+		result := server.SearchBorrows(conditions)
 		assert.Equal(t, result.Ok, true)
-		bookIds[result.Payload.(*database.Book).BookId] = i
-		bookList = append(bookList, &book)
+		return result.Payload.(queries.BorrowQueryResults)
 	}
-	assert.Equal(t, len(books), len(bookIds))
-
-	/* begin tests */
-	type args struct {
-		bookId     int
-		deltaStock int
+	times := func(results queries.BorrowQueryResults) []int64 {
+		times := make([]int64, 0, len(results.Items))
+		for _, item := range results.Items {
+			times = append(times, item.BorrowTime)
+		}
+		return times
 	}
-	type test struct {
-		name string
-		args args
-		want database.APIResult
+
+	/* the latest first by default, with the title and the card holder */
+	results := search(queries.BorrowQueryConditions{})
+	assert.Equal(t, results.Total, 4)
+	assert.Equal(t, times(results), []int64{start + 3*day, start + 2*day, start + day, start})
+	assert.Equal(t, results.Items[0].Title, "Algorithms")
+	assert.Equal(t, results.Items[0].Name, "Alice")
+	assert.Equal(t, results.Items[0].Department, "Law")
+
+	/* who currently has the book */
+	results = search(queries.BorrowQueryConditions{BookId: books[1].BookId, Status: queries.Open})
+	assert.Equal(t, times(results), []int64{start + 3*day, start + 2*day})
+	results = search(queries.BorrowQueryConditions{BookId: books[0].BookId, Status: queries.Open})
+	assert.Equal(t, results.Total, 0)
+
+	/* by card, department and card type */
+	assert.Equal(t, times(search(queries.BorrowQueryConditions{CardId: cards[0].CardId, Status: queries.Returned})), []int64{start})
+	assert.Equal(t, search(queries.BorrowQueryConditions{Department: "Law"}).Total, 3)
+	assert.Equal(t, times(search(queries.BorrowQueryConditions{Department: "Law", Status: queries.Open})), []int64{start + 3*day})
+	assert.Equal(t, times(search(queries.BorrowQueryConditions{CardType: "T"})), []int64{start + day})
+
+	/* by time ranges, closed */
+	results = search(queries.BorrowQueryConditions{MinBorrowTime: start + day, MaxBorrowTime: start + 2*day})
+	assert.Equal(t, times(results), []int64{start + 2*day, start + day})
+	results = search(queries.BorrowQueryConditions{MaxReturnTime: start + 10*day})
+	assert.Equal(t, times(results), []int64{start})
+
+	/* sorted and paged */
+	results = search(queries.BorrowQueryConditions{SortBy: queries.CardName, Limit: 2, Offset: 1})
+	assert.Equal(t, results.Total, 4)
+	assert.Equal(t, results.Count, 2)
+	assert.Equal(t, results.Items[0].Name, "Alice")
+	assert.Equal(t, results.Items[1].Name, "Bob")
+	results = search(queries.BorrowQueryConditions{SortBy: queries.BookTitle, SortOrder: queries.Desc, Offset: 3})
+	assert.Equal(t, results.Count, 1)
+	assert.Equal(t, results.Items[0].Title, "Algorithms")
+
+	/* invalid conditions */
+	for _, conditions := range []queries.BorrowQueryConditions{
+		{SortBy: "borrow_time; drop table borrows"},
+		{Status: "lost"},
+		{CardType: "X"},
+		{Limit: -1},
+	} {
+		assert.Equal(t, server.SearchBorrows(conditions).Code, database.ErrInvalidArgument)
 	}
-	var tests []test
+}
 
-	/* corner case: invalid book id */
-	tests = append(tests, test{
-		name: "Invalid book id - Negative",
-		args: args{bookId: -1, deltaStock: 6},
-		want: database.APIResult{Ok: false},
-	})
-	k := len(books) + 1
-	_, ok := bookIds[k]
-	for ok { // generate an invalid book id
-		k++
-		_, ok = bookIds[k]
-	}
-	tests = append(tests, test{
-		name: "Invalid book id - Maximum",
-		args: args{bookId: k, deltaStock: 10},
-		want: database.APIResult{Ok: false},
-	})
+func TestReports(t *testing.T) {
+	server := Server{}
+	database.ResetDatabase()
 
-	/* corner case: invalid book stock */
-	lastBook := bookList[len(bookList)-1]
-	tests = append(tests, test{
-		name: "Decrease book stock",
-		args: args{bookId: lastBook.BookId, deltaStock: -lastBook.Stock},
-		want: database.APIResult{Ok: true},
-	})
-	tests = append(tests, test{
-		name: "Increase book stock",
-		args: args{bookId: lastBook.BookId, deltaStock: 1},
-		want: database.APIResult{Ok: true},
-	})
-	tests = append(tests, test{
-		name: "Test for invalid book stock - Negative",
-		args: args{bookId: lastBook.BookId, deltaStock: -2},
-		want: database.APIResult{Ok: false},
-	})
-	lastBook.Stock = 1
-
-	/* randomly choose some books to do this operation */
-	for i := 0; i < numRandomTests; i++ {
-		book := bookList[rand.Intn(len(bookList)-1)]
-		assert.NotEqual(t, book, nil)
-		deltaStock := rand.Intn(24) - 8
-		expected := book.Stock+deltaStock >= 0
-		if expected {
-			book.Stock = book.Stock + deltaStock
+	books := make([]*database.Book, 0)
+	for _, category := range []string{"Novel", "Novel", "History"} {
+		book := utils.RandomBook()
+		book.Category, book.Title, book.Stock = category, fmt.Sprintf("Book%02d", len(books)), 2
+		assert.Equal(t, server.StoreBook(&book).Ok, true)
+		books = append(books, &book)
+	}
+	cards := []*database.Card{
+		{Name: "Alice", Department: "Law", Type: "S"},
+		{Name: "Bob", Department: "Law", Type: "T"},
+		{Name: "Carol", Department: "Architecture", Type: "S"},
+		{Name: "Dave", Department: "Architecture", Type: "S"}, // never borrows
+	}
+	for _, card := range cards {
+		assert.Equal(t, server.RegisterCard(card).Ok, true)
+	}
+	day := (24 * time.Hour).Milliseconds()
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC).UnixMilli() // a Monday
+	borrows := []database.Borrow{
+		{CardId: cards[0].CardId, BookId: books[0].BookId, BorrowTime: start, ReturnTime: start + 2*day},
+		{CardId: cards[1].CardId, BookId: books[0].BookId, BorrowTime: start + day, ReturnTime: start + 5*day},
+		{CardId: cards[2].CardId, BookId: books[1].BookId, BorrowTime: start + 8*day},
+		{CardId: cards[0].CardId, BookId: books[2].BookId, BorrowTime: start + 40*day},
+	}
+	for _, borrow := range borrows {
+		returnTime := borrow.ReturnTime
+		borrow.ReturnTime = 0
+		assert.Equal(t, server.BorrowBook(borrow).Ok, true)
+		if returnTime != 0 {
+			borrow.ReturnTime = returnTime
+			assert.Equal(t, server.ReturnBook(borrow).Ok, true)
 		}
-		tests = append(tests, test{
-			name: fmt.Sprintf("Random test %d", i),
-			args: args{bookId: book.BookId, deltaStock: deltaStock},
-			want: database.APIResult{Ok: expected},
-		})
-	}
-
-	/* run tests */
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := server.IncBookStock(tt.args.bookId, tt.args.deltaStock); got.Ok != tt.want.Ok {
-				t.Errorf("IncBookStock() = %v, want %v", got, tt.want)
-			}
-		})
 	}
+	report := func(result database.APIResult) interface{} {
+		t.Helper()
+		assert.Equal(t, result.Ok, true)
+		return result.Payload
+	}
+	all := queries.ReportConditions{}
 
-	/* use query interface to check correctness */
-	sort.Slice(bookList, func(i, j int) bool {
-		return bookList[i].BookId < bookList[j].BookId
+	/* top books */
+	top := report(server.ReportTopBooks(all)).(queries.TopBooks)
+	assert.Equal(t, top.Count, 3)
+	assert.Equal(t, top.Items[0], queries.BookLoans{
+		BookId: books[0].BookId, Title: books[0].Title, Author: books[0].Author, Category: "Novel", Loans: 2,
 	})
-	queryResult := server.QueryBooks(queries.BookQueryConditions{})
-	assert.Equal(t, queryResult.Ok, true)
-	selectedResults := queryResult.Payload.(queries.BookQueryResults)
-	assert.Equal(t, len(bookList), selectedResults.Count)
-	for i := 0; i < len(bookList); i++ {
-		assert.Equal(t, bookList[i], selectedResults.Results[i])
+	assert.Equal(t, top.Items[1].BookId, books[1].BookId)
+	top = report(server.ReportTopBooks(queries.ReportConditions{Limit: 1, From: start + day})).(queries.TopBooks)
+	assert.Equal(t, top.Items, []queries.BookLoans{{
+		BookId: books[0].BookId, Title: books[0].Title, Author: books[0].Author, Category: "Novel", Loans: 1,
+	}})
+
+	/* loans by group */
+	categories := report(server.ReportLoansByCategory(all)).(queries.LoansByGroup)
+	assert.Equal(t, categories.Items, []queries.GroupLoans{{Group: "Novel", Loans: 3}, {Group: "History", Loans: 1}})
+	departments := report(server.ReportLoansByDepartment(queries.ReportConditions{To: start + 8*day})).(queries.LoansByGroup)
+	assert.Equal(t, departments.Items, []queries.GroupLoans{{Group: "Law", Loans: 2}, {Group: "Architecture", Loans: 1}})
+
+	/* duration of returned loans */
+	duration := report(server.ReportLoanDuration(all)).(queries.LoanDuration)
+	assert.Equal(t, duration, queries.LoanDuration{Returned: 2, Average: 3 * day, AverageDays: 3})
+
+	/* active and dormant cards */
+	assert.Equal(t, report(server.ReportCardActivity(all)), queries.CardActivity{Total: 4, Active: 3, Dormant: 1})
+	assert.Equal(t, report(server.ReportCardActivity(queries.ReportConditions{From: start + 2*day})),
+		queries.CardActivity{Total: 4, Active: 2, Dormant: 2})
+
+	/* time series, with the periods without loans */
+	series := report(server.ReportLoanSeries(queries.ReportConditions{Interval: queries.Monthly})).(queries.LoanSeries)
+	assert.Equal(t, series.Items, []queries.PeriodLoans{
+		{Period: "2024-01", Start: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli(), Loans: 3},
+		{Period: "2024-02", Start: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC).UnixMilli(), Loans: 1},
+	})
+	series = report(server.ReportLoanSeries(queries.ReportConditions{Interval: queries.Weekly})).(queries.LoanSeries)
+	assert.Equal(t, series.Count, 6)
+	assert.Equal(t, series.Items[0], queries.PeriodLoans{Period: "2024-W01", Start: start - 10*time.Hour.Milliseconds(), Loans: 2})
+	assert.Equal(t, series.Items[1].Loans, 1)
+	assert.Equal(t, series.Items[5].Period, "2024-W06")
+	series = report(server.ReportLoanSeries(all)).(queries.LoanSeries)
+	assert.Equal(t, series.Count, 41)
+	assert.Equal(t, series.Items[40].Period, "2024-02-10")
+
+	/* invalid conditions */
+	for _, conditions := range []queries.ReportConditions{{From: 2, To: 1}, {Limit: -1}, {Interval: "year"}} {
+		assert.Equal(t, server.ReportTopBooks(conditions).Code, database.ErrInvalidArgument)
+		assert.Equal(t, server.ReportLoanSeries(conditions).Code, database.ErrInvalidArgument)
 	}
 }
 
-func TestBulkRegisterBook(t *testing.T) {
-	const numBulkBooks = 1000
-	const numDuplicateBooks = 3
+func TestImportBooks(t *testing.T) {
 	server := Server{}
 	database.ResetDatabase()
-
-	/* simply insert some books to database */
-	var books = make(utils.BookSet)
-	for i := 0; i < numBulkBooks; i++ {
-		book := utils.RandomBook()
-		books.Insert(book)
-	}
-
-	/* provide some duplicate records */
-	bookList1 := books.List()
-	for i := 0; i < numDuplicateBooks; i++ {
-		newBook := *bookList1[rand.Intn(len(bookList1))]
-		cb := &newBook
-		// randomly change some attributes
-		if rand.Intn(2) == 0 {
-			cb.Stock = utils.RandomStock()
-			cb.Price = utils.RandomPrice()
+	existing := database.Book{Category: "Computer", Title: "Algorithms", Press: "MIT Press", PublishYear: 2009,
+		Author: "Cormen", Price: 80, Stock: 1, ISBN: "9780262033848"}
+	assert.Equal(t, server.StoreBook(&existing).Ok, true)
+
+	csv := "\ufeffTitle,Category,Publisher,publish_year,AUTHOR,price,stock,isbn,Notes\n" +
+		"Go,Computer,MIT Press,2020,Alan,10.5,2,,new\n" + // 2
+		"Rust,Computer,MIT Press,abc,Steve,20,1,,bad year\n" + // 3
+		"Go,Computer,MIT Press,2020,Alan,12,1,,same book as line 2\n" + // 4
+		"Haskell,Computer\n" + // 5
+		"\"Algorithms, again\",Computer,MIT Press,2022,Cormen,90,0,978-0-262-03384-8,same ISBN\n" + // 6
+		"C,Computer,Prentice Hall,1988,Kernighan,30,0,,\n" // 7
+	options := queries.ImportOptions{Columns: map[string]string{"Publisher": "press", "Notes": ""}}
+	count := func() int {
+		t.Helper()
+		result := server.QueryBooks(queries.BookQueryConditions{})
+		assert.Equal(t, result.Ok, true)
+		return result.Payload.(queries.BookQueryResults).Count
+	}
+	lines := func(result queries.ImportResult) []int {
+		lines := make([]int, 0)
+		for _, rowError := range result.Errors {
+			lines = append(lines, rowError.Line)
 		}
-		bookList1 = append(bookList1, cb)
+		return lines
 	}
-	// shuffle the book list
-	rand.Shuffle(len(bookList1), func(i, j int) {
-		bookList1[i], bookList1[j] = bookList1[j], bookList1[i]
-	})
-	assert.Equal(t, server.StoreBooks(bookList1).Ok, false)
-
-	/* make sure that none of the books are inserted */
-	queryResult1 := server.QueryBooks(queries.BookQueryConditions{})
-	assert.Equal(t, queryResult1.Ok, true)
-	selectedResults1 := queryResult1.Payload.(queries.BookQueryResults)
-	assert.Equal(t, 0, selectedResults1.Count)
-
-	/* normal batch insert */
-	bookList2 := books.List()
-	assert.Equal(t, server.StoreBooks(bookList2).Ok, true)
-	queryResult2 := server.QueryBooks(queries.BookQueryConditions{})
-	assert.Equal(t, queryResult2.Ok, true)
-	selectedResults2 := queryResult2.Payload.(queries.BookQueryResults)
-	assert.Equal(t, len(bookList2), selectedResults2.Count)
-	sort.Slice(bookList2, func(i, j int) bool {
-		return bookList2[i].BookId < bookList2[j].BookId
+
+	/* nothing is imported in all mode */
+	result := server.ImportBooks(strings.NewReader(csv), options)
+	assert.Equal(t, result.Ok, false)
+	assert.Equal(t, result.Code, database.ErrInvalidRows)
+	imported := result.Payload.(queries.ImportResult)
+	assert.Equal(t, imported.Mode, queries.AllOrNothing)
+	assert.Equal(t, []int{imported.Rows, imported.Valid, imported.Imported}, []int{6, 2, 0})
+	assert.Equal(t, lines(imported), []int{3, 4, 5, 6})
+	assert.Equal(t, imported.Errors[0].Code, database.ErrInvalidArgument)
+	assert.Equal(t, imported.Errors[1].Code, database.ErrDuplicateBook)
+	assert.Equal(t, imported.Errors[2].Code, database.ErrInvalidArgument)
+	assert.Equal(t, imported.Errors[3].Code, database.ErrDuplicateISBN)
+	assert.Equal(t, count(), 1)
+
+	/* a dry run rolls back */
+	options.Mode, options.DryRun = queries.BestEffort, true
+	result = server.ImportBooks(strings.NewReader(csv), options)
+	assert.Equal(t, result.Ok, true)
+	imported = result.Payload.(queries.ImportResult)
+	assert.Equal(t, []int{imported.Valid, imported.Imported}, []int{2, 0})
+	assert.Equal(t, lines(imported), []int{3, 4, 5, 6})
+	assert.Equal(t, count(), 1)
+
+	/* the valid rows are imported with their copies in best-effort mode */
+	options.DryRun = false
+	result = server.ImportBooks(strings.NewReader(csv), options)
+	assert.Equal(t, result.Ok, true)
+	imported = result.Payload.(queries.ImportResult)
+	assert.Equal(t, []int{imported.Valid, imported.Imported}, []int{2, 2})
+	assert.Equal(t, count(), 3)
+	books := server.QueryBooks(queries.BookQueryConditions{Title: "Go", Match: queries.Exact}).Payload.(queries.BookQueryResults).Results
+	assert.Equal(t, len(books), 1)
+	assert.Equal(t, []interface{}{books[0].Press, books[0].Price, books[0].Stock}, []interface{}{"MIT Press", 10.5, 2})
+	assert.Equal(t, server.ShowCopies(books[0].BookId, "").Payload.(queries.CopyList).Count, 2)
+
+	/* malformed rows are reported with the error of the CSV, and ISBNs are checked against the previous rows */
+	malformed := "title,category,press,publish_year,author,price,isbn\n" +
+		"Haskell,Computer\n" +
+		"Perl,Com\"puter,O'Reilly,1991,Larry,25,\n" +
+		"SICP,Computer,MIT Press,1985,Abelson,40,9780262510875\n" +
+		"SICP,Computer,MIT Press,1996,Sussman,45,0-262-51087-1\n"
+	result = server.ImportBooks(strings.NewReader(malformed), queries.ImportOptions{Mode: queries.BestEffort, DryRun: true})
+	assert.Equal(t, result.Ok, true)
+	imported = result.Payload.(queries.ImportResult)
+	assert.Equal(t, []int{imported.Rows, imported.Valid}, []int{4, 1})
+	assert.Equal(t, imported.Errors, []queries.RowError{
+		{Line: 2, Message: "record on line 2: wrong number of fields", Code: database.ErrInvalidArgument},
+		{Line: 3, Message: `parse error on line 3, column 9: bare " in non-quoted-field`, Code: database.ErrInvalidArgument},
+		{Line: 5, Message: "a book with ISBN 9780262510875 already exists", Code: database.ErrDuplicateISBN},
 	})
-	for i := 0; i < len(bookList2); i++ {
-		assert.Equal(t, bookList2[i], selectedResults2.Results[i])
+
+	/* invalid headers and modes */
+	for _, header := range []string{"", "title,category,press,publish_year,author,price,pages\n", "title,category,press,author,price\n",
+		"title,Title,category,press,publish_year,author,price\n"} {
+		assert.Equal(t, server.ImportBooks(strings.NewReader(header), queries.ImportOptions{}).Code, database.ErrInvalidArgument)
 	}
+	assert.Equal(t, server.ImportBooks(strings.NewReader(csv), queries.ImportOptions{Mode: "some"}).Code, database.ErrInvalidArgument)
 }
 
-func TestRemoveBook(t *testing.T) {
+func TestImportCards(t *testing.T) {
 	server := Server{}
 	database.ResetDatabase()
 
-	/* simply insert some data to database */
-	library := utils.CreateLibrary(100, 1, 0, &server)
-	/* remove a non-exist book */
-	assert.Equal(t, server.RemoveBook(-1).Ok, false)
+	csv := "name,department,type\nAlice,Law,S\nBob,Law,X\nAlice,Law,s\n"
+	result := server.ImportCards(strings.NewReader(csv), queries.ImportOptions{Mode: queries.BestEffort})
+	assert.Equal(t, result.Ok, true)
+	imported := result.Payload.(queries.ImportResult)
+	assert.Equal(t, []int{imported.Rows, imported.Valid, imported.Imported}, []int{3, 1, 1})
+	assert.Equal(t, imported.Errors, []queries.RowError{
+		{Line: 3, Message: `type "X" is neither T nor S`, Code: database.ErrInvalidArgument},
+		{Line: 4, Message: "the card already exists", Code: database.ErrDuplicateCard},
+	})
 
-	/* remove a book that someone has not returned yet */
-	borrow := database.CreateBorrow(library.Cards[0].CardId, library.Books[0].BookId)
-	borrow.ResetBorrowTime()
-	assert.Equal(t, server.BorrowBook(borrow).Ok, true)
-	assert.Equal(t, server.RemoveBook(library.Books[0].BookId).Ok, false)
-	borrow.ResetReturnTime()
-	assert.Equal(t, server.ReturnBook(borrow).Ok, true)
-	assert.Equal(t, server.RemoveBook(library.Books[0].BookId).Ok, true)
+	csv = "card_id,name,department,type\n7,Bob,Law,T\n8,Carol,Architecture,S\n"
+	result = server.ImportCards(strings.NewReader(csv), queries.ImportOptions{})
+	assert.Equal(t, result.Ok, true)
+	assert.Equal(t, result.Payload.(queries.ImportResult).Imported, 2)
+	cards := server.ShowCards().Payload.(queries.CardList)
+	assert.Equal(t, cards.Count, 3)
+	assert.NotEqual(t, cards.Cards[1].CardId, 7) // ids are assigned by the library
+}
 
-	/* remove a non-exist book */
-	assert.Equal(t, server.RemoveBook(library.Books[0].BookId).Ok, false)
-	library.Books = library.Books[1:]
+func TestImportMARC(t *testing.T) {
+	server := Server{}
+	database.ResetDatabase()
 
-	/* randomly choose nRemove books to remove */
-	nRemove := rand.Intn(40) + 10
-	for i := 0; i < nRemove; i++ {
-		assert.Equal(t, server.RemoveBook(library.Books[0].BookId).Ok, true)
-		/* remove a non-exist book */
-		assert.Equal(t, server.RemoveBook(library.Books[0].BookId).Ok, false)
-		library.Books = library.Books[1:]
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+<marc:collection xmlns:marc="http://www.loc.gov/MARC21/slim">
+  <marc:record>
+    <marc:leader>01234cam a2200301 a 4500</marc:leader>
+    <marc:controlfield tag="001">ocm123</marc:controlfield>
+    <marc:controlfield tag="008">090218s2009    mau      b    001 0 eng  </marc:controlfield>
+    <marc:datafield tag="020" ind1=" " ind2=" ">
+      <marc:subfield code="a">9780262033848 (hardcover : alk. paper)</marc:subfield>
+      <marc:subfield code="c">$80.00</marc:subfield>
+    </marc:datafield>
+    <marc:datafield tag="100" ind1="1" ind2=" "><marc:subfield code="a">Cormen, Thomas H.,</marc:subfield></marc:datafield>
+    <marc:datafield tag="245" ind1="1" ind2="0">
+      <marc:subfield code="a">Introduction to algorithms /</marc:subfield>
+      <marc:subfield code="c">Thomas H. Cormen ... [et al.].</marc:subfield>
+    </marc:datafield>
+    <marc:datafield tag="260" ind1=" " ind2=" ">
+      <marc:subfield code="a">Cambridge, Mass. :</marc:subfield>
+      <marc:subfield code="b">MIT Press,</marc:subfield>
+      <marc:subfield code="c">c2009.</marc:subfield>
+    </marc:datafield>
+    <marc:datafield tag="650" ind1=" " ind2="0"><marc:subfield code="a">Computer programming.</marc:subfield></marc:datafield>
+    <marc:datafield tag="650" ind1=" " ind2="0"><marc:subfield code="a">Computer algorithms.</marc:subfield></marc:datafield>
+    <marc:datafield tag="700" ind1="1" ind2=" "><marc:subfield code="a">Leiserson, Charles E.</marc:subfield></marc:datafield>
+    <marc:datafield tag="700" ind1="1" ind2=" ">
+      <marc:subfield code="a">Knuth, Donald E.,</marc:subfield>
+      <marc:subfield code="e">editor.</marc:subfield>
+    </marc:datafield>
+  </marc:record>
+  <marc:record>
+    <marc:controlfield tag="001">ocm456</marc:controlfield>
+    <marc:datafield tag="100" ind1="1" ind2=" "><marc:subfield code="a">Nobody, A.</marc:subfield></marc:datafield>
+  </marc:record>
+  <marc:record>
+    <marc:controlfield tag="008">190101s2019    xx            000 0 eng d</marc:controlfield>
+    <marc:datafield tag="110" ind1="2" ind2=" "><marc:subfield code="a">ACM</marc:subfield></marc:datafield>
+    <marc:datafield tag="245" ind1="0" ind2="0"><marc:subfield code="a">Computing curricula :</marc:subfield></marc:datafield>
+    <marc:datafield tag="264" ind1=" " ind2="1"><marc:subfield code="b">ACM Press,</marc:subfield></marc:datafield>
+    <marc:datafield tag="650" ind1=" " ind2="0"><marc:subfield code="a">Education</marc:subfield></marc:datafield>
+  </marc:record>
+</marc:collection>`
+	books := func() []database.Book {
+		t.Helper()
+		result := server.QueryBooks(queries.BookQueryConditions{SortBy: queries.Title})
+		assert.Equal(t, result.Ok, true)
+		return result.Payload.(queries.BookQueryResults).Results
 	}
 
-	/* compare results */
-	queryResult1 := server.QueryBooks(queries.BookQueryConditions{})
-	assert.Equal(t, queryResult1.Ok, true)
-	selectedResults1 := queryResult1.Payload.(queries.BookQueryResults)
-	assert.Equal(t, len(library.Books), selectedResults1.Count)
-
-	sort.Slice(library.Books, func(i, j int) bool {
-		return library.Books[i].BookId < library.Books[j].BookId
+	/* the records that cannot be mapped are reported */
+	result := server.ImportMARC(strings.NewReader(xml), queries.MARCOptions{Format: queries.MARCXML})
+	assert.Equal(t, result.Ok, true)
+	imported := result.Payload.(queries.MARCImportResult)
+	assert.Equal(t, []int{imported.Records, imported.Imported}, []int{3, 2})
+	assert.Equal(t, imported.Errors, []queries.RecordError{{Record: 2, Control: "ocm456", Message: "no title in 245$a"}})
+	stored := books()
+	assert.Equal(t, len(stored), 2)
+	assert.Equal(t, stored[0], database.Book{BookId: stored[0].BookId, Category: "Education", Title: "Computing curricula",
+		Press: "ACM Press", PublishYear: 2019, Author: "ACM"})
+	assert.Equal(t, stored[1], database.Book{BookId: stored[1].BookId, Category: "Computer programming",
+		Title: "Introduction to algorithms", Press: "MIT Press", PublishYear: 2009,
+		Author: "Thomas H. Cormen, Charles E. Leiserson", Price: 80, ISBN: "9780262033848"})
+
+	/* the batch fails as a whole */
+	result = server.ImportMARC(strings.NewReader(xml), queries.MARCOptions{Format: queries.MARCXML})
+	assert.Equal(t, result.Ok, false)
+	assert.Equal(t, result.Code, database.ErrDuplicateISBN)
+	imported = result.Payload.(queries.MARCImportResult)
+	assert.Equal(t, imported.Imported, 0)
+	assert.Equal(t, imported.Errors, []queries.RecordError{
+		{Record: 1, Control: "ocm123", Message: "a book with ISBN 9780262033848 already exists"},
+		{Record: 2, Control: "ocm456", Message: "no title in 245$a"},
 	})
-	for i := 0; i < len(library.Books); i++ {
-		assert.Equal(t, library.Books[i], selectedResults1.Results[i])
+
+	/* the exported records are imported as the same books, with the category in another field */
+	mapping := marc.Mapping{Category: marc.FieldSpec{Tag: "084", Code: 'a'}}
+	var iso strings.Builder
+	assert.Equal(t, marc.WriteRecords(&iso, []*marc.Record{marc.FromBook(stored[0], mapping), marc.FromBook(stored[1], mapping)}), nil)
+	database.ResetDatabase()
+	result = server.ImportMARC(strings.NewReader("garbage\x1d"+iso.String()), queries.MARCOptions{CategoryField: "084$a"})
+	assert.Equal(t, result.Ok, true)
+	imported = result.Payload.(queries.MARCImportResult)
+	assert.Equal(t, []int{imported.Records, imported.Imported, len(imported.Errors)}, []int{3, 2, 1})
+	assert.Equal(t, imported.Errors[0].Record, 1)
+	for i, book := range books() {
+		book.BookId = stored[i].BookId
+		assert.Equal(t, book, stored[i])
 	}
+	result = server.ImportMARC(strings.NewReader(iso.String()), queries.MARCOptions{})
+	assert.Equal(t, result.Payload.(queries.MARCImportResult).Errors[0].Message, "no category in 650$a")
+
+	/* invalid options */
+	for _, options := range []queries.MARCOptions{{Format: "xml"}, {CategoryField: "001a"}, {CategoryField: "650"}} {
+		assert.Equal(t, server.ImportMARC(strings.NewReader(xml), options).Code, database.ErrInvalidArgument)
+	}
+	assert.Equal(t, server.ImportMARC(strings.NewReader("<collection><record>"), queries.MARCOptions{Format: queries.MARCXML}).Code,
+		database.ErrInvalidArgument)
 }
 
-func TestModifyBookInfo(t *testing.T) {
+// usePolicy replaces the policy of the server by the one of the config
+func usePolicy(t *testing.T, config policy.Config) {
+	p, err := policy.New(config)
+	assert.Equal(t, err, nil)
+	Policy = p
+}
+
+func TestBorrowPolicy(t *testing.T) {
 	server := Server{}
 	database.ResetDatabase()
+	defer func(p policy.Policy) { Policy = p }(Policy)
+	limit := func(n int) *int { return &n }
+	usePolicy(t, policy.Config{
+		Default: policy.Rule{MaxLoans: limit(3), LoanDays: limit(30)},
+		CardTypes: map[string]policy.Rule{
+			"T": {MaxLoans: limit(5), LoanDays: limit(90)},
+		},
+		Categories: []policy.CategoryRule{
+			{Category: "Dictionary", Rule: policy.Rule{MaxLoans: limit(1), LoanDays: limit(7)}},
+			{Category: "Dictionary", CardType: "T", Rule: policy.Rule{LoanDays: limit(14)}},
+		},
+	})
+	assert.Equal(t, Policy.Resolve("S", "Novel"), policy.Limits{MaxLoans: 3, LoanDays: 30, MaxRenewals: policy.DefaultMaxRenewals})
+	assert.Equal(t, Policy.Resolve("T", "Novel"), policy.Limits{MaxLoans: 5, LoanDays: 90, MaxRenewals: policy.DefaultMaxRenewals})
+	assert.Equal(t, Policy.Resolve("S", "Dictionary"), policy.Limits{MaxLoans: 3, MaxCategoryLoans: 1, LoanDays: 7, MaxRenewals: policy.DefaultMaxRenewals})
+	assert.Equal(t, Policy.Resolve("T", "Dictionary"), policy.Limits{MaxLoans: 5, MaxCategoryLoans: 1, LoanDays: 14, MaxRenewals: policy.DefaultMaxRenewals})
+
+	// invalid rules are rejected, wherever they are
+	fine := func(f float64) *float64 { return &f }
+	for _, config := range []policy.Config{
+		{Default: policy.Rule{LoanDays: limit(0)}},
+		{CardTypes: map[string]policy.Rule{"T": {LoanDays: limit(-7)}}},
+		{Categories: []policy.CategoryRule{{Category: "Novel", Rule: policy.Rule{MaxRenewals: limit(-1)}}}},
+		{Default: policy.Rule{MaxLoans: limit(-1)}},
+		{Default: policy.Rule{FinePerDay: fine(-0.5)}},
+		{Default: policy.Rule{FineCap: fine(-1)}},
+		{Default: policy.Rule{MaxUnpaidFines: fine(-1)}},
+	} {
+		_, err := policy.New(config)
+		assert.NotEqual(t, err, nil)
+	}
+	_, err := policy.New(policy.Config{Default: policy.Rule{MaxLoans: limit(0), MaxRenewals: limit(0), FinePerDay: fine(0)}})
+	assert.Equal(t, err, nil)
 
-	/* simply insert some books to database */
-	books := make(utils.BookSet)
-	for i := 0; i < 100; i++ {
-		books.Insert(utils.RandomBook())
-	}
-	bookList := books.List()
-	for _, book := range bookList {
-		assert.Equal(t, server.StoreBook(book).Ok, true)
-	}
-	/* randomly change books */
-	for _, book := range bookList {
-		// remove old book from book set
-		assert.Equal(t, books.Remove(*book), true)
-		oldStock := book.Stock      // book's stock cannot be changed by modifyBookInfo
-		for books.Contains(*book) { // make sure the new book does not exist in database
-			// use bit mask to determine which field to update
-			var mask = rand.Intn(128)
-			if mask&0b0000_0001 > 0 {
-				book.Category = utils.RandomCategory()
-			}
-			if mask&0b0000_0010 > 0 {
-				book.Title = utils.RandomTitle()
-			}
-			if mask&0b0000_0100 > 0 {
-				book.Press = utils.RandomPress()
-			}
-			if mask&0b0000_1000 > 0 {
-				book.PublishYear = utils.RandomPublishYear()
-			}
-			if mask&0b0001_0000 > 0 {
-				book.Author = utils.RandomAuthor()
-			}
-			if mask&0b0010_0000 > 0 {
-				book.Price = utils.RandomPrice()
-			}
-			if mask&0b0100_0000 > 0 {
-				book.Stock = utils.RandomStock()
-			}
+	books := make([]*database.Book, 0)
+	for _, category := range []string{"Dictionary", "Dictionary", "Novel", "Novel", "Novel", "Novel"} {
+		book := utils.RandomBook()
+		book.Category = category
+		book.Title = fmt.Sprintf("Book%02d", len(books))
+		book.Stock = 2 // for both the student and the teacher
+		assert.Equal(t, server.StoreBook(&book).Ok, true)
+		books = append(books, &book)
+	}
+	student := database.Card{Name: "Student", Department: utils.RandomDepartment(), Type: "S"}
+	teacher := database.Card{Name: "Teacher", Department: utils.RandomDepartment(), Type: "T"}
+	assert.Equal(t, server.RegisterCard(&student).Ok, true)
+	assert.Equal(t, server.RegisterCard(&teacher).Ok, true)
+
+	borrow := func(card *database.Card, book *database.Book) database.APIResult {
+		return server.BorrowBook(database.CreateBorrow(card.CardId, book.BookId))
+	}
+	// category limit
+	assert.Equal(t, borrow(&student, books[0]).Ok, true)
+	result := borrow(&student, books[1])
+	assert.Equal(t, result.Ok, false)
+	assert.Equal(t, strings.Contains(result.Message, "category Dictionary"), true)
+	// total limit
+	assert.Equal(t, borrow(&student, books[2]).Ok, true)
+	assert.Equal(t, borrow(&student, books[3]).Ok, true)
+	result = borrow(&student, books[4])
+	assert.Equal(t, result.Ok, false)
+	assert.Equal(t, strings.Contains(result.Message, "limit of 3 concurrent loans"), true)
+	// teachers have higher limits
+	for _, book := range books[1:] {
+		assert.Equal(t, borrow(&teacher, book).Ok, true)
+	}
+	assert.Equal(t, borrow(&teacher, books[0]).Ok, false)
+
+	// due time follows the loan period of the card type and category
+	histories := server.ShowBorrowHistories(teacher.CardId).Payload.(queries.BorrowHistories)
+	for _, item := range histories.Items {
+		days := 90
+		if item.BookId == books[1].BookId {
+			days = 14
 		}
-		// insert new book to book set
-		books.Insert(*book)
-		assert.Equal(t, server.ModifyBookInfo(book).Ok, true)
-		book.Stock = oldStock
-	}
-	// compare results
-	queryResult := server.QueryBooks(queries.BookQueryConditions{})
-	assert.Equal(t, queryResult.Ok, true)
-	selectedResults := queryResult.Payload.(queries.BookQueryResults)
-	assert.Equal(t, len(bookList), selectedResults.Count)
-	bookList = books.List()
-	sort.Slice(bookList, func(i, j int) bool {
-		return bookList[i].BookId < bookList[j].BookId
-	})
-	for i := 0; i < len(bookList); i++ {
-		assert.Equal(t, bookList[i], selectedResults.Results[i])
+		assert.Equal(t, item.BorrowTime+(time.Duration(days)*24*time.Hour).Milliseconds(), item.DueTime)
 	}
 }
 
-func TestQueryBook(t *testing.T) {
+func TestRenewBorrow(t *testing.T) {
 	server := Server{}
 	database.ResetDatabase()
+	defer func(p policy.Policy) { Policy = p }(Policy)
+	limit := func(n int) *int { return &n }
+	usePolicy(t, policy.Config{
+		Default: policy.Rule{LoanDays: limit(10), MaxRenewals: limit(2)},
+	})
 
-	/* simply insert some books to database */
-	my := utils.CreateLibrary(100, 1, 0, &server)
-	/* generate single query condition */
-	queryConditions := make([]queries.BookQueryConditions, 0)
-	for i := 0; i < 15; i++ {
-		queryConditions = append(queryConditions, queries.BookQueryConditions{})
-	}
-	queryConditions[0].Category = utils.RandomCategory()
-	queryConditions[1].Title = utils.RandomTitle()
-	queryConditions[2].Press = "Press" // test fuzzy matching
-	queryConditions[3].Press = utils.RandomPress()
-	queryConditions[4].MinPrice = utils.RandomPrice()
-	queryConditions[5].MaxPrice = utils.RandomPrice()
-	queryConditions[6].MinPrice = 20.24
-	queryConditions[6].MaxPrice = 52.42
-	queryConditions[7].MinPublishYear = 2008
-	queryConditions[8].MaxPublishYear = 2020
-	{
-		minY := rand.Intn(15) + 2000
-		maxY := max(minY, rand.Intn(17)+2007)
-		queryConditions[9].MinPublishYear = minY
-		queryConditions[9].MaxPublishYear = maxY
-	}
-	queryConditions[10].Author = "o" // test fuzzy matching
-	queryConditions[11].Author = utils.RandomAuthor()
-	queryConditions[12].SortBy = queries.Price
-	queryConditions[12].SortOrder = queries.Asc
-	queryConditions[13].SortBy = queries.Price
-	queryConditions[13].SortOrder = queries.Desc
-	queryConditions[14].SortBy = queries.PublishYear
-	queryConditions[14].SortOrder = queries.Desc
-	/* generate multi query conditions */
-	for i := 0; i < 45; i++ {
-		c := queries.BookQueryConditions{}
-		mask := rand.Intn(32)
-		selected := 0
-		if (mask & 1) > 0 {
-			c.Press = utils.RandomPress()
-			selected++
-		}
-		if (mask & 2) > 0 {
-			c.Category = utils.RandomCategory()
-			selected++
-		}
-		if (mask & 4) > 0 {
-			c.Author = utils.RandomAuthor()
-			selected++
-		}
-		// Randomly select year
-		if rand.Intn(2+selected) == 1 {
-			minY := rand.Intn(15) + 2000
-			maxY := max(rand.Intn(17)+2007, minY+7)
-			c.MinPublishYear = minY
-			c.MaxPublishYear = maxY
-			selected++
-		}
-		// Randomly select price
-		if rand.Intn(3+selected) == 1 {
-			minP := utils.RandomPrice()
-			maxP := max(utils.RandomPrice(), minP+16.66)
-			c.MinPrice = minP
-			c.MaxPrice = maxP
-		}
-		// Randomly choose one column to sort
-		if rand.Intn(4) != 1 {
-			c.SortBy = utils.RandomSortColumn()
-			c.SortOrder = utils.RandomSortOrder()
-		}
-		queryConditions = append(queryConditions, c)
-	}
-
-	// Loop testing
-	for _, queryCondition := range queryConditions {
-		queryResult := server.QueryBooks(queryCondition)
-		assert.Equal(t, queryResult.Ok, true)
-		bookResults := queryResult.Payload.(queries.BookQueryResults)
-		expectedResults := verifyQueryResult(my.Books, queryCondition)
-		assert.Equal(t, len(expectedResults), bookResults.Count)
-		for i := 0; i < len(expectedResults); i++ {
-			assert.Equal(t, expectedResults[i], bookResults.Results[i])
-		}
+	library := utils.CreateLibrary(2, 1, 0, &server)
+	card, book := library.Cards[0], library.Books[0]
+	borrow := database.CreateBorrow(card.CardId, book.BookId)
+	borrow.BorrowTime -= (9 * 24 * time.Hour).Milliseconds()
+
+	// Renew a book that is not borrowed
+	assert.Equal(t, server.RenewBorrow(borrow).Ok, false)
+
+	assert.Equal(t, server.BorrowBook(borrow).Ok, true)
+	for i := 1; i <= 2; i++ {
+		before := time.Now().UnixMilli()
+		result := server.RenewBorrow(database.Borrow{CardId: card.CardId, BookId: book.BookId})
+		assert.Equal(t, result.Ok, true)
+		renewed := result.Payload.(database.Borrow)
+		assert.Equal(t, borrow.BorrowTime, renewed.BorrowTime)
+		assert.Equal(t, i, renewed.Renewals)
+		assert.Equal(t, renewed.DueTime >= before+(10*24*time.Hour).Milliseconds(), true)
+		assert.Equal(t, renewed.DueTime <= time.Now().UnixMilli()+(10*24*time.Hour).Milliseconds(), true)
 	}
+	// Renewal limit reached
+	result := server.RenewBorrow(borrow)
+	assert.Equal(t, result.Ok, false)
+	assert.Equal(t, strings.Contains(result.Message, "limit of 2 renewals"), true)
+
+	histories := server.ShowBorrowHistories(card.CardId).Payload.(queries.BorrowHistories)
+	assert.Equal(t, 1, histories.Count)
+	assert.Equal(t, 2, histories.Items[0].Renewals)
+
+	// Returned books cannot be renewed
+	borrow.ResetReturnTime()
+	assert.Equal(t, server.ReturnBook(borrow).Ok, true)
+	assert.Equal(t, server.RenewBorrow(borrow).Ok, false)
 }
 
-func TestBorrowAndReturnBook(t *testing.T) {
+func TestHolds(t *testing.T) {
 	server := Server{}
 	database.ResetDatabase()
 
-	// Insert some books & cards & borrow histories to database
-	my := utils.CreateLibrary(50, 50, 100, &server)
-
-	// Borrow a non-exists book
-	bookIds := make(map[int]bool)
-	for _, book := range my.Books {
-		bookIds[book.BookId] = true
-	}
-	stockMap := make(map[int]int)
-	for _, book := range my.Books {
-		stockMap[book.BookId] = book.Stock
-	}
-	nbId := rand.Intn(200)
-	for bookIds[nbId] {
-		nbId = rand.Intn(200)
-	}
-	cardIds := make(map[int]bool)
-	for _, card := range my.Cards {
-		cardIds[card.CardId] = true
-	}
-	nb := database.CreateBorrow(my.Cards[0].CardId, nbId)
-	nb.ResetBorrowTime()
-	nb.ResetReturnTime()
-	assert.Equal(t, server.BorrowBook(nb).Ok, false)
-	assert.Equal(t, server.ReturnBook(nb).Ok, false)
-
-	// Card not exists
-	ncId := rand.Intn(200)
-	for cardIds[ncId] {
-		ncId = rand.Intn(200)
-	}
-	nc := database.CreateBorrow(ncId, my.Books[0].BookId)
-	nc.ResetBorrowTime()
-	nc.ResetReturnTime()
-	assert.Equal(t, server.BorrowBook(nc).Ok, false)
-	assert.Equal(t, server.ReturnBook(nc).Ok, false)
-
-	// Book & card both not exist
-	nbc := database.CreateBorrow(ncId, nbId)
-	nbc.ResetBorrowTime()
-	assert.Equal(t, server.BorrowBook(nbc).Ok, false)
-
-	// Borrow a book
-	b0 := my.Books[rand.Intn(len(my.Books))]
-	assert.Equal(t, b0.Stock > 0, true)
-	c0 := my.Cards[rand.Intn(len(my.Cards))]
-	r0 := database.CreateBorrow(c0.CardId, b0.BookId)
-	r0.ResetBorrowTime()
-	r0.ResetReturnTime()
-	assert.Equal(t, server.ReturnBook(r0).Ok, false)
+	library := utils.CreateLibrary(1, 3, 0, &server)
+	book := library.Books[0]
+	c0, c1, c2 := library.Cards[0], library.Cards[1], library.Cards[2]
+	assert.Equal(t, server.IncBookStock(book.BookId, 1-book.Stock).Ok, true)
+	stock := func() int {
+		books := server.QueryBooks(queries.BookQueryConditions{}).Payload.(queries.BookQueryResults)
+		return books.Results[0].Stock
+	}
+	holds := func() []queries.HoldItem {
+		result := server.ShowHolds(0, book.BookId)
+		assert.Equal(t, result.Ok, true)
+		return result.Payload.(queries.HoldList).Items
+	}
+	status := func(hold database.Hold) string {
+		for _, item := range holds() {
+			if item.CardId == hold.CardId && item.HoldTime == hold.HoldTime {
+				return item.Status
+			}
+		}
+		return ""
+	}
+
+	// Holds are only for books out of stock
+	assert.Equal(t, server.PlaceHold(database.CreateHold(c1.CardId, book.BookId)).Ok, false)
+	r0 := database.CreateBorrow(c0.CardId, book.BookId)
 	assert.Equal(t, server.BorrowBook(r0).Ok, true)
+	assert.Equal(t, stock(), 0)
 
-	// Borrow it again
-	r1 := database.CreateBorrow(c0.CardId, b0.BookId)
-	r1.ResetBorrowTime()
-	assert.Equal(t, server.BorrowBook(r1).Ok, false)
+	// Queue up
+	h1 := database.CreateHold(c1.CardId, book.BookId)
+	result := server.PlaceHold(h1)
+	assert.Equal(t, result.Ok, true)
+	assert.Equal(t, result.Payload.(queries.HoldItem).Position, 1)
+	h2 := database.CreateHold(c2.CardId, book.BookId)
+	h2.HoldTime = h1.HoldTime + 1
+	result = server.PlaceHold(h2)
+	assert.Equal(t, result.Ok, true)
+	assert.Equal(t, result.Payload.(queries.HoldItem).Position, 2)
+	assert.Equal(t, server.PlaceHold(database.CreateHold(c1.CardId, book.BookId)).Ok, false)
+	assert.Equal(t, server.PlaceHold(database.CreateHold(c0.CardId, book.BookId)).Ok, false)
+	assert.Equal(t, server.PlaceHold(database.CreateHold(c0.CardId, book.BookId+1)).Ok, false)
 
-	// Return this book
-	// Corner case, for return_time > borrow_time
-	nt := database.CreateBorrow(c0.CardId, b0.BookId)
-	nt.ReturnTime = 666
-	assert.Equal(t, server.ReturnBook(nt).Ok, false)
-	nt.ReturnTime = r0.BorrowTime
-	assert.Equal(t, server.ReturnBook(nt).Ok, false)
+	// Cannot renew while others are waiting
+	assert.Equal(t, server.RenewBorrow(r0).Ok, false)
 
-	// Normal case
+	// The returned copy is set aside for the first hold
 	r0.ResetReturnTime()
 	assert.Equal(t, server.ReturnBook(r0).Ok, true)
-	my.Borrows = append(my.Borrows, &r0) // Add to borrow list after operation
-
-	// Return this book again
+	assert.Equal(t, stock(), 0)
+	items := holds()
+	assert.Equal(t, len(items), 2)
+	assert.Equal(t, items[0].Status, database.HoldReady)
+	assert.Equal(t, items[0].ExpireTime, r0.ReturnTime+Policy.PickupWindow().Milliseconds())
+	assert.Equal(t, items[1].Position, 1)
+	assert.Equal(t, server.BorrowBook(database.CreateBorrow(c2.CardId, book.BookId)).Ok, false)
+	r1 := database.CreateBorrow(c1.CardId, book.BookId)
+	assert.Equal(t, server.BorrowBook(r1).Ok, true)
+	assert.Equal(t, status(h1), database.HoldFulfilled)
+	assert.Equal(t, stock(), 0)
+
+	// Cancelling a ready hold puts the copy back to stock
 	r1.ResetReturnTime()
-	assert.Equal(t, server.ReturnBook(r1).Ok, false)
-
-	// Borrow & return this book
-	r2 := database.CreateBorrow(c0.CardId, b0.BookId)
-	r2.ResetBorrowTime()
+	assert.Equal(t, server.ReturnBook(r1).Ok, true)
+	assert.Equal(t, status(h2), database.HoldReady)
+	assert.Equal(t, server.CancelHold(h2).Ok, true)
+	assert.Equal(t, server.CancelHold(h2).Ok, false)
+	assert.Equal(t, status(h2), database.HoldCancelled)
+	assert.Equal(t, stock(), 1)
+
+	// Holds not picked up in time expire
+	r2 := database.CreateBorrow(c0.CardId, book.BookId)
+	r2.BorrowTime -= 2 * Policy.PickupWindow().Milliseconds()
 	assert.Equal(t, server.BorrowBook(r2).Ok, true)
-	r2.ResetReturnTime()
+	h3 := database.CreateHold(c2.CardId, book.BookId)
+	h3.HoldTime = r2.BorrowTime + 1
+	assert.Equal(t, server.PlaceHold(h3).Ok, true)
+	r2.ReturnTime = r2.BorrowTime + 2
 	assert.Equal(t, server.ReturnBook(r2).Ok, true)
-	my.Borrows = append(my.Borrows, &r2) // Add to borrow list after operation
-
-	// Try to borrow a zero-stock book
-	assert.Equal(t, server.IncBookStock(b0.BookId, -b0.Stock).Ok, true)
-	r3 := database.CreateBorrow(c0.CardId, b0.BookId)
-	r3.ResetBorrowTime()
-	assert.Equal(t, server.BorrowBook(r3).Ok, false)
-	stockMap[b0.BookId] = 0 // Now b0.stock == 0
-
-	// Randomly borrow & return books
-	var borrowList []*database.Borrow
-	type borrowRecord struct {
-		bookId int
-		CardId int
-	}
-	borrowStatus := make(map[borrowRecord]bool)
-	for i := 0; i < 1000; i++ {
-		if rand.Intn(2) == 0 && len(borrowList) > 0 { // Do return book
-			k := rand.Intn(len(borrowList))
-			r := borrowList[k]
-			r.ResetReturnTime()
-			assert.Equal(t, server.ReturnBook(*r).Ok, true)
-			borrowList = append(borrowList[:k], borrowList[k+1:]...)
-			delete(borrowStatus, borrowRecord{r.BookId, r.CardId})
-			my.Borrows = append(my.Borrows, r) // Add to borrow list after operation
-			stockMap[r.BookId]++
-		} else { // Do borrow book
-			b := my.Books[rand.Intn(len(my.Books))]
-			c := my.Cards[rand.Intn(len(my.Cards))]
-			r := database.CreateBorrow(c.CardId, b.BookId)
-			r.ResetBorrowTime()
-			sp := borrowRecord{r.BookId, r.CardId}
-			if borrowStatus[sp] || stockMap[r.BookId] == 0 {
-				assert.Equal(t, server.BorrowBook(r).Ok, false)
-			} else {
-				assert.Equal(t, server.BorrowBook(r).Ok, true)
-				borrowStatus[sp] = true
-				borrowList = append(borrowList, &r)
-				stockMap[r.BookId]--
+	assert.Equal(t, status(h3), database.HoldExpired)
+	assert.Equal(t, stock(), 1)
+
+	// New stock goes to waiting holds first
+	r3 := database.CreateBorrow(c0.CardId, book.BookId)
+	assert.Equal(t, server.BorrowBook(r3).Ok, true)
+	h4 := database.CreateHold(c1.CardId, book.BookId)
+	assert.Equal(t, server.PlaceHold(h4).Ok, true)
+	assert.Equal(t, server.IncBookStock(book.BookId, 2).Ok, true)
+	assert.Equal(t, status(h4), database.HoldReady)
+	assert.Equal(t, stock(), 1)
+
+	// Removing the card releases the copy set aside
+	assert.Equal(t, server.RemoveCard(c1.CardId).Ok, true)
+	assert.Equal(t, stock(), 2)
+	result = server.ShowHolds(c1.CardId, 0)
+	assert.Equal(t, result.Ok, true)
+	assert.Equal(t, result.Payload.(queries.HoldList).Count, 0)
+}
+
+func TestFines(t *testing.T) {
+	server := Server{}
+	database.ResetDatabase()
+	defer func(p policy.Policy) { Policy = p }(Policy)
+	days := func(n int) *int { return &n }
+	amount := func(x float64) *float64 { return &x }
+	usePolicy(t, policy.Config{
+		Default: policy.Rule{LoanDays: days(10), FinePerDay: amount(0.5), MaxUnpaidFines: amount(3)},
+		CardTypes: map[string]policy.Rule{
+			"T": {FinePerDay: amount(1), FineCap: amount(5)},
+		},
+	})
+	day := (24 * time.Hour).Milliseconds()
+
+	library := utils.CreateLibrary(3, 0, 0, &server)
+	student := database.Card{Name: "Student", Department: utils.RandomDepartment(), Type: "S"}
+	teacher := database.Card{Name: "Teacher", Department: utils.RandomDepartment(), Type: "T"}
+	assert.Equal(t, server.RegisterCard(&student).Ok, true)
+	assert.Equal(t, server.RegisterCard(&teacher).Ok, true)
+	loans := int64(0)
+	lateReturn := func(card database.Card, book *database.Book, daysLate int) database.APIResult {
+		loans++ // not within the millisecond of the previous loan
+		borrow := database.CreateBorrow(card.CardId, book.BookId)
+		borrow.BorrowTime += loans - 100*day
+		assert.Equal(t, server.BorrowBook(borrow).Ok, true)
+		borrow.ReturnTime = borrow.BorrowTime + 10*day + int64(daysLate)*day
+		return server.ReturnBook(borrow)
+	}
+	fines := func(card database.Card) queries.FineList {
+		result := server.ShowFines(card.CardId)
+		assert.Equal(t, result.Ok, true)
+		return result.Payload.(queries.FineList)
+	}
+
+	// Returned in time: no fine
+	result := lateReturn(student, library.Books[0], 0)
+	assert.Equal(t, result.Ok, true)
+	assert.Equal(t, result.Payload, nil)
+	// Per day rate of the card type
+	result = lateReturn(student, library.Books[0], 4)
+	assert.Equal(t, result.Ok, true)
+	assert.Equal(t, result.Payload.(*database.Fine).Amount, 2.0)
+	assert.Equal(t, result.Payload.(*database.Fine).DaysLate, 4)
+	// Capped fine
+	result = lateReturn(teacher, library.Books[0], 10)
+	assert.Equal(t, result.Payload.(*database.Fine).Amount, 5.0)
+	assert.Equal(t, fines(teacher).Balance, 5.0)
+
+	// Unpaid fines over the limit block borrowing
+	assert.Equal(t, fines(student).Balance, 2.0)
+	assert.Equal(t, lateReturn(student, library.Books[1], 2).Ok, true)
+	assert.Equal(t, fines(student).Balance, 3.0)
+	result = server.BorrowBook(database.CreateBorrow(student.CardId, library.Books[2].BookId))
+	assert.Equal(t, result.Ok, false)
+	assert.Equal(t, strings.Contains(result.Message, "unpaid fines"), true)
+	assert.Equal(t, server.RemoveCard(student.CardId).Ok, false)
+
+	// Payments settle the oldest fines first
+	assert.Equal(t, server.PayFine(database.Ledger{CardId: student.CardId, Amount: 3.01}).Ok, false)
+	assert.Equal(t, server.PayFine(database.Ledger{CardId: student.CardId, Amount: 0}).Ok, false)
+	result = server.PayFine(database.Ledger{CardId: student.CardId, Amount: 2.5, Time: 1})
+	assert.Equal(t, result.Ok, true)
+	assert.Equal(t, len(result.Payload.([]database.Ledger)), 2)
+	list := fines(student)
+	assert.Equal(t, list.Count, 2)
+	assert.Equal(t, list.Balance, 0.5)
+	assert.Equal(t, list.Fines[0].Outstanding(), 0.0)
+	assert.Equal(t, list.Fines[1].Outstanding(), 0.5)
+	assert.Equal(t, server.BorrowBook(database.CreateBorrow(student.CardId, library.Books[2].BookId)).Ok, true)
+
+	// Waivers settle one fine
+	assert.Equal(t, server.WaiveFine(database.Ledger{Amount: 0.5}).Ok, false)
+	result = server.WaiveFine(database.Ledger{CardId: teacher.CardId, FineId: list.Fines[1].FineId})
+	assert.Equal(t, result.Ok, false)
+	assert.Equal(t, result.Code, database.ErrFineOfOtherCard)
+	result = server.WaiveFine(database.Ledger{FineId: list.Fines[1].FineId, Time: 2, Note: "first time"})
+	assert.Equal(t, result.Ok, true)
+	list = fines(student)
+	assert.Equal(t, list.Balance, 0.0)
+	assert.Equal(t, len(list.Ledger), 3)
+	assert.Equal(t, list.Ledger[2].Kind, database.LedgerWaiver)
+	assert.Equal(t, list.Ledger[2].Amount, 0.5)
+	assert.Equal(t, list.Ledger[2].Note, "first time")
+	assert.Equal(t, server.WaiveFine(database.Ledger{FineId: list.Fines[1].FineId}).Ok, false)
+}
+
+func TestParallelFinesAndCopies(t *testing.T) {
+	const numGoroutines = 16
+	server := Server{}
+	database.ResetDatabase()
+	defer func(p policy.Policy) { Policy = p }(Policy)
+	days := func(n int) *int { return &n }
+	amount := func(x float64) *float64 { return &x }
+	usePolicy(t, policy.Config{Default: policy.Rule{LoanDays: days(10), FinePerDay: amount(1)}})
+	day := (24 * time.Hour).Milliseconds()
+	parallel := func(f func(i int) bool) int {
+		t.Helper()
+		var wg sync.WaitGroup
+		succeeded := make(chan bool, numGoroutines)
+		for i := 0; i < numGoroutines; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				succeeded <- f(i)
+			}(i)
+		}
+		wg.Wait()
+		close(succeeded)
+		count := 0
+		for ok := range succeeded {
+			if ok {
+				count++
 			}
 		}
+		return count
 	}
-	// Add un-returned books to borrow histories
-	my.Borrows = append(my.Borrows, borrowList...)
 
-	// Compare borrow histories
-	bookMap := make(map[int]*database.Book)
-	for _, book := range my.Books {
-		bookMap[book.BookId] = book
-	}
-	// Card_id --> borrow_items
-	expectedBorrowMap := make(map[int][]*database.Borrow)
-	for _, borrow := range my.Borrows {
-		item := borrow
-		if _, ok := expectedBorrowMap[borrow.CardId]; !ok {
-			expectedBorrowMap[borrow.CardId] = []*database.Borrow{}
+	library := utils.CreateLibrary(1, numGoroutines, 0, &server)
+	book, card := library.Books[0], library.Cards[0]
+	assert.Equal(t, server.IncBookStock(book.BookId, 1-book.Stock).Ok, true)
+
+	/* concurrent late returns of the same loan charge one fine */
+	borrow := database.CreateBorrow(card.CardId, book.BookId)
+	borrow.BorrowTime -= 100 * day
+	assert.Equal(t, server.BorrowBook(borrow).Ok, true)
+	borrow.ReturnTime = borrow.BorrowTime + 30*day
+	assert.Equal(t, parallel(func(int) bool { return server.ReturnBook(borrow).Ok }), 1)
+	list := server.ShowFines(card.CardId).Payload.(queries.FineList)
+	assert.Equal(t, list.Count, 1)
+	assert.Equal(t, list.Balance, 20.0)
+
+	/* concurrent payments settle no more than the balance */
+	assert.Equal(t, parallel(func(int) bool {
+		return server.PayFine(database.Ledger{CardId: card.CardId, Amount: 5}).Ok
+	}), 4)
+	list = server.ShowFines(card.CardId).Payload.(queries.FineList)
+	assert.Equal(t, list.Fines[0].Settled, 20.0)
+	assert.Equal(t, len(list.Ledger), 4)
+
+	/* concurrent withdrawals and borrows never withdraw a copy on loan */
+	statuses := func() map[string]int {
+		t.Helper()
+		statuses := make(map[string]int)
+		for _, item := range server.ShowCopies(book.BookId, "").Payload.(queries.CopyList).Copies {
+			statuses[item.Status]++
 		}
-		expectedBorrowMap[borrow.CardId] = append(expectedBorrowMap[borrow.CardId], item)
+		return statuses
 	}
-	for _, list := range expectedBorrowMap {
-		sort.Slice(list, func(i, j int) bool {
-			if list[i].BorrowTime == list[j].BorrowTime {
-				return list[i].BookId < list[j].BookId
+	withdrawnBefore := statuses()[database.CopyWithdrawn]
+	assert.Equal(t, server.IncBookStock(book.BookId, numGoroutines/2-1).Ok, true)
+	withdrawn := parallel(func(i int) bool {
+		if i%2 == 0 {
+			return server.IncBookStock(book.BookId, -1).Ok
+		}
+		server.BorrowBook(database.CreateBorrow(library.Cards[i].CardId, book.BookId)) // counted from the copies below
+		return false
+	})
+	after := statuses()
+	assert.Equal(t, after[database.CopyWithdrawn]-withdrawnBefore, withdrawn)
+	assert.Equal(t, after[database.CopyWithdrawn]-withdrawnBefore+after[database.CopyOnLoan]+after[database.CopyAvailable], numGoroutines/2)
+	onLoan := 0
+	for _, c := range library.Cards {
+		for _, item := range server.ShowBorrowHistories(c.CardId).Payload.(queries.BorrowHistories).Items {
+			if item.ReturnTime == 0 {
+				onLoan++
 			}
-			return list[i].BorrowTime > list[j].BorrowTime
-		})
-	}
-	for _, card := range my.Cards {
-		result := server.ShowBorrowHistories(card.CardId)
-		assert.Equal(t, result.Ok, true)
-		histories := result.Payload.(queries.BorrowHistories).Items
-		expectedList := expectedBorrowMap[card.CardId]
-		assert.Equal(t, len(expectedList), len(histories))
-		for i := 0; i < len(expectedList); i++ {
-			assert.Equal(t, expectedList[i], histories[i])
 		}
 	}
+	assert.Equal(t, after[database.CopyOnLoan], onLoan)
+
+	/* concurrent adds number their copies uniquely */
+	assert.Equal(t, parallel(func(int) bool {
+		return server.AddCopy(&database.Copy{BookId: book.BookId}).Ok
+	}), numGoroutines)
+	assert.Equal(t, server.IncBookStock(book.BookId, 2).Ok, true)
+	assert.Equal(t, server.ShowCopies(book.BookId, "").Payload.(queries.CopyList).Count, withdrawnBefore+numGoroutines/2+numGoroutines+2)
 }
 
-func TestParallelBorrowBook(t *testing.T) {
-	const numGoroutines = 16
+func TestCopies(t *testing.T) {
 	server := Server{}
 	database.ResetDatabase()
 
-	// Insert some books & cards to database
-	library := utils.CreateLibrary(1, numGoroutines, 0, &server)
-	assert.Equal(t, server.IncBookStock(library.Books[0].BookId, -library.Books[0].Stock+1).Ok, true)
-
-	// Create a channel to communicate between goroutines
-	done := make(chan bool)
-	success := make(chan bool, numGoroutines)
-
-	// all goroutines connects to database
-	for i := 0; i < numGoroutines; i++ {
-		go func(i int) {
-			// Each goroutine borrows a book using a different cardId
-			borrow := database.CreateBorrow(library.Cards[i].CardId, 1)
-			result := server.BorrowBook(borrow)
-			if result.Ok {
-				success <- true
-			}
-
-			// Signal that this goroutine is done
-			done <- true
-		}(i)
+	library := utils.CreateLibrary(1, 2, 0, &server)
+	book := library.Books[0]
+	c0, c1 := library.Cards[0], library.Cards[1]
+	assert.Equal(t, server.IncBookStock(book.BookId, 2-book.Stock).Ok, true)
+	stock := func() int {
+		books := server.QueryBooks(queries.BookQueryConditions{}).Payload.(queries.BookQueryResults)
+		return books.Results[0].Stock
 	}
-
-	// Wait for all goroutines to finish
-	for i := 0; i < numGoroutines; i++ {
-		<-done
+	copies := func() []database.Copy {
+		result := server.ShowCopies(book.BookId, "")
+		assert.Equal(t, result.Ok, true)
+		return result.Payload.(queries.CopyList).Copies
 	}
 
-	// Check if only one goroutine has successfully borrowed the book
-	successCount := 0
-	for i := 0; i < numGoroutines; i++ {
-		select {
-		case <-success:
-			successCount++
-		default:
+	// Every copy has a unique barcode, and stock counts the available ones
+	items := copies()
+	available := 0
+	for _, item := range items {
+		assert.NotEqual(t, item.Barcode, "")
+		if item.Status == database.CopyAvailable {
+			available++
 		}
 	}
+	assert.Equal(t, available, 2)
+	assert.Equal(t, stock(), 2)
+
+	// Add a copy with its own barcode
+	extra := database.Copy{BookId: book.BookId, Barcode: "EXTRA-1", Location: "Shelf A"}
+	assert.Equal(t, server.AddCopy(&extra).Ok, true)
+	assert.NotEqual(t, extra.CopyId, 0)
+	assert.Equal(t, stock(), 3)
+	duplicate := database.Copy{BookId: book.BookId, Barcode: "EXTRA-1"}
+	assert.Equal(t, server.AddCopy(&duplicate).Ok, false)
+	assert.Equal(t, server.AddCopy(&database.Copy{BookId: book.BookId + 100}).Ok, false)
+	result := server.ShowCopies(0, "EXTRA-1")
+	assert.Equal(t, result.Ok, true)
+	assert.Equal(t, result.Payload.(queries.CopyList).Copies[0].CopyId, extra.CopyId)
+
+	// Borrow a specific copy
+	r0 := database.CreateBorrow(c0.CardId, book.BookId)
+	r0.CopyId = extra.CopyId
+	assert.Equal(t, server.BorrowBook(r0).Ok, true)
+	assert.Equal(t, stock(), 2)
+	r1 := database.CreateBorrow(c1.CardId, book.BookId)
+	r1.CopyId = extra.CopyId
+	assert.Equal(t, server.BorrowBook(r1).Ok, false)
+
+	// Copies on loan cannot change status, others can
+	assert.Equal(t, server.ModifyCopy(&database.Copy{CopyId: extra.CopyId, Status: database.CopyLost}).Ok, false)
+	assert.Equal(t, server.ModifyCopy(&database.Copy{CopyId: items[0].CopyId, Status: database.CopyOnLoan}).Ok, false)
+	result = server.ModifyCopy(&database.Copy{CopyId: items[0].CopyId, Status: database.CopyInRepair, Condition: "torn"})
+	assert.Equal(t, result.Ok, true)
+	assert.Equal(t, result.Payload.(database.Copy).Condition, "torn")
+	assert.Equal(t, result.Payload.(database.Copy).Barcode, items[0].Barcode)
+	assert.Equal(t, stock(), 1)
+
+	// Withdrawing takes available copies out of stock
+	assert.Equal(t, server.IncBookStock(book.BookId, -2).Ok, false)
+	assert.Equal(t, server.IncBookStock(book.BookId, -1).Ok, true)
+	assert.Equal(t, stock(), 0)
 
-	if successCount != 1 {
-		t.Errorf("Expected 1 goroutine to successfully borrow the book, but got %d", successCount)
+	// The returned copy goes back to stock, and so does a repaired one
+	r0.ResetReturnTime()
+	assert.Equal(t, server.ReturnBook(r0).Ok, true)
+	assert.Equal(t, stock(), 1)
+	assert.Equal(t, server.ModifyCopy(&database.Copy{CopyId: items[0].CopyId, Status: database.CopyAvailable}).Ok, true)
+	assert.Equal(t, stock(), 2)
+	statuses := make(map[string]int)
+	for _, item := range copies() {
+		statuses[item.Status]++
 	}
+	assert.Equal(t, statuses, map[string]int{database.CopyAvailable: 2, database.CopyWithdrawn: max(book.Stock-2, 0) + 1})
 }
 
 func TestRegisterAndShowAndRemoveCard(t *testing.T) {
-	const randomTimes = 20
-	server := Server{}
-	database.ResetDatabase()
-
-	/* simply insert N cards */
-	library := utils.CreateLibrary(1, 100, 0, &server)
+	apitest.RegisterAndShowAndRemoveCard(t, target())
+}
 
-	/* duplicate create */
-	duplicateCard := *library.Cards[rand.Intn(len(library.Cards))]
-	duplicateCard.CardId = 0
-	assert.Equal(t, server.RegisterCard(&duplicateCard).Ok, false)
+func TestErrorCodes(t *testing.T) {
+	apitest.ErrorCodes(t, target())
+}
 
-	/* delete a card that has some un-returned books */
-	delPos := rand.Intn(library.NumCards())
-	delCard := library.Cards[delPos]
-	borrow := database.CreateBorrow(delCard.CardId, library.Books[0].BookId)
-	borrow.ResetBorrowTime()
-	assert.Equal(t, server.BorrowBook(borrow).Ok, true)
-	assert.Equal(t, server.RemoveCard(delCard.CardId).Ok, false)
-	borrow.ResetReturnTime()
-	assert.Equal(t, server.ReturnBook(borrow).Ok, true)
-	assert.Equal(t, server.RemoveCard(delCard.CardId).Ok, true)
-	/* delete a non-exists card */
-	assert.Equal(t, server.RemoveCard(-1).Ok, false)
-	assert.Equal(t, server.RemoveCard(delCard.CardId).Ok, false)
-	// delete this card from library
-	library.Cards = append(library.Cards[:delPos], library.Cards[delPos+1:]...)
-
-	/* randomly delete some cards */
-	rand.Shuffle(len(library.Cards), func(i, j int) {
-		library.Cards[i], library.Cards[j] = library.Cards[j], library.Cards[i]
-	})
-	for i := 0; i < randomTimes; i++ {
-		dCard := library.Cards[0]
-		assert.Equal(t, server.RemoveCard(dCard.CardId).Ok, true)
-		assert.Equal(t, server.RemoveCard(dCard.CardId).Ok, false)
-		library.Cards = library.Cards[1:]
-	}
+func TestPaginateBooks(t *testing.T) {
+	apitest.PaginateBooks(t, target())
+}
 
-	/* check cards */
-	sort.Slice(library.Cards, func(i, j int) bool {
-		return library.Cards[i].CardId < library.Cards[j].CardId
-	})
-	result := server.ShowCards()
-	assert.Equal(t, result.Ok, true)
-	selectedResults := result.Payload.(queries.CardList)
-	assert.Equal(t, len(library.Cards), selectedResults.Count)
-	for i := 0; i < len(library.Cards); i++ {
-		assert.Equal(t, library.Cards[i], selectedResults.Cards[i])
-	}
+func TestSearchBooks(t *testing.T) {
+	apitest.SearchBooks(t, target())
 }
 
-func filter(arr []*database.Book, cond func(*database.Book) bool) []*database.Book {
-	result := []*database.Book{}
-	for _, v := range arr {
-		if cond(v) {
-			result = append(result, v)
-		}
-	}
-	return result
+func TestFacetBooks(t *testing.T) {
+	apitest.FacetBooks(t, target())
 }
 
-func verifyQueryResult(books []*database.Book, conditions queries.BookQueryConditions) []*database.Book {
-	var result []*database.Book
-	result = append(result, books...)
-	if conditions.Category != "" {
-		result = filter(books, func(book *database.Book) bool {
-			return book.Category == conditions.Category
-		})
-	}
-	if conditions.Title != "" {
-		result = filter(result, func(book *database.Book) bool {
-			return strings.Contains(book.Title, conditions.Title)
-		})
-	}
-	if conditions.Press != "" {
-		result = filter(result, func(book *database.Book) bool {
-			return strings.Contains(book.Press, conditions.Press)
-		})
-	}
-	if conditions.MinPublishYear != 0 {
-		result = filter(result, func(book *database.Book) bool {
-			return book.PublishYear >= conditions.MinPublishYear
-		})
-	}
-	if conditions.MaxPublishYear != 0 {
-		result = filter(result, func(book *database.Book) bool {
-			return book.PublishYear <= conditions.MaxPublishYear
-		})
-	}
-	if conditions.Author != "" {
-		result = filter(result, func(book *database.Book) bool {
-			return strings.Contains(book.Author, conditions.Author)
-		})
-	}
-	if conditions.MinPrice != 0 {
-		result = filter(result, func(book *database.Book) bool {
-			return book.Price >= conditions.MinPrice
-		})
-	}
-	if conditions.MaxPrice != 0 {
-		result = filter(result, func(book *database.Book) bool {
-			return book.Price <= conditions.MaxPrice
-		})
-	}
+func TestFilterAuthors(t *testing.T) {
+	apitest.FilterAuthors(t, target())
+}
 
-	sortBy := queries.BookId
-	if conditions.SortBy != "" {
-		sortBy = conditions.SortBy
-	}
-	cmp := queries.BookComparator(queries.GetComparator(sortBy))
-	if conditions.SortOrder == queries.Desc {
-		cmp = cmp.Reverse()
-	}
-	cmp = cmp.ThenByIdAsc()
-	slices.SortFunc(result, cmp)
-	return result
+func TestSearchBooksWithoutIndex(t *testing.T) {
+	// searched with like, as on a database without a full-text index
+	search := database.Search
+	database.Search = database.SearchNone
+	defer func() { database.Search = search }()
+	apitest.SearchBooks(t, target())
 }
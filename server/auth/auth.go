@@ -0,0 +1,137 @@
+// Package auth signs and verifies the tokens issued to library accounts,
+// and hashes their passwords.
+//
+// Tokens are JSON Web Tokens signed with HMAC-SHA256, carrying the identity
+// and the role of a request. The server still checks them against the account
+// on each request, so that a token is revoked with its account.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	DefaultTokenHours = 12
+	MinPasswordLength = 8
+)
+
+// DummyHash is checked against when logging in to an account that does not exist,
+// so that it takes as long as a wrong password and does not tell which usernames exist
+const DummyHash = "$2a$10$10v4/VOFJfxC2MGmy2MA6./mGS8W0VrBTu0JuB2xqmOJ68J0jvEQC"
+
+// header of all tokens, {"alg":"HS256","typ":"JWT"}
+var header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+var (
+	ErrMalformedToken = errors.New("malformed token")
+	ErrInvalidToken   = errors.New("invalid token signature")
+	ErrExpiredToken   = errors.New("token expired")
+)
+
+// Config is the auth section in config.yaml
+type Config struct {
+	Secret     string `yaml:"secret"`      // key signing the tokens, random on each start if empty
+	TokenHours int    `yaml:"token_hours"` // how long a token is valid
+	Admin      struct {
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+	} `yaml:"admin"` // the account created when the library has no admin
+}
+
+// Claims is the identity carried by a token
+type Claims struct {
+	AccountId int    `json:"sub"`
+	Username  string `json:"name"`
+	Role      string `json:"role"`
+	CardId    int    `json:"card_id,omitempty"` // the card of a patron
+	IssuedAt  int64  `json:"iat"`               // in seconds, as JWT
+	ExpiresAt int64  `json:"exp"`               // in seconds, as JWT
+}
+
+type Auth struct {
+	config Config
+	secret []byte
+}
+
+func New(config Config) Auth {
+	if config.TokenHours <= 0 {
+		config.TokenHours = DefaultTokenHours
+	}
+	secret := []byte(config.Secret)
+	if len(secret) == 0 {
+		logrus.Warn("auth secret is not configured, tokens will be invalid after restarting")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			logrus.WithError(err).Panic("failed to generate auth secret")
+		}
+	}
+	return Auth{config: config, secret: secret}
+}
+
+// Admin returns the username and the password of the initial admin
+func (a Auth) Admin() (string, string) {
+	return a.config.Admin.Username, a.config.Admin.Password
+}
+
+// Sign issues a token of the claims, which expires after the configured hours
+//
+// @return the token, and the claims with the issuing and expiry time
+func (a Auth) Sign(claims Claims, now time.Time) (string, Claims) {
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(time.Duration(a.config.TokenHours) * time.Hour).Unix()
+	payload, _ := json.Marshal(claims)
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + a.signature(unsigned), claims
+}
+
+// Verify checks the signature and the expiry time of a token
+//
+// @return the claims of the token
+func (a Auth) Verify(token string, now time.Time) (Claims, error) {
+	claims := Claims{}
+	if len(a.secret) == 0 { // not configured by New
+		return claims, ErrInvalidToken
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != header {
+		return claims, ErrMalformedToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(a.signature(parts[0]+"."+parts[1]))) {
+		return claims, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(payload, &claims) != nil {
+		return claims, ErrMalformedToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return claims, ErrExpiredToken
+	}
+	return claims, nil
+}
+
+func (a Auth) signature(unsigned string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// HashPassword returns the bcrypt hash of a password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// CheckPassword tells whether the password matches the bcrypt hash
+func CheckPassword(hash string, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"library-management-system/database"
+	"library-management-system/server/auth"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// permission of a route, from the least to the most privileged
+type permission int
+
+const (
+	public    permission = iota // anyone, even without logging in
+	loggedIn                    // any account
+	self                        // patrons on the card of their account, see {@link selfCard}
+	ownCard                     // patrons on their own card, and the staff
+	staff                       // librarians and admins
+	adminOnly                   // admins
+)
+
+// identityKey is the key of the claims of the token in the request context
+type identityKey struct{}
+
+// identity returns the claims of the account sending the request,
+// or false for a public route requested without logging in
+func identity(r *http.Request) (auth.Claims, bool) {
+	claims, ok := r.Context().Value(identityKey{}).(auth.Claims)
+	return claims, ok
+}
+
+// authorize checks the token in the Authorization header against the
+// permission of the route before calling next, and answers 401 without
+// a valid token, or if the account was removed or changed since the token
+// was issued, and 403 if the role of the account is not permitted.
+//
+// the card of an ownCard route is the id of the path, or the card_id
+// parameter of the query.
+func authorize(p permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		server := Server{}
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || token == "" {
+			if p == public {
+				next(w, r)
+				return
+			}
+			server.ResponseStatus(w, database.APIResult{
+				Ok:      false,
+				Message: "Unauthorized: please log in",
+				Payload: nil,
+				Code:    database.ErrUnauthorized,
+			}, 0)
+			return
+		}
+		claims, err := Auth.Verify(token, time.Now())
+		if err != nil {
+			server.ResponseStatus(w, database.APIResult{
+				Ok:      false,
+				Message: "Unauthorized: " + err.Error() + ", please log in again",
+				Payload: nil,
+				Code:    database.ErrUnauthorized,
+			}, 0)
+			return
+		}
+		if current, err := issuedTo(claims); err != nil {
+			logrus.WithError(err).Error("failed to check account")
+			server.ResponseStatus(w, database.APIResult{
+				Ok:      false,
+				Message: "Failed to check account",
+				Payload: nil,
+				Code:    database.ErrInternal,
+			}, 0)
+			return
+		} else if !current {
+			server.ResponseStatus(w, database.APIResult{
+				Ok:      false,
+				Message: "Unauthorized: the account was removed or changed, please log in again",
+				Payload: nil,
+				Code:    database.ErrUnauthorized,
+			}, 0)
+			return
+		}
+
+		if !permitted(p, claims, r) {
+			server.ResponseStatus(w, database.APIResult{
+				Ok:      false,
+				Message: "Forbidden: " + claims.Role + " " + claims.Username + " is not permitted to " + r.Method + " " + r.URL.Path,
+				Payload: nil,
+				Code:    database.ErrForbidden,
+			}, 0)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, claims)))
+	}
+}
+
+// issuedTo tells whether the account of the claims still exists with the same
+// username, role and card, so that a token is revoked with its account or card
+func issuedTo(claims auth.Claims) (bool, error) {
+	account := database.Account{}
+	result := database.DB.Where("account_id = ?", claims.AccountId).Limit(1).Find(&account)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected != 0 && account.Username == claims.Username &&
+		account.Role == claims.Role && account.CardId == claims.CardId, nil
+}
+
+// permitted tells whether the account of the claims has the permission on the request
+func permitted(p permission, claims auth.Claims, r *http.Request) bool {
+	if p == self { // the staff have no card of their own
+		return claims.Role == database.AccountPatron && claims.CardId != 0
+	}
+	switch claims.Role {
+	case database.AccountAdmin:
+		return true
+	case database.AccountLibrarian:
+		return p <= staff
+	case database.AccountPatron:
+		if p == ownCard {
+			cardId := r.PathValue("id")
+			if cardId == "" {
+				cardId = r.URL.Query().Get("card_id")
+			}
+			return cardId == strconv.Itoa(claims.CardId)
+		}
+		return p <= self
+	default:
+		return false
+	}
+}
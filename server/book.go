@@ -5,13 +5,11 @@ import (
 	"library-management-system/database"
 	"library-management-system/server/queries"
 	"net/http"
+	"net/url"
 	"strconv"
 )
 
 func storeBookHandler(w http.ResponseWriter, r *http.Request) {
-	// Lock Mutex
-	Mutex.Lock()
-	defer Mutex.Unlock()
 	server := Server{}
 
 	// Parse request body
@@ -22,6 +20,7 @@ func storeBookHandler(w http.ResponseWriter, r *http.Request) {
 			Ok:      false,
 			Message: "Invalid Arguments: failed to parse request body",
 			Payload: nil,
+			Code:    database.ErrInvalidArgument,
 		})
 		return
 	}
@@ -32,9 +31,6 @@ func storeBookHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func storeBooksHandler(w http.ResponseWriter, r *http.Request) {
-	// Lock Mutex
-	Mutex.Lock()
-	defer Mutex.Unlock()
 	server := Server{}
 
 	// Parse request body
@@ -45,6 +41,7 @@ func storeBooksHandler(w http.ResponseWriter, r *http.Request) {
 			Ok:      false,
 			Message: "Invalid Arguments: failed to parse request body",
 			Payload: nil,
+			Code:    database.ErrInvalidArgument,
 		})
 		return
 	}
@@ -59,10 +56,6 @@ func storeBooksHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func incBookStockHandler(w http.ResponseWriter, r *http.Request) {
-	// Lock Mutex
-	Mutex.Lock()
-	defer Mutex.Unlock()
-
 	// Parse request body
 	server := Server{}
 	type IncStockQuery struct {
@@ -76,6 +69,7 @@ func incBookStockHandler(w http.ResponseWriter, r *http.Request) {
 			Ok:      false,
 			Message: "Invalid Arguments: failed to parse request body",
 			Payload: nil,
+			Code:    database.ErrInvalidArgument,
 		})
 		return
 	}
@@ -86,10 +80,6 @@ func incBookStockHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func modifyBookHandler(w http.ResponseWriter, r *http.Request) {
-	// Lock Mutex
-	Mutex.Lock()
-	defer Mutex.Unlock()
-
 	// Parse request body
 	server := Server{}
 	var book database.Book
@@ -99,6 +89,7 @@ func modifyBookHandler(w http.ResponseWriter, r *http.Request) {
 			Ok:      false,
 			Message: "Invalid Arguments: failed to parse request body",
 			Payload: nil,
+			Code:    database.ErrInvalidArgument,
 		})
 		return
 	}
@@ -109,9 +100,6 @@ func modifyBookHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func removeBookHandler(w http.ResponseWriter, r *http.Request) {
-	Mutex.Lock()
-	defer Mutex.Unlock()
-
 	server := Server{}
 	params := r.URL.Query()
 	bookIdStr := params.Get("book_id")
@@ -122,6 +110,7 @@ func removeBookHandler(w http.ResponseWriter, r *http.Request) {
 			Ok:      false,
 			Message: "Invalid Arguments: failed to parse request parameter, expect positive integer",
 			Payload: nil,
+			Code:    database.ErrInvalidArgument,
 		})
 		return
 	}
@@ -130,17 +119,22 @@ func removeBookHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func queryBookHandler(w http.ResponseWriter, r *http.Request) {
-	Mutex.Lock()
-	defer Mutex.Unlock()
-
 	server := Server{}
-	params := r.URL.Query()
+	result := server.QueryBooks(bookQueryConditions(r.URL.Query()))
+	server.Response(w, result)
+}
 
+// bookQueryConditions parses the conditions of a book query from the request parameters,
+// ignoring numbers and flags that fail to parse. a list is given by repeating its parameter,
+// eg: categories=Novel&categories=Horror
+func bookQueryConditions(params url.Values) queries.BookQueryConditions {
 	var err error
 	var minPublishYear int
 	var maxPublishYear int
 	var minPrice float64
 	var maxPrice float64
+	var limit int
+	var offset int
 	if minPublishYear, err = strconv.Atoi(params.Get("min_publish_year")); err != nil {
 		minPublishYear = 0
 	}
@@ -153,18 +147,88 @@ func queryBookHandler(w http.ResponseWriter, r *http.Request) {
 	if maxPrice, err = strconv.ParseFloat(params.Get("max_price"), 64); err != nil {
 		maxPrice = 0
 	}
-	condition := queries.BookQueryConditions{
-		Category:       params.Get("category"),
-		Title:          params.Get("title"),
-		Press:          params.Get("press"),
-		MinPublishYear: minPublishYear,
-		MaxPublishYear: maxPublishYear,
-		Author:         params.Get("author"),
-		MinPrice:       minPrice,
-		MaxPrice:       maxPrice,
-		SortBy:         queries.SortColumn(params.Get("sort_by")),
-		SortOrder:      queries.Order(params.Get("sort_order")),
-	}
-	result := server.QueryBooks(condition)
+	if limit, err = strconv.Atoi(params.Get("limit")); err != nil {
+		limit = 0
+	}
+	if offset, err = strconv.Atoi(params.Get("offset")); err != nil {
+		offset = 0
+	}
+	inStock, _ := strconv.ParseBool(params.Get("in_stock"))
+	facets, _ := strconv.ParseBool(params.Get("facets"))
+	return queries.BookQueryConditions{
+		Q:                 params.Get("q"),
+		Category:          params.Get("category"),
+		Title:             params.Get("title"),
+		Press:             params.Get("press"),
+		MinPublishYear:    minPublishYear,
+		MaxPublishYear:    maxPublishYear,
+		Author:            params.Get("author"),
+		Contributor:       params.Get("contributor"),
+		Role:              params.Get("role"),
+		ISBN:              params.Get("isbn"),
+		MinPrice:          minPrice,
+		MaxPrice:          maxPrice,
+		Match:             queries.MatchMode(params.Get("match")),
+		Categories:        params["categories"],
+		Presses:           params["presses"],
+		Authors:           params["authors"],
+		ExcludeCategories: params["exclude_categories"],
+		ExcludePresses:    params["exclude_presses"],
+		ExcludeAuthors:    params["exclude_authors"],
+		InStock:           inStock,
+		SortBy:            queries.SortColumn(params.Get("sort_by")),
+		SortOrder:         queries.Order(params.Get("sort_order")),
+		Limit:             limit,
+		Offset:            offset,
+		Cursor:            params.Get("cursor"),
+		Facets:            facets,
+	}
+}
+
+func queryBookByISBNHandler(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	result := server.QueryBookByISBN(r.PathValue("isbn"))
+	server.Response(w, result)
+}
+
+func modifyContributorsHandler(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+
+	// Parse request body
+	var request struct {
+		BookId       int                       `json:"book_id"`
+		Contributors []queries.ContributorItem `json:"contributors"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		server.Response(w, database.APIResult{
+			Ok:      false,
+			Message: "Invalid Arguments: failed to parse request body",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		})
+		return
+	}
+
+	// Modify contributors
+	result := server.ModifyContributors(request.BookId, request.Contributors)
+	server.Response(w, result)
+}
+
+func showContributorsHandler(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	params := r.URL.Query()
+	var err error
+	var bookId int
+	if bookId, err = strconv.Atoi(params.Get("book_id")); err != nil || bookId <= 0 {
+		server.Response(w, database.APIResult{
+			Ok:      false,
+			Message: "Invalid Arguments: failed to parse request parameter, expect positive integer",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		})
+		return
+	}
+	result := server.ShowContributors(bookId)
 	server.Response(w, result)
 }
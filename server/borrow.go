@@ -3,14 +3,14 @@ package server
 import (
 	"encoding/json"
 	"library-management-system/database"
+	"library-management-system/server/queries"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 )
 
 func showBorrowsHandler(w http.ResponseWriter, r *http.Request) {
-	Mutex.Lock()
-	defer Mutex.Unlock()
-
 	server := Server{}
 	params := r.URL.Query()
 	cardIdStr := params.Get("card_id")
@@ -21,6 +21,7 @@ func showBorrowsHandler(w http.ResponseWriter, r *http.Request) {
 			Ok:      false,
 			Message: "Invalid Arguments: failed to parse request parameter, expect positive integer",
 			Payload: nil,
+			Code:    database.ErrInvalidArgument,
 		})
 		return
 	}
@@ -28,24 +29,55 @@ func showBorrowsHandler(w http.ResponseWriter, r *http.Request) {
 	server.Response(w, result)
 }
 
-func borrowBookHandler(w http.ResponseWriter, r *http.Request) {
-	// Lock Mutex
-	Mutex.Lock()
-	defer Mutex.Unlock()
+// borrowRequest is a borrow with the barcode of the copy scanned at the desk
+type borrowRequest struct {
+	database.Borrow
+	Barcode string `json:"barcode"` // optional
+}
 
+// resolve returns the borrow of the copy with the barcode,
+// or the failure if no copy has the barcode
+func (request borrowRequest) resolve(server *Server) (database.Borrow, *database.APIResult) {
+	borrow := request.Borrow
+	if request.Barcode == "" {
+		return borrow, nil
+	}
+	copies := server.ShowCopies(0, request.Barcode)
+	if !copies.Ok || copies.Payload.(queries.CopyList).Count == 0 {
+		return borrow, &database.APIResult{
+			Ok:      false,
+			Message: "Invalid Arguments: copy with barcode " + request.Barcode + " does not exist",
+			Payload: nil,
+			Code:    database.ErrCopyNotFound,
+		}
+	}
+	copy := copies.Payload.(queries.CopyList).Copies[0]
+	borrow.BookId, borrow.CopyId = copy.BookId, copy.CopyId
+	return borrow, nil
+}
+
+func borrowBookHandler(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
 	server := Server{}
-	var borrow database.Borrow
-	err := json.NewDecoder(r.Body).Decode(&borrow)
+	var request borrowRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
 		server.Response(w, database.APIResult{
 			Ok:      false,
 			Message: "Invalid Arguments: failed to parse request body",
 			Payload: nil,
+			Code:    database.ErrInvalidArgument,
 		})
 		return
 	}
 
+	// Resolve the copy by barcode
+	borrow, failure := request.resolve(&server)
+	if failure != nil {
+		server.Response(w, *failure)
+		return
+	}
+
 	// Borrow book
 	borrow.ReturnTime = 0 // make sure ReturnTime is 0
 	result := server.BorrowBook(borrow)
@@ -53,10 +85,6 @@ func borrowBookHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func returnBookHandler(w http.ResponseWriter, r *http.Request) {
-	// Lock Mutex
-	Mutex.Lock()
-	defer Mutex.Unlock()
-
 	// Parse request body
 	server := Server{}
 	var borrow database.Borrow
@@ -66,6 +94,7 @@ func returnBookHandler(w http.ResponseWriter, r *http.Request) {
 			Ok:      false,
 			Message: "Invalid Arguments: failed to parse request body",
 			Payload: nil,
+			Code:    database.ErrInvalidArgument,
 		})
 		return
 	}
@@ -77,3 +106,62 @@ func returnBookHandler(w http.ResponseWriter, r *http.Request) {
 	result := server.ReturnBook(borrow)
 	server.Response(w, result)
 }
+
+func renewBookHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	server := Server{}
+	var borrow database.Borrow
+	err := json.NewDecoder(r.Body).Decode(&borrow)
+	if err != nil {
+		server.Response(w, database.APIResult{
+			Ok:      false,
+			Message: "Invalid Arguments: failed to parse request body",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		})
+		return
+	}
+
+	// Renew book
+	result := server.RenewBorrow(borrow)
+	server.Response(w, result)
+}
+
+func showOverdueHandler(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	result := server.ShowOverdueBorrows(time.Now().UnixMilli())
+	server.Response(w, result)
+}
+
+func searchBorrowsHandler(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	result := server.SearchBorrows(borrowQueryConditions(r.URL.Query()))
+	server.Response(w, result)
+}
+
+// borrowQueryConditions parses the conditions of a borrow search from the request parameters,
+// ignoring numbers that fail to parse
+func borrowQueryConditions(params url.Values) queries.BorrowQueryConditions {
+	number := func(key string) int64 {
+		n, err := strconv.ParseInt(params.Get(key), 10, 64)
+		if err != nil {
+			return 0
+		}
+		return n
+	}
+	return queries.BorrowQueryConditions{
+		BookId:        int(number("book_id")),
+		CardId:        int(number("card_id")),
+		Department:    params.Get("department"),
+		CardType:      params.Get("card_type"),
+		Status:        queries.BorrowStatus(params.Get("status")),
+		MinBorrowTime: number("min_borrow_time"),
+		MaxBorrowTime: number("max_borrow_time"),
+		MinReturnTime: number("min_return_time"),
+		MaxReturnTime: number("max_return_time"),
+		SortBy:        queries.BorrowSortColumn(params.Get("sort_by")),
+		SortOrder:     queries.Order(params.Get("sort_order")),
+		Limit:         int(number("limit")),
+		Offset:        int(number("offset")),
+	}
+}
@@ -8,18 +8,12 @@ import (
 )
 
 func showCardsHandler(w http.ResponseWriter, r *http.Request) {
-	Mutex.Lock()
-	defer Mutex.Unlock()
-
 	server := Server{}
 	result := server.ShowCards()
 	server.Response(w, result)
 }
 
 func registerCardHandler(w http.ResponseWriter, r *http.Request) {
-	Mutex.Lock()
-	defer Mutex.Unlock()
-
 	server := Server{}
 	var cardData database.Card
 	if err := json.NewDecoder(r.Body).Decode(&cardData); err != nil {
@@ -27,6 +21,7 @@ func registerCardHandler(w http.ResponseWriter, r *http.Request) {
 			Ok:      false,
 			Message: "Invalid Arguments: failed to parse request body",
 			Payload: nil,
+			Code:    database.ErrInvalidArgument,
 		})
 		return
 	}
@@ -36,9 +31,6 @@ func registerCardHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func removeCardHandler(w http.ResponseWriter, r *http.Request) {
-	Mutex.Lock()
-	defer Mutex.Unlock()
-
 	server := Server{}
 
 	params := r.URL.Query()
@@ -50,6 +42,7 @@ func removeCardHandler(w http.ResponseWriter, r *http.Request) {
 			Ok:      false,
 			Message: "Invalid Arguments: failed to parse request parameter, expect positive integer",
 			Payload: nil,
+			Code:    database.ErrInvalidArgument,
 		})
 		return
 	}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"library-management-system/database"
+	"net/http"
+	"strconv"
+)
+
+func addCopyHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	server := Server{}
+	var copy database.Copy
+	err := json.NewDecoder(r.Body).Decode(&copy)
+	if err != nil {
+		server.Response(w, database.APIResult{
+			Ok:      false,
+			Message: "Invalid Arguments: failed to parse request body",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		})
+		return
+	}
+
+	// Add copy
+	result := server.AddCopy(&copy)
+	server.Response(w, result)
+}
+
+func modifyCopyHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	server := Server{}
+	var copy database.Copy
+	err := json.NewDecoder(r.Body).Decode(&copy)
+	if err != nil {
+		server.Response(w, database.APIResult{
+			Ok:      false,
+			Message: "Invalid Arguments: failed to parse request body",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		})
+		return
+	}
+
+	// Modify copy
+	result := server.ModifyCopy(&copy)
+	server.Response(w, result)
+}
+
+func showCopiesHandler(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	params := r.URL.Query()
+	var err error
+	var bookId int
+	if params.Has("book_id") {
+		if bookId, err = strconv.Atoi(params.Get("book_id")); err != nil || bookId <= 0 {
+			server.Response(w, database.APIResult{
+				Ok:      false,
+				Message: "Invalid Arguments: failed to parse request parameter, expect positive integer",
+				Payload: nil,
+				Code:    database.ErrInvalidArgument,
+			})
+			return
+		}
+	}
+	barcode := params.Get("barcode")
+	if bookId == 0 && barcode == "" {
+		server.Response(w, database.APIResult{
+			Ok:      false,
+			Message: "Invalid Arguments: expect book_id or barcode",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		})
+		return
+	}
+	result := server.ShowCopies(bookId, barcode)
+	server.Response(w, result)
+}
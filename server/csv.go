@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"library-management-system/database"
+	"library-management-system/server/csvio"
+	"library-management-system/server/marc"
+	"library-management-system/server/queries"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const maxImportSize = 32 << 20 // bytes of the CSV of an import
+
+// importHandler imports the CSV of the request body by import, with the options
+// of the request parameters, responding as {@link respond}
+func importHandler(imports func(s *Server, r io.Reader, options queries.ImportOptions) database.APIResult, status bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		server := Server{}
+		options, err := importOptions(r.URL.Query())
+		if err != nil {
+			server.respond(w, badRequest(err.Error()), status)
+			return
+		}
+		server.respond(w, imports(&server, http.MaxBytesReader(w, r.Body, maxImportSize), options), status)
+	}
+}
+
+// importOptions parses the options of an import from the request parameters.
+// a header is mapped to a column by repeating columns, eg: columns=Publisher=press&columns=Notes=
+func importOptions(params url.Values) (queries.ImportOptions, error) {
+	options := queries.ImportOptions{
+		Mode:    queries.ImportMode(params.Get("mode")),
+		Columns: make(map[string]string),
+	}
+	if params.Has("dry_run") {
+		dryRun, err := strconv.ParseBool(params.Get("dry_run"))
+		if err != nil {
+			return options, errors.New("dry_run is not a boolean")
+		}
+		options.DryRun = dryRun
+	}
+	for _, mapping := range params["columns"] {
+		name, column, ok := strings.Cut(mapping, "=")
+		if !ok {
+			return options, fmt.Errorf("invalid columns %q, expect Header=column", mapping)
+		}
+		options.Columns[name] = column
+	}
+	return options, nil
+}
+
+// exportBooksHandler responds the books matching the conditions of the request parameters
+// as CSV, see {@link csvio.WriteBooks}, or as MARC21 records if asked by format=marc|marcxml,
+// see {@link marc.FromBook}, whose category is in the field given by category_field
+func exportBooksHandler(status bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		server := Server{}
+		params := r.URL.Query()
+		format := cmp.Or(params.Get("format"), "csv")
+		if format != "csv" && !slices.Contains(queries.MARCFormats, queries.MARCFormat(format)) {
+			server.respond(w, badRequest("invalid format, expect csv, marc or marcxml"), status)
+			return
+		}
+		mapping, err := marcMapping(params.Get("category_field"))
+		if err != nil {
+			server.respond(w, badRequest(err.Error()), status)
+			return
+		}
+		result := server.QueryBooks(bookQueryConditions(params))
+		if !result.Ok {
+			server.respond(w, result, status)
+			return
+		}
+		books := result.Payload.(queries.BookQueryResults).Results
+		switch queries.MARCFormat(format) {
+		case queries.ISO2709:
+			writeFile(w, "books.mrc", "application/marc", func(b *bytes.Buffer) error {
+				return marc.WriteRecords(b, marcRecords(books, mapping))
+			})
+		case queries.MARCXML:
+			writeFile(w, "books.xml", "application/marcxml+xml", func(b *bytes.Buffer) error {
+				return marc.WriteXML(b, marcRecords(books, mapping))
+			})
+		default:
+			writeFile(w, "books.csv", "text/csv; charset=utf-8", func(b *bytes.Buffer) error {
+				return csvio.WriteBooks(b, books)
+			})
+		}
+	}
+}
+
+// exportCardsHandler responds all cards as CSV, see {@link csvio.WriteCards}
+func exportCardsHandler(status bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		server := Server{}
+		result := server.ShowCards()
+		if !result.Ok {
+			server.respond(w, result, status)
+			return
+		}
+		writeFile(w, "cards.csv", "text/csv; charset=utf-8", func(b *bytes.Buffer) error {
+			return csvio.WriteCards(b, result.Payload.(queries.CardList).Cards)
+		})
+	}
+}
+
+// writeFile responds the file written by write as an attachment
+func writeFile(w http.ResponseWriter, filename string, contentType string, write func(b *bytes.Buffer) error) {
+	var b bytes.Buffer
+	if err := write(&b); err != nil {
+		logrus.WithError(err).Error("failed to export " + filename)
+		server := Server{}
+		server.ResponseStatus(w, database.APIResult{
+			Ok:      false,
+			Message: "Failed to export " + filename,
+			Payload: nil,
+			Code:    database.ErrInternal,
+		}, 0)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if _, err := w.Write(b.Bytes()); err != nil {
+		logrus.WithError(err).Error("unable to response")
+	}
+}
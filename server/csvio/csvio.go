@@ -0,0 +1,188 @@
+// Package csvio reads and writes books and cards as CSV with a header row.
+package csvio
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"library-management-system/database"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Columns of the CSV of books and cards, in the order they are written.
+// the id is written for reference, and ignored when reading.
+var (
+	BookColumns = []string{"book_id", "category", "title", "press", "publish_year", "author", "price", "stock", "isbn"}
+	CardColumns = []string{"card_id", "name", "department", "type"}
+)
+
+var (
+	bookRequired = []string{"category", "title", "press", "publish_year", "author", "price"}
+	cardRequired = []string{"name", "department", "type"}
+)
+
+const maxLength = 63 // of the text columns in the database
+
+// Row is a row of the CSV by column
+type Row map[string]string
+
+// Reader reads the rows of a CSV, whose header names are mapped to columns
+type Reader struct {
+	csv     *csv.Reader
+	columns []string // of each field, empty if the field is ignored
+}
+
+// NewBookReader reads the header of the CSV of books, and maps its names to BookColumns,
+// or to other columns by the mapping from header names. a header mapped to "" is ignored.
+func NewBookReader(r io.Reader, mapping map[string]string) (*Reader, error) {
+	return newReader(r, BookColumns, bookRequired, mapping)
+}
+
+// NewCardReader reads the header of the CSV of cards, as NewBookReader
+func NewCardReader(r io.Reader, mapping map[string]string) (*Reader, error) {
+	return newReader(r, CardColumns, cardRequired, mapping)
+}
+
+func newReader(r io.Reader, known []string, required []string, mapping map[string]string) (*Reader, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the CSV is empty, expect a header")
+	} else if err != nil {
+		return nil, err
+	}
+	header[0] = strings.TrimPrefix(header[0], "\ufeff") // byte order mark of spreadsheets
+
+	columns := make([]string, len(header))
+	for i, name := range header {
+		column, ok := mapping[name]
+		if !ok {
+			column = strings.ToLower(strings.TrimSpace(name))
+		}
+		if column != "" && !slices.Contains(known, column) {
+			return nil, fmt.Errorf("unknown column %q in the header, expect %s", name, strings.Join(known, ", "))
+		}
+		if column != "" && slices.Contains(columns, column) {
+			return nil, fmt.Errorf("column %s is given twice in the header", column)
+		}
+		columns[i] = column
+	}
+	for _, column := range required {
+		if !slices.Contains(columns, column) {
+			return nil, fmt.Errorf("column %s is missing in the header", column)
+		}
+	}
+	return &Reader{csv: reader, columns: columns}, nil
+}
+
+// Read returns the next row and its line in the CSV, or io.EOF after the last row.
+// a malformed row, such as one with a wrong number of fields or a bare quote,
+// is returned with its line and a *csv.ParseError, and the next row can be read.
+func (r *Reader) Read() (Row, int, error) {
+	record, err := r.csv.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, parseErr.StartLine, err
+	} else if err != nil {
+		return nil, 0, err
+	}
+	line, _ := r.csv.FieldPos(0)
+	row := make(Row, len(record))
+	for i, value := range record {
+		if r.columns[i] != "" {
+			row[r.columns[i]] = strings.TrimSpace(value)
+		}
+	}
+	return row, line, nil
+}
+
+// Book parses the book of a row
+func (row Row) Book() (*database.Book, error) {
+	book := database.Book{}
+	var err error
+	for _, text := range []struct {
+		column string
+		value  *string
+	}{
+		{"category", &book.Category}, {"title", &book.Title}, {"press", &book.Press}, {"author", &book.Author},
+	} {
+		if *text.value, err = row.text(text.column); err != nil {
+			return nil, err
+		}
+	}
+	if book.PublishYear, err = strconv.Atoi(row["publish_year"]); err != nil {
+		return nil, fmt.Errorf("publish_year %q is not an integer", row["publish_year"])
+	}
+	if book.Price, err = strconv.ParseFloat(row["price"], 64); err != nil || book.Price < 0 {
+		return nil, fmt.Errorf("price %q is not a non-negative number", row["price"])
+	}
+	if row["stock"] != "" {
+		if book.Stock, err = strconv.Atoi(row["stock"]); err != nil || book.Stock < 0 {
+			return nil, fmt.Errorf("stock %q is not a non-negative integer", row["stock"])
+		}
+	}
+	if row["isbn"] != "" {
+		if book.ISBN, err = database.NormalizeISBN(row["isbn"]); err != nil {
+			return nil, err
+		}
+	}
+	return &book, nil
+}
+
+// Card parses the card of a row
+func (row Row) Card() (*database.Card, error) {
+	card := database.Card{}
+	var err error
+	if card.Name, err = row.text("name"); err != nil {
+		return nil, err
+	}
+	if card.Department, err = row.text("department"); err != nil {
+		return nil, err
+	}
+	if card.Type = strings.ToUpper(row["type"]); card.Type != "T" && card.Type != "S" {
+		return nil, fmt.Errorf("type %q is neither T nor S", row["type"])
+	}
+	return &card, nil
+}
+
+// text returns the value of a required text column
+func (row Row) text(column string) (string, error) {
+	value := row[column]
+	if value == "" {
+		return "", fmt.Errorf("%s is empty", column)
+	}
+	if utf8.RuneCountInString(value) > maxLength {
+		return "", fmt.Errorf("%s is longer than %d characters", column, maxLength)
+	}
+	return value, nil
+}
+
+// WriteBooks writes the books as CSV with the header of BookColumns
+func WriteBooks(w io.Writer, books []database.Book) error {
+	writer := csv.NewWriter(w)
+	_ = writer.Write(BookColumns)
+	for _, book := range books {
+		_ = writer.Write([]string{
+			strconv.Itoa(book.BookId), book.Category, book.Title, book.Press, strconv.Itoa(book.PublishYear),
+			book.Author, strconv.FormatFloat(book.Price, 'f', 2, 64), strconv.Itoa(book.Stock), book.ISBN,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteCards writes the cards as CSV with the header of CardColumns
+func WriteCards(w io.Writer, cards []database.Card) error {
+	writer := csv.NewWriter(w)
+	_ = writer.Write(CardColumns)
+	for _, card := range cards {
+		_ = writer.Write([]string{strconv.Itoa(card.CardId), card.Name, card.Department, card.Type})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"library-management-system/database"
+	"library-management-system/server/queries"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// bookFacets counts the books of the query by category, press, author,
+// publish year and price, each with one grouped query
+func bookFacets(query *gorm.DB) (*queries.Facets, error) {
+	facets := queries.Facets{
+		Category:    make([]queries.FacetCount, 0),
+		Press:       make([]queries.FacetCount, 0),
+		Author:      make([]queries.FacetCount, 0),
+		PublishYear: make([]queries.FacetCount, 0),
+		Price:       make([]queries.FacetCount, 0),
+	}
+	mostFrequent := "count desc, value asc"
+
+	// Values of the columns
+	for column, facet := range map[string]*[]queries.FacetCount{"category": &facets.Category, "press": &facets.Press} {
+		if err := query.Select(column + " as value, count(*) as count").
+			Group(column).
+			Order(mostFrequent).
+			Limit(queries.MaxFacetValues).
+			Scan(facet).Error; err != nil {
+			return nil, err
+		}
+	}
+	// Authors by their credits, so that a book of several authors counts for each
+	if err := database.DB.Model(&database.Credit{}).
+		Select("contributors.name as value, count(*) as count").
+		Joins("join contributors on contributors.contributor_id = credits.contributor_id").
+		Where("credits.role = ? and credits.book_id in (?)", database.RoleAuthor, query.Select("book_id")).
+		Group("contributors.name").
+		Order(mostFrequent).
+		Limit(queries.MaxFacetValues).
+		Scan(&facets.Author).Error; err != nil {
+		return nil, err
+	}
+
+	// Buckets of publish years and prices
+	type bucket struct {
+		Bucket int
+		Count  int
+	}
+	years := make([]bucket, 0)
+	if err := query.Select(fmt.Sprintf("publish_year - publish_year %% %d as bucket, count(*) as count", queries.YearBucketSize)).
+		Group("bucket").
+		Order("bucket asc").
+		Scan(&years).Error; err != nil {
+		return nil, err
+	}
+	for _, year := range years {
+		facets.PublishYear = append(facets.PublishYear, queries.YearFacet(year.Bucket, year.Count))
+	}
+	cases := make([]string, 0, len(queries.PriceBuckets))
+	for i, bound := range queries.PriceBuckets {
+		cases = append(cases, fmt.Sprintf("when price < %g then %d", bound, i))
+	}
+	prices := make([]bucket, 0)
+	if err := query.Select(fmt.Sprintf("case %s else %d end as bucket, count(*) as count",
+		strings.Join(cases, " "), len(queries.PriceBuckets))).
+		Group("bucket").
+		Order("bucket asc").
+		Scan(&prices).Error; err != nil {
+		return nil, err
+	}
+	for _, price := range prices {
+		facets.Price = append(facets.Price, queries.PriceFacet(price.Bucket, price.Count))
+	}
+	return &facets, nil
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"library-management-system/database"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func showFinesHandler(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	params := r.URL.Query()
+	cardIdStr := params.Get("card_id")
+	var err error
+	var cardId int
+	if cardId, err = strconv.Atoi(cardIdStr); err != nil || cardId <= 0 {
+		server.Response(w, database.APIResult{
+			Ok:      false,
+			Message: "Invalid Arguments: failed to parse request parameter, expect positive integer",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		})
+		return
+	}
+	result := server.ShowFines(cardId)
+	server.Response(w, result)
+}
+
+func payFineHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	server := Server{}
+	var payment database.Ledger
+	err := json.NewDecoder(r.Body).Decode(&payment)
+	if err != nil {
+		server.Response(w, database.APIResult{
+			Ok:      false,
+			Message: "Invalid Arguments: failed to parse request body",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		})
+		return
+	}
+
+	// Pay fine
+	if payment.Time == 0 {
+		payment.Time = time.Now().UnixMilli()
+	}
+	result := server.PayFine(payment)
+	server.Response(w, result)
+}
+
+func waiveFineHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	server := Server{}
+	var waiver database.Ledger
+	err := json.NewDecoder(r.Body).Decode(&waiver)
+	if err != nil {
+		server.Response(w, database.APIResult{
+			Ok:      false,
+			Message: "Invalid Arguments: failed to parse request body",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		})
+		return
+	}
+
+	// Waive fine
+	if waiver.Time == 0 {
+		waiver.Time = time.Now().UnixMilli()
+	}
+	result := server.WaiveFine(waiver)
+	server.Response(w, result)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"library-management-system/database"
+	"net/http"
+	"strconv"
+)
+
+func placeHoldHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	server := Server{}
+	var hold database.Hold
+	err := json.NewDecoder(r.Body).Decode(&hold)
+	if err != nil {
+		server.Response(w, database.APIResult{
+			Ok:      false,
+			Message: "Invalid Arguments: failed to parse request body",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		})
+		return
+	}
+
+	// Place hold
+	if hold.HoldTime == 0 {
+		hold.ResetHoldTime()
+	}
+	result := server.PlaceHold(hold)
+	server.Response(w, result)
+}
+
+func cancelHoldHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	server := Server{}
+	var hold database.Hold
+	err := json.NewDecoder(r.Body).Decode(&hold)
+	if err != nil {
+		server.Response(w, database.APIResult{
+			Ok:      false,
+			Message: "Invalid Arguments: failed to parse request body",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		})
+		return
+	}
+
+	// Cancel hold
+	result := server.CancelHold(hold)
+	server.Response(w, result)
+}
+
+func showHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	params := r.URL.Query()
+	var err error
+	var cardId, bookId int
+	if params.Has("card_id") {
+		if cardId, err = strconv.Atoi(params.Get("card_id")); err != nil || cardId <= 0 {
+			server.Response(w, database.APIResult{
+				Ok:      false,
+				Message: "Invalid Arguments: failed to parse request parameter, expect positive integer",
+				Payload: nil,
+				Code:    database.ErrInvalidArgument,
+			})
+			return
+		}
+	}
+	if params.Has("book_id") {
+		if bookId, err = strconv.Atoi(params.Get("book_id")); err != nil || bookId <= 0 {
+			server.Response(w, database.APIResult{
+				Ok:      false,
+				Message: "Invalid Arguments: failed to parse request parameter, expect positive integer",
+				Payload: nil,
+				Code:    database.ErrInvalidArgument,
+			})
+			return
+		}
+	}
+	if cardId == 0 && bookId == 0 {
+		server.Response(w, database.APIResult{
+			Ok:      false,
+			Message: "Invalid Arguments: expect card_id or book_id",
+			Payload: nil,
+			Code:    database.ErrInvalidArgument,
+		})
+		return
+	}
+	result := server.ShowHolds(cardId, bookId)
+	server.Response(w, result)
+}
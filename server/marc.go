@@ -0,0 +1,29 @@
+package server
+
+import (
+	"library-management-system/database"
+	"library-management-system/server/marc"
+	"library-management-system/server/queries"
+	"net/http"
+)
+
+// importMARCHandler imports the MARC records of the request body, in the format
+// and with the category field of the request parameters, responding as {@link respond}
+func importMARCHandler(status bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		server := Server{}
+		params := r.URL.Query()
+		options := queries.MARCOptions{
+			Format:        queries.MARCFormat(params.Get("format")),
+			CategoryField: params.Get("category_field"),
+		}
+		server.respond(w, server.ImportMARC(http.MaxBytesReader(w, r.Body, maxImportSize), options), status)
+	}
+}
+func marcRecords(books []database.Book, mapping marc.Mapping) []*marc.Record {
+	records := make([]*marc.Record, 0, len(books))
+	for _, book := range books {
+		records = append(records, marc.FromBook(book, mapping))
+	}
+	return records
+}
@@ -0,0 +1,167 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Delimiters of ISO 2709
+const (
+	subfieldDelimiter = 0x1F
+	fieldTerminator   = 0x1E
+	recordTerminator  = 0x1D
+)
+
+const (
+	leaderLength = 24
+	entryLength  = 12 // of an entry in the directory: tag, length and start of a field
+)
+
+// ErrFormat is wrapped by the errors of a malformed record, after which
+// the next record can still be read
+var ErrFormat = errors.New("malformed record")
+
+// RecordReader reads records one by one, and returns io.EOF after the last one
+type RecordReader interface {
+	Read() (*Record, error)
+}
+
+// Reader reads records in ISO 2709, encoded in UTF-8
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next record, an error wrapping ErrFormat if it is malformed,
+// or io.EOF after the last record
+func (r *Reader) Read() (*Record, error) {
+	data, err := r.r.ReadBytes(recordTerminator)
+	data = bytes.TrimLeft(data, " \r\n") // between records of some files
+	if errors.Is(err, io.EOF) && len(data) == 0 {
+		return nil, io.EOF
+	} else if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: the last record has no terminator", ErrFormat)
+	} else if err != nil {
+		return nil, err
+	}
+	return parseRecord(data[:len(data)-1])
+}
+
+// parseRecord parses a record without its terminator, by the base address of its
+// data in the leader, and the fields in the directory
+func parseRecord(data []byte) (*Record, error) {
+	if len(data) < leaderLength || !utf8.Valid(data) {
+		return nil, fmt.Errorf("%w: the record is too short, or is not in UTF-8", ErrFormat)
+	}
+	record := &Record{Leader: string(data[:leaderLength])}
+	base, ok := number(record.Leader[12:17])
+	if !ok || base <= leaderLength || base > len(data) || data[base-1] != fieldTerminator ||
+		(base-1-leaderLength)%entryLength != 0 {
+		return nil, fmt.Errorf("%w: invalid base address of data %q", ErrFormat, record.Leader[12:17])
+	}
+	directory := data[leaderLength : base-1]
+	for i := 0; i < len(directory); i += entryLength {
+		entry := string(directory[i : i+entryLength])
+		length, ok1 := number(entry[3:7])
+		start, ok2 := number(entry[7:12])
+		if !ok1 || !ok2 || length < 1 || base+start+length > len(data) ||
+			data[base+start+length-1] != fieldTerminator {
+			return nil, fmt.Errorf("%w: invalid entry %q in the directory", ErrFormat, entry)
+		}
+		field, err := parseField(entry[:3], data[base+start:base+start+length-1])
+		if err != nil {
+			return nil, err
+		}
+		record.Fields = append(record.Fields, field)
+	}
+	return record, nil
+}
+
+// number parses a length or a start in the leader or the directory, which has only ASCII digits
+func number(s string) (int, bool) {
+	if s == "" || strings.Trim(s, "0123456789") != "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
+
+func parseField(tag string, data []byte) (Field, error) {
+	if IsControl(tag) {
+		return Field{Tag: tag, Value: string(data)}, nil
+	}
+	if len(data) < 2 {
+		return Field{}, fmt.Errorf("%w: field %s has no indicators", ErrFormat, tag)
+	}
+	field := Field{Tag: tag, Indicators: string(data[:2]), Subfields: make([]Subfield, 0)}
+	for _, subfield := range bytes.Split(data[2:], []byte{subfieldDelimiter})[1:] {
+		if len(subfield) == 0 {
+			return Field{}, fmt.Errorf("%w: field %s has a subfield without code", ErrFormat, tag)
+		}
+		field.Subfields = append(field.Subfields, Subfield{Code: subfield[0], Value: string(subfield[1:])})
+	}
+	return field, nil
+}
+
+// WriteRecords writes the records in ISO 2709, encoded in UTF-8
+func WriteRecords(w io.Writer, records []*Record) error {
+	writer := bufio.NewWriter(w)
+	for _, record := range records {
+		data, err := record.marshal()
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(data); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// marshal encodes the record with the directory and the lengths in its leader
+func (r *Record) marshal() ([]byte, error) {
+	var directory, fields bytes.Buffer
+	for _, field := range r.Fields {
+		start := fields.Len()
+		if IsControl(field.Tag) {
+			fields.WriteString(field.Value)
+		} else {
+			fields.WriteString(fmt.Sprintf("%-2.2s", field.Indicators))
+			for _, subfield := range field.Subfields {
+				fields.WriteByte(subfieldDelimiter)
+				fields.WriteByte(subfield.Code)
+				fields.WriteString(subfield.Value)
+			}
+		}
+		fields.WriteByte(fieldTerminator)
+		if len(field.Tag) != 3 || fields.Len()-start > 9999 || start > 99999 {
+			return nil, fmt.Errorf("field %q is too long, or has an invalid tag", field.Tag)
+		}
+		directory.WriteString(fmt.Sprintf("%s%04d%05d", field.Tag, fields.Len()-start, start))
+	}
+	directory.WriteByte(fieldTerminator)
+	base := leaderLength + directory.Len()
+	length := base + fields.Len() + 1
+	if length > 99999 {
+		return nil, errors.New("the record is longer than 99999 bytes")
+	}
+
+	leader := []byte(fmt.Sprintf("%-24.24s", r.Leader))
+	copy(leader[0:5], fmt.Sprintf("%05d", length))
+	copy(leader[9:17], fmt.Sprintf("a22%05d", base)) // UTF-8, lengths of indicators and subfield codes
+	copy(leader[20:24], "4500")
+	data := make([]byte, 0, length)
+	data = append(data, leader...)
+	data = append(data, directory.Bytes()...)
+	data = append(data, fields.Bytes()...)
+	return append(data, recordTerminator), nil
+}
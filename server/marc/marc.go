@@ -0,0 +1,243 @@
+// Package marc reads and writes bibliographic records as MARC21, in ISO 2709 or MARCXML,
+// and maps them onto books.
+package marc
+
+import (
+	"errors"
+	"fmt"
+	"library-management-system/database"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Record is a bibliographic record, whose control fields come before its data fields
+type Record struct {
+	Leader string
+	Fields []Field
+}
+
+// Field is a control field with a value, or a data field with indicators and subfields
+type Field struct {
+	Tag        string
+	Value      string // of a control field
+	Indicators string // of a data field, 2 characters
+	Subfields  []Subfield
+}
+
+type Subfield struct {
+	Code  byte
+	Value string
+}
+
+// IsControl tells whether the tag is of a control field, eg: 001 or 008
+func IsControl(tag string) bool {
+	return strings.HasPrefix(tag, "00")
+}
+
+// Subfield returns the value of the first subfield of the code, or ""
+func (f *Field) Subfield(code byte) string {
+	for _, subfield := range f.Subfields {
+		if subfield.Code == code {
+			return subfield.Value
+		}
+	}
+	return ""
+}
+
+// Control returns the value of the control field of the tag, or ""
+func (r *Record) Control(tag string) string {
+	for _, field := range r.Fields {
+		if field.Tag == tag {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// Subfield returns the value of the first subfield of the code in the fields of the tag, or ""
+func (r *Record) Subfield(tag string, code byte) string {
+	for _, field := range r.Fields {
+		if value := field.Subfield(code); field.Tag == tag && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// FieldSpec names a subfield of data fields, eg: 650$a
+type FieldSpec struct {
+	Tag  string
+	Code byte
+}
+
+// ParseFieldSpec parses a subfield of data fields, given as 650$a or 650a
+func ParseFieldSpec(s string) (FieldSpec, error) {
+	s = strings.Replace(s, "$", "", 1)
+	if len(s) != 4 || strings.Trim(s[:3], "0123456789") != "" || IsControl(s[:3]) || s[3] == ' ' {
+		return FieldSpec{}, fmt.Errorf("invalid field %q, expect a data field and a subfield, eg: 650$a", s)
+	}
+	return FieldSpec{Tag: s[:3], Code: s[3]}, nil
+}
+
+func (s FieldSpec) String() string {
+	return s.Tag + "$" + string(s.Code)
+}
+
+// Config is the marc section in config.yaml
+type Config struct {
+	Category string `yaml:"category"` // subfield of the category, eg: 084$a, DefaultMapping if empty
+}
+
+// Mapping tells where the fields of a book are that are not standard in MARC21
+type Mapping struct {
+	Category FieldSpec
+}
+
+// DefaultMapping takes the category from the topical subject
+var DefaultMapping = Mapping{Category: FieldSpec{Tag: "650", Code: 'a'}}
+
+// NewMapping returns the mapping of the config
+func NewMapping(config Config) (Mapping, error) {
+	if config.Category == "" {
+		return DefaultMapping, nil
+	}
+	category, err := ParseFieldSpec(config.Category)
+	return Mapping{Category: category}, err
+}
+
+const maxLength = 63 // of the text columns in the database
+
+var (
+	yearPattern  = regexp.MustCompile(`\d{4}`)
+	pricePattern = regexp.MustCompile(`\d+(\.\d+)?`)
+)
+
+// Book maps the record onto a book by the mapping. the title comes from 245$a,
+// the authors from 100, 110 or 111 and 700$a, the press from 264$b (publication) or 260$b,
+// the year from 264$c, 260$c or 008, the ISBN from 020$a, the price from 365$b or 020$c,
+// and the category from the field of the mapping. the stock is 0, which MARC21 does not tell.
+func (r *Record) Book(mapping Mapping) (*database.Book, error) {
+	book := database.Book{
+		Title:    trim(r.Subfield("245", 'a')),
+		Author:   strings.Join(r.authors(), ", "),
+		Press:    trim(r.publication('b')),
+		Category: strings.TrimRight(trim(r.Subfield(mapping.Category.Tag, mapping.Category.Code)), "."),
+	}
+	for _, text := range []struct {
+		name  string
+		field string
+		value string
+	}{
+		{"title", "245$a", book.Title}, {"author", "100, 110, 111 or 700$a", book.Author},
+		{"press", "264$b or 260$b", book.Press}, {"category", mapping.Category.String(), book.Category},
+	} {
+		if text.value == "" {
+			return nil, fmt.Errorf("no %s in %s", text.name, text.field)
+		}
+		if utf8.RuneCountInString(text.value) > maxLength {
+			return nil, fmt.Errorf("%s is longer than %d characters", text.name, maxLength)
+		}
+	}
+
+	year := yearPattern.FindString(r.publication('c'))
+	if fixed := r.Control("008"); year == "" && len(fixed) >= 11 && strings.Trim(fixed[7:11], "0123456789") == "" {
+		year = fixed[7:11]
+	}
+	if year == "" {
+		return nil, errors.New("no year in 264$c, 260$c or 008")
+	}
+	book.PublishYear, _ = strconv.Atoi(year)
+
+	if isbn := strings.TrimSpace(r.Subfield("020", 'a')); isbn != "" {
+		var err error
+		if book.ISBN, err = database.NormalizeISBN(strings.Fields(isbn)[0]); err != nil {
+			return nil, err
+		}
+	}
+	if price := pricePattern.FindString(r.Subfield("365", 'b') + " " + r.Subfield("020", 'c')); price != "" {
+		book.Price, _ = strconv.ParseFloat(price, 64)
+	}
+	return &book, nil
+}
+
+// authors returns the names of the main entry and of the added entries of authors,
+// turning inverted personal names as "Cormen, Thomas H." into "Thomas H. Cormen"
+func (r *Record) authors() []string {
+	main, added := "", make([]string, 0)
+	for _, field := range r.Fields {
+		name := trim(field.Subfield('a'))
+		if name == "" {
+			continue
+		}
+		if (field.Tag == "100" || field.Tag == "700") && strings.HasPrefix(field.Indicators, "1") {
+			if surname, forename, ok := strings.Cut(name, ","); ok {
+				name = strings.TrimSpace(forename) + " " + strings.TrimSpace(surname)
+			}
+		}
+		switch field.Tag {
+		case "100", "110", "111":
+			if main == "" {
+				main = name
+			}
+		case "700":
+			// editors, translators and so on are not authors
+			if role := field.Subfield('e') + field.Subfield('4'); role == "" || strings.Contains(role, "aut") {
+				added = append(added, name)
+			}
+		}
+	}
+	if main == "" {
+		return added
+	}
+	return append([]string{main}, added...)
+}
+
+// publication returns the subfield of the publication statement, in 264 with
+// the second indicator 1, or in 260
+func (r *Record) publication(code byte) string {
+	for _, field := range r.Fields {
+		if field.Tag == "264" && len(field.Indicators) == 2 && field.Indicators[1] == '1' && field.Subfield(code) != "" {
+			return field.Subfield(code)
+		}
+	}
+	return r.Subfield("260", code)
+}
+
+// trim removes the spaces and the ISBD punctuation around a value, eg: "Introduction to algorithms /"
+func trim(value string) string {
+	return strings.Trim(value, " /:;,=[]")
+}
+
+// FromBook returns the record of the book, which is mapped back onto the book by the mapping
+func FromBook(book database.Book, mapping Mapping) *Record {
+	record := &Record{
+		Leader: "00000nam a2200000 i 4500",
+		Fields: []Field{
+			{Tag: "001", Value: strconv.Itoa(book.BookId)},
+			{Tag: "008", Value: fmt.Sprintf("%6ss%04d    xx %17sund  ", "", book.PublishYear, "")},
+		},
+	}
+	if book.ISBN != "" {
+		record.Fields = append(record.Fields, dataField("020", "  ", 'a', book.ISBN))
+	}
+	authors := database.SplitAuthors(book.Author)
+	if len(authors) > 0 {
+		record.Fields = append(record.Fields, dataField("100", "0 ", 'a', authors[0]))
+	}
+	record.Fields = append(record.Fields,
+		dataField("245", "00", 'a', book.Title),
+		Field{Tag: "264", Indicators: " 1", Subfields: []Subfield{{'b', book.Press}, {'c', strconv.Itoa(book.PublishYear)}}},
+		dataField("365", "  ", 'b', strconv.FormatFloat(book.Price, 'f', 2, 64)),
+		dataField(mapping.Category.Tag, "  ", mapping.Category.Code, book.Category),
+	)
+	for _, author := range authors[min(1, len(authors)):] {
+		record.Fields = append(record.Fields, dataField("700", "0 ", 'a', author))
+	}
+	return record
+}
+
+func dataField(tag string, indicators string, code byte, value string) Field {
+	return Field{Tag: tag, Indicators: indicators, Subfields: []Subfield{{code, value}}}
+}
@@ -0,0 +1,79 @@
+package marc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"library-management-system/database"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+var book = database.Book{BookId: 7, Category: "Computer", Title: "The C programming language", Press: "Prentice Hall",
+	PublishYear: 1988, Author: "Brian W. Kernighan, Dennis M. Ritchie", Price: 30, ISBN: "9780131103627"}
+
+func TestRoundTrip(t *testing.T) {
+	var iso, xml bytes.Buffer
+	records := []*Record{FromBook(book, DefaultMapping)}
+	assert.Equal(t, WriteRecords(&iso, records), nil)
+	assert.Equal(t, WriteXML(&xml, records), nil)
+
+	for _, reader := range []RecordReader{NewReader(&iso), NewXMLReader(&xml)} {
+		record, err := reader.Read()
+		assert.Equal(t, err, nil)
+		assert.Equal(t, record.Control("001"), "7")
+		mapped, err := record.Book(DefaultMapping)
+		assert.Equal(t, err, nil)
+		expected := book
+		expected.BookId = 0
+		assert.Equal(t, *mapped, expected)
+		_, err = reader.Read()
+		assert.Equal(t, err, io.EOF)
+	}
+}
+
+func TestReadMalformed(t *testing.T) {
+	var iso bytes.Buffer
+	assert.Equal(t, WriteRecords(&iso, []*Record{FromBook(book, DefaultMapping)}), nil)
+	valid := iso.String()
+	entry := leaderLength // of the title in the directory
+	for valid[entry:entry+3] != "245" {
+		entry += entryLength
+	}
+	base := valid[12:17]
+	replace := func(at int, s string) string {
+		return valid[:at] + s + valid[at+len(s):]
+	}
+
+	for _, malformed := range []string{
+		replace(entry+7, "-9999"), // negative start
+		replace(entry+7, "+0001"), // signed start
+		replace(entry+3, "-001"),  // negative length
+		replace(entry+3, " 001"),  // not a digit
+		replace(entry+7, "99999"), // beyond the record
+		replace(entry+3, "0000"),  // empty field
+		replace(12, "-0024"),      // negative base address
+		replace(12, "0002x"),      // not a number
+		replace(12, "00025"),      // not after the directory
+		valid[:20] + "\x1d",       // shorter than the leader
+		valid[:len(valid)-1] + "\xff\x1d",
+	} {
+		// the malformed record is reported, and the next one is still read
+		reader := NewReader(strings.NewReader(malformed + "\n" + valid))
+		_, err := reader.Read()
+		assert.Equal(t, errors.Is(err, ErrFormat), true)
+		record, err := reader.Read()
+		assert.Equal(t, err, nil)
+		assert.Equal(t, record.Subfield("245", 'a'), book.Title)
+		assert.Equal(t, record.Leader[12:17], base)
+	}
+
+	// the last record has no terminator
+	reader := NewReader(strings.NewReader(valid[:len(valid)-1]))
+	_, err := reader.Read()
+	assert.Equal(t, errors.Is(err, ErrFormat), true)
+	_, err = reader.Read()
+	assert.Equal(t, err, io.EOF)
+}
@@ -0,0 +1,124 @@
+package marc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// Namespace of MARCXML
+const Namespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlCollection struct {
+	XMLName xml.Name    `xml:"collection"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Records []xmlRecord `xml:"record"`
+}
+
+type xmlRecord struct {
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// XMLReader reads the records of MARCXML, in a collection or alone
+type XMLReader struct {
+	decoder *xml.Decoder
+}
+
+func NewXMLReader(r io.Reader) *XMLReader {
+	return &XMLReader{decoder: xml.NewDecoder(r)}
+}
+
+// Read returns the next record, an error wrapping ErrFormat if it is malformed,
+// or io.EOF after the last record. the XML itself cannot be read on after an error.
+func (r *XMLReader) Read() (*Record, error) {
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+		var element xmlRecord
+		if err := r.decoder.DecodeElement(&element, &start); err != nil {
+			return nil, err
+		}
+		return element.record()
+	}
+}
+
+func (e *xmlRecord) record() (*Record, error) {
+	record := &Record{Leader: e.Leader, Fields: make([]Field, 0, len(e.ControlFields)+len(e.DataFields))}
+	for _, field := range e.ControlFields {
+		record.Fields = append(record.Fields, Field{Tag: field.Tag, Value: field.Value})
+	}
+	for _, field := range e.DataFields {
+		if len(field.Tag) != 3 {
+			return nil, fmt.Errorf("%w: invalid tag %q", ErrFormat, field.Tag)
+		}
+		subfields := make([]Subfield, 0, len(field.Subfields))
+		for _, subfield := range field.Subfields {
+			if len(subfield.Code) != 1 {
+				return nil, fmt.Errorf("%w: field %s has an invalid subfield code %q", ErrFormat, field.Tag, subfield.Code)
+			}
+			subfields = append(subfields, Subfield{Code: subfield.Code[0], Value: subfield.Value})
+		}
+		record.Fields = append(record.Fields, Field{
+			Tag:        field.Tag,
+			Indicators: fmt.Sprintf("%-1.1s%-1.1s", field.Ind1, field.Ind2),
+			Subfields:  subfields,
+		})
+	}
+	return record, nil
+}
+
+// WriteXML writes the records as a collection of MARCXML
+func WriteXML(w io.Writer, records []*Record) error {
+	collection := xmlCollection{Xmlns: Namespace, Records: make([]xmlRecord, 0, len(records))}
+	for _, record := range records {
+		element := xmlRecord{Leader: record.Leader}
+		for _, field := range record.Fields {
+			if IsControl(field.Tag) {
+				element.ControlFields = append(element.ControlFields, xmlControlField{Tag: field.Tag, Value: field.Value})
+				continue
+			}
+			indicators := fmt.Sprintf("%-2.2s", field.Indicators)
+			dataField := xmlDataField{Tag: field.Tag, Ind1: indicators[:1], Ind2: indicators[1:]}
+			for _, subfield := range field.Subfields {
+				dataField.Subfields = append(dataField.Subfields, xmlSubfield{Code: string(subfield.Code), Value: subfield.Value})
+			}
+			element.DataFields = append(element.DataFields, dataField)
+		}
+		collection.Records = append(collection.Records, element)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(collection); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"library-management-system/database"
+	"net/http"
+)
+
+/**
+ * Self-service API for patrons
+ *
+ * the card of the request is the card of the account logged in, never a
+ * parameter, so that patrons can only see and renew their own loans.
+ * the routes are permitted to patrons only, see {@link authorize}.
+ */
+
+// selfServiceRequest is the body of a patron acting on a book of their card
+type selfServiceRequest struct {
+	BookId  int    `json:"book_id"`
+	Barcode string `json:"barcode"` // optional, for borrowing a specific copy
+}
+
+// selfCard returns the card of the patron sending the request
+func selfCard(r *http.Request) int {
+	claims, _ := identity(r)
+	return claims.CardId
+}
+
+func showSelfBorrowsV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	result := server.ShowBorrowHistories(selfCard(r))
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func borrowSelfV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	var request selfServiceRequest
+	if !decodeBody(w, r, &request) {
+		return
+	}
+	borrow, failure := borrowRequest{
+		Borrow:  database.Borrow{CardId: selfCard(r), BookId: request.BookId},
+		Barcode: request.Barcode,
+	}.resolve(&server)
+	if failure != nil {
+		server.ResponseStatus(w, *failure, 0)
+		return
+	}
+	borrow.ResetBorrowTime() // patrons borrow now, never in the past
+	result := server.BorrowBook(borrow)
+	server.ResponseStatus(w, result, http.StatusCreated)
+}
+
+func renewSelfV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	var request selfServiceRequest
+	if !decodeBody(w, r, &request) {
+		return
+	}
+	result := server.RenewBorrow(database.Borrow{CardId: selfCard(r), BookId: request.BookId})
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func showSelfHoldsV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	result := server.ShowHolds(selfCard(r), 0)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func placeSelfHoldV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	var request selfServiceRequest
+	if !decodeBody(w, r, &request) {
+		return
+	}
+	hold := database.Hold{CardId: selfCard(r), BookId: request.BookId}
+	hold.ResetHoldTime()
+	result := server.PlaceHold(hold)
+	server.ResponseStatus(w, result, http.StatusCreated)
+}
+
+func cancelSelfHoldV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	bookId, ok := pathId(w, r, "book_id")
+	if !ok {
+		return
+	}
+	result := server.CancelHold(database.Hold{CardId: selfCard(r), BookId: bookId})
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func showSelfFinesV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	result := server.ShowFines(selfCard(r))
+	server.ResponseStatus(w, result, http.StatusOK)
+}
@@ -0,0 +1,178 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultLoanDays       = 30
+	DefaultMaxRenewals    = 2
+	DefaultHoldPickupDays = 3
+)
+
+// Rule is one entry of the policy section in config.yaml.
+// Omitted fields are inherited from the less specific rule.
+type Rule struct {
+	MaxLoans       *int     `yaml:"max_loans"`        // maximum number of concurrent loans, 0 means unlimited
+	LoanDays       *int     `yaml:"loan_days"`        // length of a loan in days
+	MaxRenewals    *int     `yaml:"max_renewals"`     // how many times a loan can be renewed
+	FinePerDay     *float64 `yaml:"fine_per_day"`     // fine for each day a loan is late
+	FineCap        *float64 `yaml:"fine_cap"`         // maximum fine of a loan, 0 means no cap
+	MaxUnpaidFines *float64 `yaml:"max_unpaid_fines"` // unpaid balance that blocks borrowing, 0 means never
+}
+
+// CategoryRule overrides the card type rule for books of one category.
+// MaxLoans of a category rule limits the concurrent loans within that category.
+type CategoryRule struct {
+	Category string `yaml:"category"`
+	CardType string `yaml:"card_type"` // empty for all card types
+	Rule     `yaml:",inline"`
+}
+
+// Config
+//
+// Rules are applied from the least to the most specific one:
+//
+//	default -> card_types[type] -> categories (any card type) -> categories (same card type)
+type Config struct {
+	Default        Rule            `yaml:"default"`
+	CardTypes      map[string]Rule `yaml:"card_types"` // keyed by database.Card.Type
+	Categories     []CategoryRule  `yaml:"categories"`
+	HoldPickupDays int             `yaml:"hold_pickup_days"` // how long a returned copy is kept for a hold
+}
+
+// Limits is the resolved policy for a card type and a book category
+type Limits struct {
+	MaxLoans         int     `json:"max_loans"`          // 0 means unlimited
+	MaxCategoryLoans int     `json:"max_category_loans"` // 0 means unlimited
+	LoanDays         int     `json:"loan_days"`
+	MaxRenewals      int     `json:"max_renewals"`
+	FinePerDay       float64 `json:"fine_per_day"`
+	FineCap          float64 `json:"fine_cap"`         // 0 means no cap
+	MaxUnpaidFines   float64 `json:"max_unpaid_fines"` // 0 means unlimited
+}
+
+// LoanPeriod returns the length of a loan
+func (l Limits) LoanPeriod() time.Duration {
+	return time.Duration(l.LoanDays) * 24 * time.Hour
+}
+
+// Fine returns the fine of a loan returned daysLate days late, rounded to cents
+func (l Limits) Fine(daysLate int) float64 {
+	fine := float64(daysLate) * l.FinePerDay
+	if l.FineCap > 0 {
+		fine = min(fine, l.FineCap)
+	}
+	return math.Round(fine*100) / 100
+}
+
+type Policy struct {
+	config Config
+}
+
+// New returns the policy of the config, or an error if a rule has a loan_days
+// that is not positive, or a negative limit, renewal count or fine
+func New(config Config) (Policy, error) {
+	if err := config.Default.check(); err != nil {
+		return Policy{}, fmt.Errorf("default: %w", err)
+	}
+	for cardType, rule := range config.CardTypes {
+		if err := rule.check(); err != nil {
+			return Policy{}, fmt.Errorf("card_types %s: %w", cardType, err)
+		}
+		if cardType != "T" && cardType != "S" {
+			logrus.Warn("policy for unknown card type ", cardType, " will never be applied")
+		}
+	}
+	for _, rule := range config.Categories {
+		if err := rule.check(); err != nil {
+			return Policy{}, fmt.Errorf("categories %s: %w", rule.Category, err)
+		}
+		if rule.Category == "" {
+			logrus.Warn("policy for categories without a category name will never be applied")
+		}
+	}
+	if config.HoldPickupDays <= 0 {
+		config.HoldPickupDays = DefaultHoldPickupDays
+	}
+	return Policy{config: config}, nil
+}
+
+// check returns the error of the first invalid field of the rule, or nil
+func (r Rule) check() error {
+	negative := func(value *float64) bool { return value != nil && *value < 0 }
+	switch {
+	case r.LoanDays != nil && *r.LoanDays <= 0:
+		return errors.New("loan_days should be positive")
+	case r.MaxLoans != nil && *r.MaxLoans < 0:
+		return errors.New("max_loans should not be negative")
+	case r.MaxRenewals != nil && *r.MaxRenewals < 0:
+		return errors.New("max_renewals should not be negative")
+	case negative(r.FinePerDay):
+		return errors.New("fine_per_day should not be negative")
+	case negative(r.FineCap):
+		return errors.New("fine_cap should not be negative")
+	case negative(r.MaxUnpaidFines):
+		return errors.New("max_unpaid_fines should not be negative")
+	}
+	return nil
+}
+
+// PickupWindow returns how long a copy set aside for a hold waits for the patron
+func (p Policy) PickupWindow() time.Duration {
+	return time.Duration(p.config.HoldPickupDays) * 24 * time.Hour
+}
+
+// Resolve returns the limits for a card of cardType borrowing a book of category
+func (p Policy) Resolve(cardType string, category string) Limits {
+	limits := Limits{
+		LoanDays:    DefaultLoanDays,
+		MaxRenewals: DefaultMaxRenewals,
+	}
+	limits.apply(p.config.Default, false)
+	if rule, ok := p.config.CardTypes[cardType]; ok {
+		limits.apply(rule, false)
+	}
+	// rules for all card types first, so that card type specific ones take precedence
+	for _, rule := range p.config.Categories {
+		if rule.Category == category && rule.CardType == "" {
+			limits.apply(rule.Rule, true)
+		}
+	}
+	for _, rule := range p.config.Categories {
+		if rule.Category == category && rule.CardType == cardType {
+			limits.apply(rule.Rule, true)
+		}
+	}
+	return limits
+}
+
+func (l *Limits) apply(rule Rule, category bool) {
+	if rule.MaxLoans != nil {
+		if category {
+			l.MaxCategoryLoans = *rule.MaxLoans
+		} else {
+			l.MaxLoans = *rule.MaxLoans
+		}
+	}
+	if rule.LoanDays != nil {
+		l.LoanDays = *rule.LoanDays
+	}
+	if rule.MaxRenewals != nil {
+		l.MaxRenewals = *rule.MaxRenewals
+	}
+	if rule.FinePerDay != nil {
+		l.FinePerDay = *rule.FinePerDay
+	}
+	if rule.FineCap != nil {
+		l.FineCap = *rule.FineCap
+	}
+	if rule.MaxUnpaidFines != nil {
+		l.MaxUnpaidFines = *rule.MaxUnpaidFines
+	}
+}
@@ -2,12 +2,15 @@ package queries
 
 import (
 	"cmp"
+	"errors"
 	"fmt"
 	"library-management-system/database"
+	"slices"
 )
 
 type Order string
 type SortColumn string
+type MatchMode string
 
 const (
 	Asc  Order = "asc"
@@ -27,6 +30,13 @@ const (
 var SortColumns = []SortColumn{BookId, Category, Title, Press, PublishYear, Author, Price, Stock}
 var SortOrders = []Order{Asc, Desc}
 
+const (
+	Fuzzy MatchMode = "fuzzy" // the field contains the value, case-insensitively
+	Exact MatchMode = "exact" // the field equals the value
+)
+
+var MatchModes = []MatchMode{Fuzzy, Exact}
+
 // BookQueryConditions
 //
 // Note: (1) all non-null attributes should be used as query
@@ -37,24 +47,152 @@ var SortOrders = []Order{Asc, Desc}
 //	eg: minA=x, maxA=y ==> x <= A <= y
 //	    minA=null, maxA=y ==> A <= y
 //	    minA=x, maxA=null ==> A >= x
+//	(3) a list of values matches any of them exactly, and
+//	an excluded value rejects the books having it exactly.
+//	eg: categories=[x, y], excludePresses=[z] ==> category IN (x, y) AND press NOT IN (z)
+//	(4) author, authors and excludeAuthors match the names of the contributors
+//	of a book in any role, as contributor does, which role narrows to one role.
+//	eg: authors=[x], contributor=y, role=editor ==> x contributes in any role AND y edits
 type BookQueryConditions struct {
-	Category       string     `json:"category"` /* Note: use fuzzy matching */
-	Title          string     `json:"title"`    /* Note: use fuzzy matching */
-	Press          string     `json:"press"`    /* Note: use fuzzy matching */
-	MinPublishYear int        `json:"minPublishYear"`
-	MaxPublishYear int        `json:"maxPublishYear"`
-	Author         string     `json:"author"` /* Note: use fuzzy matching */
-	MinPrice       float64    `json:"minPrice"`
-	MaxPrice       float64    `json:"maxPrice"`
-	SortBy         SortColumn `json:"sortBy"`    /* sort by which field */
-	SortOrder      Order      `json:"sortOrder"` /* default sort by Primary Key */
+	Q                 string     `json:"q"`        /* Note: full-text search over title, author, category and press */
+	Category          string     `json:"category"` /* Note: use fuzzy matching, or see Match */
+	Title             string     `json:"title"`    /* Note: use fuzzy matching, or see Match */
+	Press             string     `json:"press"`    /* Note: use fuzzy matching, or see Match */
+	MinPublishYear    int        `json:"minPublishYear"`
+	MaxPublishYear    int        `json:"maxPublishYear"`
+	Author            string     `json:"author"`      /* Note: use fuzzy matching or see Match, on the authors and any contributor */
+	Contributor       string     `json:"contributor"` /* Note: exact name of any contributor */
+	Role              string     `json:"role"`        /* Note: role of the contributor, any role if empty */
+	ISBN              string     `json:"isbn"`        /* Note: ISBN-10 or ISBN-13, use exact matching */
+	MinPrice          float64    `json:"minPrice"`
+	MaxPrice          float64    `json:"maxPrice"`
+	Match             MatchMode  `json:"match"`             /* Note: matching of category, title, press and author, Fuzzy by default */
+	Categories        []string   `json:"categories"`        /* Note: any of the categories */
+	Presses           []string   `json:"presses"`           /* Note: any of the presses */
+	Authors           []string   `json:"authors"`           /* Note: any of the contributors of a book */
+	ExcludeCategories []string   `json:"excludeCategories"` /* Note: none of the categories */
+	ExcludePresses    []string   `json:"excludePresses"`    /* Note: none of the presses */
+	ExcludeAuthors    []string   `json:"excludeAuthors"`    /* Note: none of the contributors of a book */
+	InStock           bool       `json:"inStock"`           /* Note: only the books with stock left */
+	SortBy            SortColumn `json:"sortBy"`            /* sort by which field */
+	SortOrder         Order      `json:"sortOrder"`         /* default sort by relevance with Q, or by Primary Key */
+	Limit             int        `json:"limit"`             /* Note: the page size, all results if 0 */
+	Offset            int        `json:"offset"`            /* Note: number of results skipped before the page */
+	Cursor            string     `json:"cursor"`            /* Note: the page after {@link BookQueryResults#NextCursor}, instead of offset */
+	Facets            bool       `json:"facets"`            /* Note: count the matching books by field, see {@link Facets} */
 }
 
 func (c BookQueryConditions) String() string {
-	return fmt.Sprintf("BookQueryConditions{Category: `%s`, Title: `%s`, Press: `%s`,"+
+	return fmt.Sprintf("BookQueryConditions{Q: `%s`, Category: `%s`, Title: `%s`, Press: `%s`,"+
 		"MinPublishYear: `%d`, MaxPublishYear: `%d`,"+
-		"Author: `%s`, MinPrice: `%f`, MaxPrice: `%f`, SortBy: `%s`, SortOrder: `%s`}",
-		c.Category, c.Title, c.Press, c.MinPublishYear, c.MaxPublishYear, c.Author, c.MinPrice, c.MaxPrice, c.SortBy, c.SortOrder)
+		"Author: `%s`, Contributor: `%s`, Role: `%s`, ISBN: `%s`, MinPrice: `%f`, MaxPrice: `%f`, SortBy: `%s`, SortOrder: `%s`,"+
+		"Match: `%s`, Categories: `%v`, Presses: `%v`, Authors: `%v`,"+
+		"ExcludeCategories: `%v`, ExcludePresses: `%v`, ExcludeAuthors: `%v`, InStock: `%t`,"+
+		"Limit: `%d`, Offset: `%d`, Cursor: `%s`, Facets: `%t`}",
+		c.Q, c.Category, c.Title, c.Press, c.MinPublishYear, c.MaxPublishYear, c.Author, c.Contributor, c.Role, c.ISBN, c.MinPrice, c.MaxPrice, c.SortBy, c.SortOrder,
+		c.Match, c.Categories, c.Presses, c.Authors, c.ExcludeCategories, c.ExcludePresses, c.ExcludeAuthors, c.InStock,
+		c.Limit, c.Offset, c.Cursor, c.Facets)
+}
+
+// PageCursor checks the limit, offset and cursor of the conditions,
+// and returns the decoded cursor, or nil for the first page
+func (c BookQueryConditions) PageCursor() (*Cursor, error) {
+	if c.Limit < 0 || c.Offset < 0 {
+		return nil, errors.New("limit and offset should not be negative")
+	}
+	if c.Cursor == "" {
+		return nil, nil
+	}
+	if c.Offset != 0 {
+		return nil, errors.New("offset cannot be used with cursor")
+	}
+	if c.Ranked() {
+		return nil, errors.New("cursor cannot be used when ranking by relevance, use offset instead")
+	}
+	cursor, err := ParseCursor(c.Cursor, c.SortBy, c.SortOrder)
+	if err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// Ranked tells whether the results are sorted by relevance to the search,
+// which is the case when searching without a sort column
+func (c BookQueryConditions) Ranked() bool {
+	return c.SortBy == "" && len(SearchTerms(c.Q)) > 0
+}
+
+type BorrowSortColumn string
+type BorrowStatus string
+
+const (
+	BorrowTime   BorrowSortColumn = "borrow_time"
+	ReturnTime   BorrowSortColumn = "return_time"
+	DueTime      BorrowSortColumn = "due_time"
+	BorrowCardId BorrowSortColumn = "card_id"
+	BorrowBookId BorrowSortColumn = "book_id"
+	BookTitle    BorrowSortColumn = "title" // of the borrowed book
+	CardName     BorrowSortColumn = "name"  // of the card holder
+)
+const (
+	Open     BorrowStatus = "open"     // not returned yet
+	Returned BorrowStatus = "returned" // returned already
+)
+
+var BorrowSortColumns = []BorrowSortColumn{BorrowTime, ReturnTime, DueTime, BorrowCardId, BorrowBookId, BookTitle, CardName}
+var BorrowStatuses = []BorrowStatus{Open, Returned}
+
+// BorrowQueryConditions
+//
+// Note: (1) all non-null attributes should be used as query
+//
+//	conditions and connected by "AND" operations.
+//	(2) for range query of a time, the maximum and minimum
+//	values use closed intervals, as {@link BookQueryConditions}.
+//	(3) a range of return time only matches returned borrows.
+type BorrowQueryConditions struct {
+	BookId        int              `json:"bookId"`
+	CardId        int              `json:"cardId"`
+	Department    string           `json:"department"` /* Note: of the card, use exact matching */
+	CardType      string           `json:"cardType"`   /* Note: of the card, 'T' or 'S' */
+	Status        BorrowStatus     `json:"status"`     /* Note: open or returned, both if empty */
+	MinBorrowTime int64            `json:"minBorrowTime"`
+	MaxBorrowTime int64            `json:"maxBorrowTime"`
+	MinReturnTime int64            `json:"minReturnTime"`
+	MaxReturnTime int64            `json:"maxReturnTime"`
+	SortBy        BorrowSortColumn `json:"sortBy"`    /* default sort by borrow time DESC */
+	SortOrder     Order            `json:"sortOrder"` /* then by card_id, book_id and borrow_time ASC */
+	Limit         int              `json:"limit"`     /* Note: the page size, all results if 0 */
+	Offset        int              `json:"offset"`    /* Note: number of results skipped before the page */
+}
+
+func (c BorrowQueryConditions) String() string {
+	return fmt.Sprintf("BorrowQueryConditions{BookId: `%d`, CardId: `%d`, Department: `%s`, CardType: `%s`, Status: `%s`,"+
+		"MinBorrowTime: `%d`, MaxBorrowTime: `%d`, MinReturnTime: `%d`, MaxReturnTime: `%d`,"+
+		"SortBy: `%s`, SortOrder: `%s`, Limit: `%d`, Offset: `%d`}",
+		c.BookId, c.CardId, c.Department, c.CardType, c.Status,
+		c.MinBorrowTime, c.MaxBorrowTime, c.MinReturnTime, c.MaxReturnTime,
+		c.SortBy, c.SortOrder, c.Limit, c.Offset)
+}
+
+// Check returns the error of the first invalid condition, or nil
+func (c BorrowQueryConditions) Check() error {
+	if c.SortBy != "" && !slices.Contains(BorrowSortColumns, c.SortBy) {
+		return errors.New("invalid sort_by")
+	}
+	if c.SortOrder != "" && !slices.Contains(SortOrders, c.SortOrder) {
+		return errors.New("invalid sort_order")
+	}
+	if c.Status != "" && !slices.Contains(BorrowStatuses, c.Status) {
+		return errors.New("invalid status, expect open or returned")
+	}
+	if c.CardType != "" && c.CardType != "T" && c.CardType != "S" {
+		return errors.New("invalid card_type, expect 'T' or 'S'")
+	}
+	if c.Limit < 0 || c.Offset < 0 {
+		return errors.New("limit and offset should not be negative")
+	}
+	return nil
 }
 
 func BookIdCmp(a, b *database.Book) int {
@@ -0,0 +1,110 @@
+package queries
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"library-management-system/database"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor, maybe it is issued for another sort")
+
+// Cursor is the position of the last book of a page in the sorted results,
+// from which the next page continues even if books are added or removed
+// in between. clients see it as an opaque string.
+type Cursor struct {
+	SortBy    SortColumn  `json:"s"`
+	SortOrder Order       `json:"o"`
+	Value     interface{} `json:"v"` // of the sort column
+	BookId    int         `json:"i"` // tie-break of the sort column
+}
+
+// NewCursor returns the cursor after the book in the results sorted by the column and order
+func NewCursor(book *database.Book, sortBy SortColumn, sortOrder Order) string {
+	sortBy, sortOrder = cmp.Or(sortBy, BookId), cmp.Or(sortOrder, Asc)
+	data, _ := json.Marshal(Cursor{
+		SortBy:    sortBy,
+		SortOrder: sortOrder,
+		Value:     sortBy.Value(book),
+		BookId:    book.BookId,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a cursor, which should be issued for the same column and order
+func ParseCursor(cursor string, sortBy SortColumn, sortOrder Order) (Cursor, error) {
+	c := Cursor{}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || json.Unmarshal(data, &c) != nil {
+		return c, ErrInvalidCursor
+	}
+	if c.SortBy != cmp.Or(sortBy, BookId) || c.SortOrder != cmp.Or(sortOrder, Asc) || c.BookId <= 0 {
+		return c, ErrInvalidCursor
+	}
+	// the value should have the type of the column
+	switch c.Value.(type) {
+	case string:
+		if !c.SortBy.textual() {
+			return c, ErrInvalidCursor
+		}
+	case float64:
+		if c.SortBy.textual() {
+			return c, ErrInvalidCursor
+		}
+	default:
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Book returns a book at the position of the cursor, to be compared with the
+// comparator of the sort column
+func (c Cursor) Book() database.Book {
+	book := database.Book{BookId: c.BookId}
+	text, _ := c.Value.(string)
+	number, _ := c.Value.(float64) // numbers are decoded from JSON as float64
+	switch c.SortBy {
+	case Category:
+		book.Category = text
+	case Title:
+		book.Title = text
+	case Press:
+		book.Press = text
+	case Author:
+		book.Author = text
+	case PublishYear:
+		book.PublishYear = int(number)
+	case Price:
+		book.Price = number
+	case Stock:
+		book.Stock = int(number)
+	}
+	return book
+}
+
+// Value returns the value of the column of the book
+func (c SortColumn) Value(book *database.Book) interface{} {
+	switch c {
+	case Category:
+		return book.Category
+	case Title:
+		return book.Title
+	case Press:
+		return book.Press
+	case Author:
+		return book.Author
+	case PublishYear:
+		return book.PublishYear
+	case Price:
+		return book.Price
+	case Stock:
+		return book.Stock
+	}
+	return book.BookId
+}
+
+// textual tells whether the column holds strings
+func (c SortColumn) textual() bool {
+	return c == Category || c == Title || c == Press || c == Author
+}
@@ -0,0 +1,89 @@
+package queries
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+const (
+	MaxFacetValues = 20 // the most frequent values of a facet returned
+	YearBucketSize = 10 // publish years are counted by decade
+)
+
+// PriceBuckets are the bounds between the buckets of prices,
+// the first bucket starts from 0 and the last one is unbounded
+var PriceBuckets = []float64{20, 50, 100, 200}
+
+// FacetCount is the number of matching books having a value, or within a bucket
+type FacetCount struct {
+	Value string  `json:"value"`
+	Count int     `json:"count"`
+	Min   float64 `json:"min,omitempty"` // of a bucket, inclusive, omitted if unbounded
+	Max   float64 `json:"max,omitempty"` // of a bucket, exclusive, omitted if unbounded
+}
+
+// Facets counts the books matching all conditions by the values of their fields.
+// values are sorted by count DESC, value ASC, and buckets by their bounds.
+type Facets struct {
+	Category    []FacetCount `json:"category"`
+	Press       []FacetCount `json:"press"`
+	Author      []FacetCount `json:"author"` // by each author of a book
+	PublishYear []FacetCount `json:"publish_year"`
+	Price       []FacetCount `json:"price"`
+}
+
+// YearBucket returns the first year of the bucket of a publish year
+func YearBucket(year int) int {
+	return year - year%YearBucketSize
+}
+
+// YearFacet returns the count of the bucket starting from the year
+func YearFacet(start int, count int) FacetCount {
+	return FacetCount{
+		Value: fmt.Sprintf("%d-%d", start, start+YearBucketSize-1),
+		Count: count,
+		Min:   float64(start),
+		Max:   float64(start + YearBucketSize),
+	}
+}
+
+// PriceBucket returns the index of the bucket of a price in PriceBuckets
+func PriceBucket(price float64) int {
+	bucket, _ := slices.BinarySearch(PriceBuckets, price)
+	if bucket < len(PriceBuckets) && PriceBuckets[bucket] == price {
+		bucket++ // the bound belongs to the bucket above
+	}
+	return bucket
+}
+
+// PriceFacet returns the count of the bucket of the index in PriceBuckets
+func PriceFacet(bucket int, count int) FacetCount {
+	facet := FacetCount{Count: count}
+	if bucket > 0 {
+		facet.Min = PriceBuckets[bucket-1]
+	}
+	if bucket < len(PriceBuckets) {
+		facet.Max = PriceBuckets[bucket]
+		facet.Value = fmt.Sprintf("%g-%g", facet.Min, facet.Max)
+	} else {
+		facet.Value = fmt.Sprintf("%g+", facet.Min)
+	}
+	return facet
+}
+
+// CountValues returns the facet of the values, as FacetCount of the most frequent ones
+func CountValues(values []string) []FacetCount {
+	counts := make(map[string]int)
+	for _, value := range values {
+		counts[value]++
+	}
+	facet := make([]FacetCount, 0, len(counts))
+	for value, count := range counts {
+		facet = append(facet, FacetCount{Value: value, Count: count})
+	}
+	slices.SortFunc(facet, func(a, b FacetCount) int {
+		return cmp.Or(b.Count-a.Count, cmp.Compare(a.Value, b.Value))
+	})
+	return facet[:min(len(facet), MaxFacetValues)]
+}
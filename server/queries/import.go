@@ -0,0 +1,83 @@
+package queries
+
+import (
+	"fmt"
+	"library-management-system/database"
+)
+
+type ImportMode string
+
+const (
+	AllOrNothing ImportMode = "all"         // nothing is imported if any row fails
+	BestEffort   ImportMode = "best_effort" // the rows that pass are imported, and the others are reported
+)
+
+var ImportModes = []ImportMode{AllOrNothing, BestEffort}
+
+// ImportOptions
+//
+// Note: the header of the CSV names the columns, case-insensitively,
+//
+//	or is mapped to them by Columns, eg: {"Publisher": "press"}.
+type ImportOptions struct {
+	Mode    ImportMode        `json:"mode"`    /* Note: AllOrNothing by default */
+	DryRun  bool              `json:"dryRun"`  /* Note: check all rows against the database, then roll back */
+	Columns map[string]string `json:"columns"` /* Note: column of each header name, "" to ignore the header */
+}
+
+func (o ImportOptions) String() string {
+	return fmt.Sprintf("ImportOptions{Mode: `%s`, DryRun: `%t`, Columns: `%v`}", o.Mode, o.DryRun, o.Columns)
+}
+
+// RowError tells why a row of the CSV cannot be imported
+type RowError struct {
+	Line    int                `json:"line"` // in the CSV, where the header is line 1
+	Message string             `json:"message"`
+	Code    database.ErrorCode `json:"code"`
+}
+
+type ImportResult struct {
+	Mode     ImportMode `json:"mode"`
+	DryRun   bool       `json:"dry_run"`
+	Rows     int        `json:"rows"`     // number of rows after the header
+	Valid    int        `json:"valid"`    // number of rows that can be imported
+	Imported int        `json:"imported"` // number of rows imported, 0 if rolled back
+	Errors   []RowError `json:"errors"`   // sorted by line
+}
+
+type MARCFormat string
+
+const (
+	ISO2709 MARCFormat = "marc"    // MARC21 in ISO 2709
+	MARCXML MARCFormat = "marcxml" // MARC21 in XML
+)
+
+var MARCFormats = []MARCFormat{ISO2709, MARCXML}
+
+// MARCOptions
+//
+// Note: the category of a book is taken from CategoryField, eg: 084$a,
+//
+//	or from the field configured by the marc section in config.yaml.
+type MARCOptions struct {
+	Format        MARCFormat `json:"format"`         /* Note: ISO2709 by default */
+	CategoryField string     `json:"category_field"` /* Note: subfield of the category, the configured one if empty */
+}
+
+func (o MARCOptions) String() string {
+	return fmt.Sprintf("MARCOptions{Format: `%s`, CategoryField: `%s`}", o.Format, o.CategoryField)
+}
+
+// RecordError tells why a MARC record cannot be mapped onto a book
+type RecordError struct {
+	Record  int    `json:"record"`  // position of the record, from 1
+	Control string `json:"control"` // control number in 001 of the record, if any
+	Message string `json:"message"`
+}
+
+type MARCImportResult struct {
+	Format   MARCFormat    `json:"format"`
+	Records  int           `json:"records"`  // number of records read
+	Imported int           `json:"imported"` // number of books stored, 0 if the batch fails
+	Errors   []RecordError `json:"errors"`   // the records that cannot be mapped, which are skipped, and the one rejected if the batch fails
+}
@@ -0,0 +1,212 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+type Interval string
+
+const (
+	Daily   Interval = "day"
+	Weekly  Interval = "week" // starting on Monday
+	Monthly Interval = "month"
+)
+
+var Intervals = []Interval{Daily, Weekly, Monthly}
+
+const DefaultTopBooks = 10 // the number of top books if no limit is given
+
+// ReportConditions
+//
+// Note: a report counts the borrows within the window of borrow time,
+//
+//	which is a closed interval as {@link BookQueryConditions},
+//	and periods are in UTC.
+type ReportConditions struct {
+	From     int64    `json:"from"`     /* Note: in unix milliseconds, unbounded if 0 */
+	To       int64    `json:"to"`       /* Note: in unix milliseconds, unbounded if 0 */
+	Limit    int      `json:"limit"`    /* Note: the number of top books, DefaultTopBooks if 0 */
+	Interval Interval `json:"interval"` /* Note: the period of a time series, Daily by default */
+}
+
+func (c ReportConditions) String() string {
+	return fmt.Sprintf("ReportConditions{From: `%d`, To: `%d`, Limit: `%d`, Interval: `%s`}",
+		c.From, c.To, c.Limit, c.Interval)
+}
+
+// Check returns the error of the first invalid condition, or nil
+func (c ReportConditions) Check() error {
+	if c.From < 0 || c.To < 0 || (c.To != 0 && c.From > c.To) {
+		return errors.New("invalid window, expect 0 <= from <= to")
+	}
+	if c.Limit < 0 {
+		return errors.New("limit should not be negative")
+	}
+	if c.Interval != "" && !slices.Contains(Intervals, c.Interval) {
+		return errors.New("invalid interval, expect day, week or month")
+	}
+	return nil
+}
+
+// Report is the result of a report, which can be exported as a table
+type Report interface {
+	Table() (header []string, rows [][]string)
+}
+
+type BookLoans struct {
+	BookId   int    `json:"book_id"`
+	Title    string `json:"title"`
+	Author   string `json:"author"`
+	Category string `json:"category"`
+	Loans    int    `json:"loans"`
+}
+
+type TopBooks struct {
+	Count int         `json:"count"`
+	Items []BookLoans `json:"items"` // sorted by loans DESC, book_id ASC
+}
+
+func (r TopBooks) Table() ([]string, [][]string) {
+	rows := make([][]string, 0, len(r.Items))
+	for _, item := range r.Items {
+		rows = append(rows, []string{strconv.Itoa(item.BookId), item.Title, item.Author, item.Category, strconv.Itoa(item.Loans)})
+	}
+	return []string{"book_id", "title", "author", "category", "loans"}, rows
+}
+
+type GroupLoans struct {
+	Group string `json:"group" gorm:"column:group_name"` // group is a keyword of SQL
+	Loans int    `json:"loans"`
+}
+
+// LoansByGroup counts the loans by the category of the book, or the department of the card
+type LoansByGroup struct {
+	GroupBy string       `json:"group_by"`
+	Count   int          `json:"count"`
+	Items   []GroupLoans `json:"items"` // sorted by loans DESC, group ASC
+}
+
+func (r LoansByGroup) Table() ([]string, [][]string) {
+	rows := make([][]string, 0, len(r.Items))
+	for _, item := range r.Items {
+		rows = append(rows, []string{item.Group, strconv.Itoa(item.Loans)})
+	}
+	return []string{r.GroupBy, "loans"}, rows
+}
+
+// LoanDuration is the average duration of the returned loans
+type LoanDuration struct {
+	Returned    int     `json:"returned"` // number of returned loans
+	Average     int64   `json:"average"`  // in milliseconds
+	AverageDays float64 `json:"average_days"`
+}
+
+func (r LoanDuration) Table() ([]string, [][]string) {
+	return []string{"returned", "average", "average_days"}, [][]string{{
+		strconv.Itoa(r.Returned), strconv.FormatInt(r.Average, 10), strconv.FormatFloat(r.AverageDays, 'f', 2, 64),
+	}}
+}
+
+// CardActivity counts the cards that borrowed within the window, and those that did not
+type CardActivity struct {
+	Total   int `json:"total"`
+	Active  int `json:"active"`
+	Dormant int `json:"dormant"`
+}
+
+func (r CardActivity) Table() ([]string, [][]string) {
+	return []string{"total", "active", "dormant"}, [][]string{{
+		strconv.Itoa(r.Total), strconv.Itoa(r.Active), strconv.Itoa(r.Dormant),
+	}}
+}
+
+type PeriodLoans struct {
+	Period string `json:"period"` // eg: 2024-01-31, 2024-W05 or 2024-01
+	Start  int64  `json:"start"`  // in unix milliseconds
+	Loans  int    `json:"loans"`
+}
+
+// LoanSeries counts the loans of each period, from the first loan to the last one
+type LoanSeries struct {
+	Interval Interval      `json:"interval"`
+	Count    int           `json:"count"`
+	Items    []PeriodLoans `json:"items"`
+}
+
+func (r LoanSeries) Table() ([]string, [][]string) {
+	rows := make([][]string, 0, len(r.Items))
+	for _, item := range r.Items {
+		rows = append(rows, []string{item.Period, strconv.FormatInt(item.Start, 10), strconv.Itoa(item.Loans)})
+	}
+	return []string{"period", "start", "loans"}, rows
+}
+
+// PeriodStart returns the start of the period of the interval containing t, in UTC
+func PeriodStart(t time.Time, interval Interval) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case Weekly:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case Monthly:
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+	return day
+}
+
+// NextPeriod returns the start of the period after the one starting from start
+func NextPeriod(start time.Time, interval Interval) time.Time {
+	switch interval {
+	case Weekly:
+		return start.AddDate(0, 0, 7)
+	case Monthly:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// PeriodName returns the name of the period starting from start
+func PeriodName(start time.Time, interval Interval) string {
+	switch interval {
+	case Weekly:
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case Monthly:
+		return start.Format("2006-01")
+	}
+	return start.Format("2006-01-02")
+}
+
+// Series counts the loans of each period from the loans of each day,
+// given by the start of the day in unix milliseconds
+func Series(days map[int64]int, interval Interval) LoanSeries {
+	series := LoanSeries{Interval: interval, Items: make([]PeriodLoans, 0)}
+	if len(days) == 0 {
+		return series
+	}
+	periods := make(map[time.Time]int)
+	first, last := time.Time{}, time.Time{}
+	for day, loans := range days {
+		start := PeriodStart(time.UnixMilli(day), interval)
+		periods[start] += loans
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if start.After(last) {
+			last = start
+		}
+	}
+	for start := first; !start.After(last); start = NextPeriod(start, interval) {
+		series.Items = append(series.Items, PeriodLoans{
+			Period: PeriodName(start, interval),
+			Start:  start.UnixMilli(),
+			Loans:  periods[start],
+		})
+	}
+	series.Count = len(series.Items)
+	return series
+}
@@ -1,13 +1,146 @@
 package queries
 
-import "library-management-system/database"
+import (
+	"library-management-system/database"
+	"time"
+)
 
 type BookQueryResults struct {
-	Count   int             `json:"count"`
-	Results []database.Book `json:"results"`
+	Count      int             `json:"count"`                 // number of results in the page
+	Total      int             `json:"total"`                 // number of all matching books
+	Results    []database.Book `json:"results"`               // the page
+	NextCursor string          `json:"next_cursor,omitempty"` // cursor of the next page, empty on the last page
+
+	Highlights map[int]Highlight `json:"highlights,omitempty"` // the matches of the search in each book of the page by book_id
+	Facets     *Facets           `json:"facets,omitempty"`     // over all matching books, if asked for by the conditions
 }
 
 type BorrowHistories struct {
-	Count int               `json:"count"`
-	Items []database.Borrow `json:"items"`
+	Count int          `json:"count"`
+	Items []BorrowItem `json:"items"`
+}
+
+type LoanStatus string
+
+const (
+	OnLoan         LoanStatus = "on_loan"       // not returned, and not due yet
+	Overdue        LoanStatus = "overdue"       // not returned, and past the due time
+	ReturnedLate   LoanStatus = "returned_late" // returned after the due time
+	ReturnedOnTime LoanStatus = "returned"      // returned by the due time
+)
+
+// BorrowItem is a borrow with the details of the book and the holder of the card
+type BorrowItem struct {
+	database.Borrow `gorm:"embedded"`
+	Title           string     `json:"title"`
+	Author          string     `json:"author"`
+	Category        string     `json:"category"`
+	Price           float64    `json:"price"`
+	Name            string     `json:"name"`              // of the card holder
+	Department      string     `json:"department"`        // of the card holder
+	Duration        int64      `json:"duration" gorm:"-"` // of the loan in milliseconds, until now if not returned
+	Status          LoanStatus `json:"status" gorm:"-"`
+	DaysLate        int        `json:"days_late" gorm:"-"` // after the due time, until now if not returned
+}
+
+// Resolve sets the duration, status and days late of the loan at now, in unix milliseconds.
+// a borrow without due time is never late.
+func (item *BorrowItem) Resolve(now int64) {
+	end := item.ReturnTime
+	if end == 0 {
+		end = now
+	}
+	item.Duration = max(end-item.BorrowTime, 0)
+	item.DaysLate = 0
+	if item.DueTime > 0 {
+		item.DaysLate = DaysLate(item.DueTime, end)
+	}
+	switch {
+	case item.ReturnTime == 0 && item.DaysLate > 0:
+		item.Status = Overdue
+	case item.ReturnTime == 0:
+		item.Status = OnLoan
+	case item.DaysLate > 0:
+		item.Status = ReturnedLate
+	default:
+		item.Status = ReturnedOnTime
+	}
+}
+
+type BorrowQueryResults struct {
+	Count int          `json:"count"` // number of results in the page
+	Total int          `json:"total"` // number of all matching borrows
+	Items []BorrowItem `json:"items"`
+}
+
+type OverdueItem struct {
+	CardId     int    `json:"card_id"`
+	Name       string `json:"name"`
+	Department string `json:"department"`
+	BookId     int    `json:"book_id"`
+	Title      string `json:"title"`
+	BorrowTime int64  `json:"borrow_time"`
+	DueTime    int64  `json:"due_time"`
+	DaysLate   int    `json:"days_late" gorm:"-"`
+}
+
+type OverdueBorrows struct {
+	Count int           `json:"count"`
+	Items []OverdueItem `json:"items"`
+}
+
+// DaysLate returns the number of started days between dueTime and at,
+// both in unix milliseconds. It is 0 if at is not after dueTime.
+func DaysLate(dueTime, at int64) int {
+	if at <= dueTime {
+		return 0
+	}
+	day := (24 * time.Hour).Milliseconds()
+	return int((at - dueTime + day - 1) / day)
+}
+
+type HoldItem struct {
+	database.Hold `gorm:"embedded"`
+	Title         string `json:"title"`
+	Position      int    `json:"position"` // position in the queue of a waiting hold, 0 otherwise
+}
+
+type HoldList struct {
+	Count int        `json:"count"`
+	Items []HoldItem `json:"items"`
+}
+
+type FineList struct {
+	Count   int               `json:"count"`
+	Balance float64           `json:"balance"` // unpaid amount of all fines
+	Fines   []database.Fine   `json:"fines"`
+	Ledger  []database.Ledger `json:"ledger"`
+}
+
+type CopyList struct {
+	Count  int             `json:"count"`
+	Copies []database.Copy `json:"copies"`
+}
+
+type ContributorItem struct {
+	ContributorId int    `json:"contributor_id"`
+	Name          string `json:"name"`
+	Role          string `json:"role"`
+}
+
+type ContributorList struct {
+	Count        int               `json:"count"`
+	Contributors []ContributorItem `json:"contributors"`
+}
+
+type AccountList struct {
+	Count    int                `json:"count"`
+	Accounts []database.Account `json:"accounts"`
+}
+
+// Session is the token issued to an account on logging in
+type Session struct {
+	Token     string           `json:"token"`      // sent as "Authorization: Bearer <token>"
+	ExpiresAt int64            `json:"expires_at"` // in unix milliseconds
+	Account   database.Account `json:"account"`
 }
@@ -0,0 +1,113 @@
+package queries
+
+import (
+	"html"
+	"library-management-system/database"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// MaxSearchTerms is the number of terms of a search used, the rest are ignored
+const MaxSearchTerms = 16
+
+// SearchField is a field of books searched by BookQueryConditions.Q
+type SearchField struct {
+	Name   string  // the column, and the key in Highlight
+	Weight float64 // how much a match in the field counts in the relevance
+	Value  func(book *database.Book) string
+}
+
+// SearchFields are the fields of books in the full-text index, from the most relevant
+var SearchFields = []SearchField{
+	{"title", 3, func(book *database.Book) string { return book.Title }},
+	{"author", 2, func(book *database.Book) string { return book.Author }},
+	{"category", 1, func(book *database.Book) string { return book.Category }},
+	{"press", 1, func(book *database.Book) string { return book.Press }},
+}
+
+// Highlight holds the fields of a book matching the search, with the terms
+// marked by <mark></mark>. the rest of the text is HTML escaped.
+type Highlight map[string]string
+
+// SearchTerms splits a search into lower-case words of letters and digits
+func SearchTerms(q string) []string {
+	terms := make([]string, 0)
+	for _, term := range strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !slices.Contains(terms, term) && len(terms) < MaxSearchTerms {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// Relevance returns the sum of the weights of the fields containing each term,
+// or 0 if any term is in none of the fields
+func Relevance(book *database.Book, terms []string) float64 {
+	relevance := 0.0
+	for _, term := range terms {
+		matched := false
+		for _, field := range SearchFields {
+			if strings.Contains(strings.ToLower(field.Value(book)), term) {
+				relevance += field.Weight
+				matched = true
+			}
+		}
+		if !matched {
+			return 0
+		}
+	}
+	return relevance
+}
+
+// Highlights returns the fields of the book containing any of the terms, with the terms marked
+func Highlights(book *database.Book, terms []string) Highlight {
+	highlight := make(Highlight)
+	for _, field := range SearchFields {
+		if marked, ok := mark(field.Value(book), terms); ok {
+			highlight[field.Name] = marked
+		}
+	}
+	return highlight
+}
+
+// mark wraps the occurrences of the terms in text with <mark></mark>,
+// and returns false if there is none
+func mark(text string, terms []string) (string, bool) {
+	// Find the runes covered by any term, case-insensitively
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) { // the case mapping changes the length, give up marking
+		return html.EscapeString(text), false
+	}
+	covered := make([]bool, len(runes))
+	found := false
+	for _, term := range terms {
+		pattern := []rune(term)
+		for i := 0; i+len(pattern) <= len(lower); i++ {
+			if slices.Equal(lower[i:i+len(pattern)], pattern) {
+				for j := i; j < i+len(pattern); j++ {
+					covered[j] = true
+				}
+				found = true
+			}
+		}
+	}
+	if !found {
+		return "", false
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(runes); i++ {
+		if covered[i] && (i == 0 || !covered[i-1]) {
+			builder.WriteString("<mark>")
+		}
+		builder.WriteString(html.EscapeString(string(runes[i])))
+		if covered[i] && (i == len(runes)-1 || !covered[i+1]) {
+			builder.WriteString("</mark>")
+		}
+	}
+	return builder.String(), true
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/csv"
+	"library-management-system/database"
+	"library-management-system/server/queries"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reports are the reports of circulation by the name of their routes
+var reports = map[string]func(s *Server, conditions queries.ReportConditions) database.APIResult{
+	"top-books":   (*Server).ReportTopBooks,
+	"categories":  (*Server).ReportLoansByCategory,
+	"departments": (*Server).ReportLoansByDepartment,
+	"duration":    (*Server).ReportLoanDuration,
+	"cards":       (*Server).ReportCardActivity,
+	"series":      (*Server).ReportLoanSeries,
+}
+
+// reportHandler responds the report with the conditions of the request parameters,
+// as CSV if asked by format=csv, or as JSON
+func reportHandler(name string, status bool) http.HandlerFunc {
+	report := reports[name]
+	return func(w http.ResponseWriter, r *http.Request) {
+		server := Server{}
+		params := r.URL.Query()
+		format := params.Get("format")
+		if format != "" && format != "json" && format != "csv" {
+			server.respond(w, badRequest("invalid format, expect json or csv"), status)
+			return
+		}
+		result := report(&server, reportConditions(params))
+		if format != "csv" || !result.Ok {
+			server.respond(w, result, status)
+			return
+		}
+		header, rows := result.Payload.(queries.Report).Table()
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+		writer := csv.NewWriter(w)
+		_ = writer.Write(header)
+		_ = writer.WriteAll(rows)
+		if err := writer.Error(); err != nil {
+			logrus.WithError(err).Error("unable to response")
+		}
+	}
+}
+
+// respond writes the result as JSON, with the HTTP status of the result
+// for the REST API v2, or always 200 as v1
+func (s *Server) respond(w http.ResponseWriter, result database.APIResult, status bool) {
+	if status {
+		s.ResponseStatus(w, result, http.StatusOK)
+	} else {
+		s.Response(w, result)
+	}
+}
+
+// reportConditions parses the conditions of a report from the request parameters,
+// ignoring numbers that fail to parse
+func reportConditions(params url.Values) queries.ReportConditions {
+	number := func(key string) int64 {
+		n, err := strconv.ParseInt(params.Get(key), 10, 64)
+		if err != nil {
+			return 0
+		}
+		return n
+	}
+	return queries.ReportConditions{
+		From:     number("from"),
+		To:       number("to"),
+		Limit:    int(number("limit")),
+		Interval: queries.Interval(params.Get("interval")),
+	}
+}
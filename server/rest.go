@@ -0,0 +1,530 @@
+package server
+
+import (
+	"encoding/json"
+	"library-management-system/database"
+	"library-management-system/server/queries"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/**
+ * REST API v2
+ *
+ * resources are addressed by path, and the method tells what to do with them:
+ * GET reads, POST creates (or performs an action), PATCH modifies, PUT replaces
+ * and DELETE removes. the body is the same database.APIResult as in v1, but the
+ * HTTP status tells whether the request succeeded:
+ *
+ *	200 OK, 201 Created           the request succeeded
+ *	400 Bad Request               the request cannot be parsed
+ *	401 Unauthorized              the request has no valid token, see {@link authorize}
+ *	403 Forbidden                 the role of the account is not permitted to the request
+ *	404 Not Found                 the resource does not exist
+ *	409 Conflict                  the request conflicts with the state of the library
+ *	422 Unprocessable Entity      the request breaks the rules of the library
+ *	500 Internal Server Error     the request failed in the database
+ *
+ * and the code of the result tells why, see {@link database.ErrorCode#Status}.
+ *
+ * the v1 routes are kept unchanged for the frontend.
+ */
+
+// registerV2 adds the routes of the REST API v2 to mux
+func registerV2(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v2/books", authorize(public, queryBooksV2))
+	mux.HandleFunc("POST /api/v2/books", authorize(staff, storeBookV2))
+	mux.HandleFunc("POST /api/v2/books/batch", authorize(staff, storeBooksV2))
+	mux.HandleFunc("POST /api/v2/books/import", authorize(staff, importHandler((*Server).ImportBooks, true)))
+	mux.HandleFunc("GET /api/v2/books/export", authorize(staff, exportBooksHandler(true)))
+	mux.HandleFunc("POST /api/v2/books/import/marc", authorize(staff, importMARCHandler(true)))
+	mux.HandleFunc("GET /api/v2/books/{id}", authorize(public, queryBookV2))
+	mux.HandleFunc("PATCH /api/v2/books/{id}", authorize(staff, modifyBookV2))
+	mux.HandleFunc("DELETE /api/v2/books/{id}", authorize(staff, removeBookV2))
+	mux.HandleFunc("POST /api/v2/books/{id}/stock", authorize(staff, incBookStockV2))
+	mux.HandleFunc("GET /api/v2/books/{id}/copies", authorize(public, showCopiesV2))
+	mux.HandleFunc("POST /api/v2/books/{id}/copies", authorize(staff, addCopyV2))
+	mux.HandleFunc("GET /api/v2/books/{id}/contributors", authorize(public, showContributorsV2))
+	mux.HandleFunc("PUT /api/v2/books/{id}/contributors", authorize(staff, modifyContributorsV2))
+	mux.HandleFunc("GET /api/v2/books/{id}/holds", authorize(staff, showBookHoldsV2))
+
+	mux.HandleFunc("GET /api/v2/isbn/{isbn}", authorize(public, queryBookByISBNV2))
+	mux.HandleFunc("PATCH /api/v2/copies/{id}", authorize(staff, modifyCopyV2))
+
+	mux.HandleFunc("GET /api/v2/cards", authorize(staff, showCardsV2))
+	mux.HandleFunc("POST /api/v2/cards", authorize(staff, registerCardV2))
+	mux.HandleFunc("POST /api/v2/cards/import", authorize(staff, importHandler((*Server).ImportCards, true)))
+	mux.HandleFunc("GET /api/v2/cards/export", authorize(staff, exportCardsHandler(true)))
+	mux.HandleFunc("DELETE /api/v2/cards/{id}", authorize(staff, removeCardV2))
+	mux.HandleFunc("GET /api/v2/cards/{id}/borrows", authorize(ownCard, showBorrowsV2))
+	mux.HandleFunc("GET /api/v2/cards/{id}/holds", authorize(ownCard, showCardHoldsV2))
+	mux.HandleFunc("DELETE /api/v2/cards/{id}/holds/{book_id}", authorize(ownCard, cancelHoldV2))
+	mux.HandleFunc("GET /api/v2/cards/{id}/fines", authorize(ownCard, showFinesV2))
+	mux.HandleFunc("POST /api/v2/cards/{id}/payments", authorize(staff, payFineV2))
+
+	mux.HandleFunc("GET /api/v2/borrows", authorize(staff, searchBorrowsV2))
+	mux.HandleFunc("POST /api/v2/borrows", authorize(staff, borrowBookV2))
+	mux.HandleFunc("POST /api/v2/borrows/return", authorize(staff, returnBookV2))
+	mux.HandleFunc("POST /api/v2/borrows/renew", authorize(staff, renewBookV2))
+	mux.HandleFunc("GET /api/v2/borrows/overdue", authorize(staff, showOverdueV2))
+
+	mux.HandleFunc("POST /api/v2/holds", authorize(staff, placeHoldV2))
+
+	mux.HandleFunc("POST /api/v2/fines/{id}/waivers", authorize(staff, waiveFineV2))
+
+	mux.HandleFunc("GET /api/v2/me/borrows", authorize(self, showSelfBorrowsV2))
+	mux.HandleFunc("POST /api/v2/me/borrows", authorize(self, borrowSelfV2))
+	mux.HandleFunc("POST /api/v2/me/borrows/renew", authorize(self, renewSelfV2))
+	mux.HandleFunc("GET /api/v2/me/holds", authorize(self, showSelfHoldsV2))
+	mux.HandleFunc("POST /api/v2/me/holds", authorize(self, placeSelfHoldV2))
+	mux.HandleFunc("DELETE /api/v2/me/holds/{book_id}", authorize(self, cancelSelfHoldV2))
+	mux.HandleFunc("GET /api/v2/me/fines", authorize(self, showSelfFinesV2))
+
+	for name := range reports {
+		mux.HandleFunc("GET /api/v2/reports/"+name, authorize(staff, reportHandler(name, true)))
+	}
+
+	mux.HandleFunc("POST /api/v2/auth/login", authorize(public, loginV2))
+	mux.HandleFunc("GET /api/v2/auth/me", authorize(loggedIn, whoAmIV2))
+	mux.HandleFunc("GET /api/v2/accounts", authorize(adminOnly, showAccountsV2))
+	mux.HandleFunc("POST /api/v2/accounts", authorize(adminOnly, registerAccountV2))
+	mux.HandleFunc("DELETE /api/v2/accounts/{id}", authorize(adminOnly, removeAccountV2))
+}
+
+// ResponseStatus
+// write the result with the status of a successful request,
+// or the status of the error code of the failure
+func (s *Server) ResponseStatus(w http.ResponseWriter, resp database.APIResult, status int) {
+	if !resp.Ok {
+		status = resp.Code.Status()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	s.Response(w, resp)
+}
+
+// badRequest is the failure of a request that cannot be parsed
+func badRequest(message string) database.APIResult {
+	return database.APIResult{
+		Ok:      false,
+		Message: "Invalid Arguments: " + message,
+		Payload: nil,
+		Code:    database.ErrInvalidArgument,
+	}
+}
+
+// decodeBody decodes the request body into v, or responds 400 and returns false
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		server := Server{}
+		server.ResponseStatus(w, badRequest("failed to parse request body"), 0)
+		return false
+	}
+	return true
+}
+
+// pathId parses the positive integer of the path wildcard name,
+// or responds 400 and returns false
+func pathId(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil || id <= 0 {
+		server := Server{}
+		server.ResponseStatus(w, badRequest("failed to parse "+name+", expect positive integer"), 0)
+		return 0, false
+	}
+	return id, true
+}
+
+/* Routes for books */
+
+func queryBooksV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	result := server.QueryBooks(bookQueryConditions(r.URL.Query()))
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func storeBookV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	var book database.Book
+	if !decodeBody(w, r, &book) {
+		return
+	}
+	book.BookId = 0 // BookID is assigned by the library
+	result := server.StoreBook(&book)
+	server.ResponseStatus(w, result, http.StatusCreated)
+}
+
+func storeBooksV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	var list queries.BookList
+	if !decodeBody(w, r, &list) {
+		return
+	}
+	books := make([]*database.Book, 0, len(list.Books))
+	for i := range list.Books {
+		list.Books[i].BookId = 0
+		books = append(books, &list.Books[i])
+	}
+	result := server.StoreBooks(books)
+	server.ResponseStatus(w, result, http.StatusCreated)
+}
+
+func queryBookByISBNV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	result := server.QueryBookByISBN(r.PathValue("isbn"))
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func queryBookV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	bookId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	result := server.QueryBook(bookId)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func modifyBookV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	bookId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	var book database.Book
+	if !decodeBody(w, r, &book) {
+		return
+	}
+	book.BookId = bookId
+	result := server.ModifyBookInfo(&book)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func removeBookV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	bookId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	result := server.RemoveBook(bookId)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func incBookStockV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	bookId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	var query struct {
+		DeltaStock int `json:"delta_stock"`
+	}
+	if !decodeBody(w, r, &query) {
+		return
+	}
+	result := server.IncBookStock(bookId, query.DeltaStock)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func showCopiesV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	bookId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	result := server.ShowCopies(bookId, "")
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func addCopyV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	bookId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	var copy database.Copy
+	if !decodeBody(w, r, &copy) {
+		return
+	}
+	copy.CopyId, copy.BookId = 0, bookId
+	result := server.AddCopy(&copy)
+	server.ResponseStatus(w, result, http.StatusCreated)
+}
+
+func showContributorsV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	bookId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	result := server.ShowContributors(bookId)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func modifyContributorsV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	bookId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	var contributors []queries.ContributorItem
+	if !decodeBody(w, r, &contributors) {
+		return
+	}
+	result := server.ModifyContributors(bookId, contributors)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func showBookHoldsV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	bookId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	result := server.ShowHolds(0, bookId)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+/* Routes for copies */
+
+func modifyCopyV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	copyId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	var copy database.Copy
+	if !decodeBody(w, r, &copy) {
+		return
+	}
+	copy.CopyId = copyId
+	result := server.ModifyCopy(&copy)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+/* Routes for cards */
+
+func showCardsV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	result := server.ShowCards()
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func registerCardV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	var card database.Card
+	if !decodeBody(w, r, &card) {
+		return
+	}
+	card.CardId = 0 // CardID is assigned by the library
+	result := server.RegisterCard(&card)
+	server.ResponseStatus(w, result, http.StatusCreated)
+}
+
+func removeCardV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	cardId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	result := server.RemoveCard(cardId)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func showBorrowsV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	cardId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	result := server.ShowBorrowHistories(cardId)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func showCardHoldsV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	cardId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	result := server.ShowHolds(cardId, 0)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func cancelHoldV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	cardId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	bookId, ok := pathId(w, r, "book_id")
+	if !ok {
+		return
+	}
+	result := server.CancelHold(database.Hold{CardId: cardId, BookId: bookId})
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func showFinesV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	cardId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	result := server.ShowFines(cardId)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func payFineV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	cardId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	var payment database.Ledger
+	if !decodeBody(w, r, &payment) {
+		return
+	}
+	payment.CardId = cardId
+	if payment.Time == 0 {
+		payment.Time = time.Now().UnixMilli()
+	}
+	result := server.PayFine(payment)
+	server.ResponseStatus(w, result, http.StatusCreated)
+}
+
+/* Routes for borrows */
+
+func borrowBookV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	var request borrowRequest
+	if !decodeBody(w, r, &request) {
+		return
+	}
+	borrow, failure := request.resolve(&server)
+	if failure != nil {
+		server.ResponseStatus(w, *failure, 0)
+		return
+	}
+	borrow.ReturnTime = 0
+	result := server.BorrowBook(borrow)
+	server.ResponseStatus(w, result, http.StatusCreated)
+}
+
+func returnBookV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	var borrow database.Borrow
+	if !decodeBody(w, r, &borrow) {
+		return
+	}
+	if borrow.ReturnTime == 0 {
+		borrow.ResetReturnTime()
+	}
+	result := server.ReturnBook(borrow)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func renewBookV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	var borrow database.Borrow
+	if !decodeBody(w, r, &borrow) {
+		return
+	}
+	result := server.RenewBorrow(borrow)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func showOverdueV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	result := server.ShowOverdueBorrows(time.Now().UnixMilli())
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func searchBorrowsV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	result := server.SearchBorrows(borrowQueryConditions(r.URL.Query()))
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+/* Routes for holds & fines */
+
+func placeHoldV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	var hold database.Hold
+	if !decodeBody(w, r, &hold) {
+		return
+	}
+	if hold.HoldTime == 0 {
+		hold.ResetHoldTime()
+	}
+	result := server.PlaceHold(hold)
+	server.ResponseStatus(w, result, http.StatusCreated)
+}
+
+func waiveFineV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	fineId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	var waiver database.Ledger
+	if !decodeBody(w, r, &waiver) {
+		return
+	}
+	waiver.FineId = fineId
+	if waiver.Time == 0 {
+		waiver.Time = time.Now().UnixMilli()
+	}
+	result := server.WaiveFine(waiver)
+	server.ResponseStatus(w, result, http.StatusCreated)
+}
+
+/* Routes for accounts */
+
+func loginV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	var login loginRequest
+	if !decodeBody(w, r, &login) {
+		return
+	}
+	result := server.Login(login.Username, login.Password)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func whoAmIV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	claims, _ := identity(r)
+	server.ResponseStatus(w, database.APIResult{
+		Ok:      true,
+		Message: "Logged in as " + claims.Username,
+		Payload: claims,
+	}, http.StatusOK)
+}
+
+func showAccountsV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	result := server.ShowAccounts()
+	server.ResponseStatus(w, result, http.StatusOK)
+}
+
+func registerAccountV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	var account database.Account
+	if !decodeBody(w, r, &account) {
+		return
+	}
+	account.AccountId = 0 // AccountID is assigned by the library
+	result := server.RegisterAccount(&account)
+	server.ResponseStatus(w, result, http.StatusCreated)
+}
+
+func removeAccountV2(w http.ResponseWriter, r *http.Request) {
+	server := Server{}
+	accountId, ok := pathId(w, r, "id")
+	if !ok {
+		return
+	}
+	result := server.RemoveAccount(accountId)
+	server.ResponseStatus(w, result, http.StatusOK)
+}
@@ -0,0 +1,413 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"library-management-system/database"
+	"library-management-system/server/auth"
+	"library-management-system/server/queries"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// request sends a request with the body in JSON and the token if not empty, and returns
+// the status and the result, whose payload is decoded into payload if not nil
+func request(t *testing.T, base string, token string, method string, path string, body interface{}, payload interface{}) (int, bool) {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		if raw, ok := body.(string); ok {
+			reader = bytes.NewBufferString(raw)
+		} else {
+			data, err := json.Marshal(body)
+			assert.Equal(t, err, nil)
+			reader = bytes.NewReader(data)
+		}
+	}
+	req, err := http.NewRequest(method, base+path, reader)
+	assert.Equal(t, err, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.Equal(t, err, nil)
+	defer resp.Body.Close()
+
+	var result struct {
+		Ok      bool            `json:"ok"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	assert.Equal(t, json.NewDecoder(resp.Body).Decode(&result), nil)
+	if payload != nil && result.Ok {
+		assert.Equal(t, json.Unmarshal(result.Payload, payload), nil)
+	}
+	return resp.StatusCode, result.Ok
+}
+
+// signIn registers an account of the role, with the card of a patron, and returns a token of it
+func signIn(t *testing.T, username string, role string, cardId int) string {
+	account := database.Account{Username: username, Password: username + "-password", Role: role, CardId: cardId}
+	server := Server{}
+	assert.Equal(t, server.RegisterAccount(&account).Ok, true)
+	token, _ := Auth.Sign(auth.Claims{AccountId: account.AccountId, Username: username, Role: role, CardId: cardId}, time.Now())
+	return token
+}
+
+func TestRESTStatus(t *testing.T) {
+	database.ResetDatabase()
+	ts := httptest.NewServer(NewHandler())
+	defer ts.Close()
+	token := signIn(t, "librarian", database.AccountLibrarian, 0)
+	do := func(method string, path string, body interface{}, payload interface{}) int {
+		status, _ := request(t, ts.URL, token, method, path, body, payload)
+		return status
+	}
+
+	/* books */
+	book := database.Book{Category: "CS", Title: "REST", Press: "Press", PublishYear: 2020,
+		Author: "Roy", Price: 10, Stock: 1}
+	assert.Equal(t, do("POST", "/api/v2/books", book, &book), http.StatusCreated)
+	assert.NotEqual(t, book.BookId, 0)
+	assert.Equal(t, do("POST", "/api/v2/books", book, nil), http.StatusConflict)
+	assert.Equal(t, do("POST", "/api/v2/books", `{"title": `, nil), http.StatusBadRequest)
+	invalid := database.Book{Category: "CS", Title: "ISBN", Press: "Press", ISBN: "0-306-40615-3"}
+	assert.Equal(t, do("POST", "/api/v2/books", invalid, nil), http.StatusUnprocessableEntity)
+
+	bookPath := fmt.Sprintf("/api/v2/books/%d", book.BookId)
+	assert.Equal(t, do("PATCH", bookPath, map[string]string{"title": "RESTful"}, nil), http.StatusOK)
+	queried := database.Book{}
+	assert.Equal(t, do("GET", bookPath, nil, &queried), http.StatusOK)
+	assert.Equal(t, queried.Title, "RESTful")
+	assert.Equal(t, do("GET", "/api/v2/books/999999", nil, nil), http.StatusNotFound)
+	assert.Equal(t, do("GET", "/api/v2/books/abc", nil, nil), http.StatusBadRequest)
+	assert.Equal(t, do("POST", bookPath+"/stock", map[string]int{"delta_stock": -5}, nil), http.StatusUnprocessableEntity)
+
+	/* borrows */
+	card := database.Card{Name: "Alice", Department: "CS", Type: "S"}
+	other := database.Card{Name: "Bob", Department: "CS", Type: "S"}
+	assert.Equal(t, do("POST", "/api/v2/cards", card, &card.CardId), http.StatusCreated)
+	assert.Equal(t, do("POST", "/api/v2/cards", other, &other.CardId), http.StatusCreated)
+	assert.Equal(t, do("POST", "/api/v2/cards", card, nil), http.StatusConflict)
+
+	borrow := database.Borrow{CardId: card.CardId, BookId: book.BookId, BorrowTime: 1}
+	assert.Equal(t, do("POST", "/api/v2/borrows", borrow, nil), http.StatusCreated)
+	assert.Equal(t, do("POST", "/api/v2/borrows", borrow, nil), http.StatusConflict)
+	borrow.CardId = other.CardId
+	assert.Equal(t, do("POST", "/api/v2/borrows", borrow, nil), http.StatusConflict)
+	borrow.CardId = 999999
+	assert.Equal(t, do("POST", "/api/v2/borrows", borrow, nil), http.StatusNotFound)
+
+	histories := struct {
+		Count int `json:"count"`
+	}{}
+	cardPath := fmt.Sprintf("/api/v2/cards/%d", card.CardId)
+	assert.Equal(t, do("GET", cardPath+"/borrows", nil, &histories), http.StatusOK)
+	assert.Equal(t, histories.Count, 1)
+	assert.Equal(t, do("DELETE", bookPath, nil, nil), http.StatusConflict)
+	assert.Equal(t, do("DELETE", cardPath, nil, nil), http.StatusConflict)
+
+	ret := database.Borrow{CardId: card.CardId, BookId: book.BookId, ReturnTime: 2}
+	assert.Equal(t, do("POST", "/api/v2/borrows/return", ret, nil), http.StatusOK)
+	assert.Equal(t, do("POST", "/api/v2/borrows/return", ret, nil), http.StatusNotFound)
+
+	/* removal */
+	assert.Equal(t, do("DELETE", cardPath, nil, nil), http.StatusOK)
+	assert.Equal(t, do("DELETE", cardPath, nil, nil), http.StatusNotFound)
+	assert.Equal(t, do("DELETE", bookPath, nil, nil), http.StatusOK)
+	assert.Equal(t, do("GET", bookPath, nil, nil), http.StatusNotFound)
+
+	// v1 keeps answering 200 on failure
+	status, ok := request(t, ts.URL, token, "POST", "/api/book/add", invalid, nil)
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, ok, false)
+}
+
+func TestAuth(t *testing.T) {
+	database.ResetDatabase()
+	ts := httptest.NewServer(NewHandler())
+	defer ts.Close()
+	do := func(token string, method string, path string, body interface{}, payload interface{}) int {
+		status, _ := request(t, ts.URL, token, method, path, body, payload)
+		return status
+	}
+	admin := signIn(t, "admin", database.AccountAdmin, 0)
+	librarian := signIn(t, "librarian", database.AccountLibrarian, 0)
+
+	card := database.Card{Name: "Alice", Department: "CS", Type: "S"}
+	other := database.Card{Name: "Bob", Department: "CS", Type: "S"}
+	assert.Equal(t, do(librarian, "POST", "/api/v2/cards", card, &card.CardId), http.StatusCreated)
+	assert.Equal(t, do(librarian, "POST", "/api/v2/cards", other, &other.CardId), http.StatusCreated)
+
+	/* tokens */
+	assert.Equal(t, do("", "GET", "/api/v2/books", nil, nil), http.StatusOK)
+	assert.Equal(t, do("", "GET", "/api/v2/cards", nil, nil), http.StatusUnauthorized)
+	assert.Equal(t, do("", "POST", "/api/book/remove", nil, nil), http.StatusUnauthorized)
+	assert.Equal(t, do(librarian+"x", "GET", "/api/v2/cards", nil, nil), http.StatusUnauthorized)
+	assert.Equal(t, do("not.a.token", "GET", "/api/v2/books", nil, nil), http.StatusUnauthorized)
+	expired, _ := Auth.Sign(auth.Claims{Username: "librarian", Role: database.AccountLibrarian},
+		time.Now().Add(-auth.DefaultTokenHours*time.Hour))
+	assert.Equal(t, do(expired, "GET", "/api/v2/cards", nil, nil), http.StatusUnauthorized)
+
+	/* accounts */
+	accounts := "/api/v2/accounts"
+	patron := database.Account{Username: "alice", Password: "alice-password", Role: database.AccountPatron, CardId: card.CardId}
+	assert.Equal(t, do(librarian, "POST", accounts, patron, nil), http.StatusForbidden)
+	assert.Equal(t, do(admin, "POST", accounts, patron, &patron.AccountId), http.StatusCreated)
+	assert.Equal(t, do(admin, "POST", accounts, patron, nil), http.StatusConflict)
+	short := database.Account{Username: "bob", Password: "short", Role: database.AccountLibrarian}
+	assert.Equal(t, do(admin, "POST", accounts, short, nil), http.StatusUnprocessableEntity)
+	orphan := database.Account{Username: "carol", Password: "carol-password", Role: database.AccountPatron, CardId: 999999}
+	assert.Equal(t, do(admin, "POST", accounts, orphan, nil), http.StatusNotFound)
+	root := database.Account{Username: "root", Password: "root-password", Role: database.AccountAdmin}
+	assert.Equal(t, do(admin, "POST", accounts, root, &root.AccountId), http.StatusCreated)
+
+	list := struct {
+		Count    int                `json:"count"`
+		Accounts []database.Account `json:"accounts"`
+	}{}
+	assert.Equal(t, do(admin, "GET", accounts, nil, &list), http.StatusOK)
+	assert.Equal(t, list.Count, 4)
+	assert.Equal(t, list.Accounts[0].PasswordHash, "")
+
+	/* login */
+	login := "/api/v2/auth/login"
+	wrong := loginRequest{Username: "alice", Password: "wrong-password"}
+	assert.Equal(t, do("", "POST", login, wrong, nil), http.StatusUnauthorized)
+	wrong = loginRequest{Username: "nobody", Password: "alice-password"}
+	assert.Equal(t, do("", "POST", login, wrong, nil), http.StatusUnauthorized)
+	session := struct {
+		Token string `json:"token"`
+	}{}
+	assert.Equal(t, do("", "POST", login, loginRequest{Username: "alice", Password: "alice-password"}, &session), http.StatusOK)
+	me := auth.Claims{}
+	assert.Equal(t, do(session.Token, "GET", "/api/v2/auth/me", nil, &me), http.StatusOK)
+	assert.Equal(t, me.Role, database.AccountPatron)
+	assert.Equal(t, me.CardId, card.CardId)
+
+	/* patrons on their own card */
+	own, others := fmt.Sprintf("/api/v2/cards/%d", card.CardId), fmt.Sprintf("/api/v2/cards/%d", other.CardId)
+	assert.Equal(t, do(session.Token, "GET", own+"/borrows", nil, nil), http.StatusOK)
+	assert.Equal(t, do(session.Token, "GET", others+"/borrows", nil, nil), http.StatusForbidden)
+	assert.Equal(t, do(session.Token, "GET", fmt.Sprintf("/api/fine/query?card_id=%d", card.CardId), nil, nil), http.StatusOK)
+	assert.Equal(t, do(session.Token, "GET", fmt.Sprintf("/api/fine/query?card_id=%d", other.CardId), nil, nil), http.StatusForbidden)
+	assert.Equal(t, do(session.Token, "GET", "/api/v2/cards", nil, nil), http.StatusForbidden)
+	assert.Equal(t, do(session.Token, "DELETE", own, nil, nil), http.StatusForbidden)
+	assert.Equal(t, do(session.Token, "GET", accounts, nil, nil), http.StatusForbidden)
+
+	/* removal, which revokes the tokens of the account */
+	assert.Equal(t, do(admin, "DELETE", fmt.Sprintf("%s/%d", accounts, patron.AccountId), nil, nil), http.StatusOK)
+	assert.Equal(t, do(admin, "DELETE", fmt.Sprintf("%s/%d", accounts, patron.AccountId), nil, nil), http.StatusNotFound)
+	assert.Equal(t, do(session.Token, "GET", own+"/borrows", nil, nil), http.StatusUnauthorized)
+	assert.Equal(t, do(admin, "DELETE", fmt.Sprintf("%s/%d", accounts, root.AccountId), nil, nil), http.StatusOK)
+	assert.Equal(t, do(admin, "GET", "/api/v2/auth/me", nil, &me), http.StatusOK)
+	assert.Equal(t, do(admin, "DELETE", fmt.Sprintf("%s/%d", accounts, me.AccountId), nil, nil), http.StatusConflict)
+
+	// with the card of the account
+	bob := signIn(t, "bob", database.AccountPatron, other.CardId)
+	assert.Equal(t, do(bob, "GET", others+"/borrows", nil, nil), http.StatusOK)
+	assert.Equal(t, do(librarian, "DELETE", others, nil, nil), http.StatusOK)
+	assert.Equal(t, do(bob, "GET", others+"/borrows", nil, nil), http.StatusUnauthorized)
+
+	// or when the role of the account changes
+	result := database.DB.Model(&database.Account{}).Where("username = ?", "librarian").Update("role", database.AccountAdmin)
+	assert.Equal(t, result.Error, nil)
+	assert.Equal(t, do(librarian, "GET", "/api/v2/cards", nil, nil), http.StatusUnauthorized)
+}
+
+func TestSelfService(t *testing.T) {
+	database.ResetDatabase()
+	ts := httptest.NewServer(NewHandler())
+	defer ts.Close()
+	do := func(token string, method string, path string, body interface{}, payload interface{}) int {
+		status, _ := request(t, ts.URL, token, method, path, body, payload)
+		return status
+	}
+	librarian := signIn(t, "librarian", database.AccountLibrarian, 0)
+
+	book := database.Book{Category: "CS", Title: "Self", Press: "Press", PublishYear: 2020,
+		Author: "Roy", Price: 10, Stock: 1}
+	assert.Equal(t, do(librarian, "POST", "/api/v2/books", book, &book), http.StatusCreated)
+	card := database.Card{Name: "Alice", Department: "CS", Type: "S"}
+	other := database.Card{Name: "Bob", Department: "CS", Type: "S"}
+	assert.Equal(t, do(librarian, "POST", "/api/v2/cards", card, &card.CardId), http.StatusCreated)
+	assert.Equal(t, do(librarian, "POST", "/api/v2/cards", other, &other.CardId), http.StatusCreated)
+	alice := signIn(t, "alice", database.AccountPatron, card.CardId)
+	bob := signIn(t, "bob", database.AccountPatron, other.CardId)
+
+	// the card in the body is ignored
+	body := map[string]int{"book_id": book.BookId, "card_id": other.CardId}
+	assert.Equal(t, do(alice, "POST", "/api/v2/me/borrows", body, nil), http.StatusCreated)
+	histories := struct {
+		Count int `json:"count"`
+	}{}
+	assert.Equal(t, do(alice, "GET", "/api/v2/me/borrows", nil, &histories), http.StatusOK)
+	assert.Equal(t, histories.Count, 1)
+	assert.Equal(t, do(bob, "GET", "/api/v2/me/borrows", nil, &histories), http.StatusOK)
+	assert.Equal(t, histories.Count, 0)
+
+	// only the borrower renews the loan
+	assert.Equal(t, do(bob, "POST", "/api/v2/me/borrows/renew", body, nil), http.StatusNotFound)
+	assert.Equal(t, do(alice, "POST", "/api/v2/me/borrows/renew", body, nil), http.StatusOK)
+
+	// holds on the book borrowed by alice
+	assert.Equal(t, do(bob, "POST", "/api/v2/me/holds", body, nil), http.StatusCreated)
+	assert.Equal(t, do(alice, "POST", "/api/v2/me/borrows/renew", body, nil), http.StatusConflict)
+	holdPath := fmt.Sprintf("/api/v2/me/holds/%d", book.BookId)
+	assert.Equal(t, do(alice, "DELETE", holdPath, nil, nil), http.StatusNotFound)
+	assert.Equal(t, do(bob, "DELETE", holdPath, nil, nil), http.StatusOK)
+	assert.Equal(t, do(alice, "GET", "/api/v2/me/fines", nil, nil), http.StatusOK)
+
+	// the staff and the anonymous have no card of their own
+	assert.Equal(t, do(librarian, "GET", "/api/v2/me/borrows", nil, nil), http.StatusForbidden)
+	admin := signIn(t, "root", database.AccountAdmin, 0)
+	assert.Equal(t, do(admin, "GET", "/api/v2/me/holds", nil, nil), http.StatusForbidden)
+	assert.Equal(t, do("", "GET", "/api/v2/me/fines", nil, nil), http.StatusUnauthorized)
+}
+
+func TestReportExport(t *testing.T) {
+	database.ResetDatabase()
+	ts := httptest.NewServer(NewHandler())
+	defer ts.Close()
+	librarian := signIn(t, "librarian", database.AccountLibrarian, 0)
+	do := func(token string, path string) (int, string, string) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		assert.Equal(t, err, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Equal(t, err, nil)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		assert.Equal(t, err, nil)
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(body)
+	}
+
+	card := database.Card{Name: "Alice", Department: "Law", Type: "S"}
+	server := Server{}
+	assert.Equal(t, server.RegisterCard(&card).Ok, true)
+
+	status, contentType, body := do(librarian, "/api/v2/reports/cards?format=csv")
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, contentType, "text/csv; charset=utf-8")
+	assert.Equal(t, body, "total,active,dormant\n1,0,1\n")
+	status, contentType, _ = do(librarian, "/api/report/departments")
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, contentType, "application/json")
+
+	status, _, _ = do(librarian, "/api/v2/reports/series?interval=year&format=csv")
+	assert.Equal(t, status, http.StatusBadRequest)
+	status, _, _ = do(librarian, "/api/v2/reports/top-books?format=xml")
+	assert.Equal(t, status, http.StatusBadRequest)
+	status, _, _ = do(librarian, "/api/v2/reports/unknown")
+	assert.Equal(t, status, http.StatusNotFound)
+	patron := signIn(t, "alice", database.AccountPatron, card.CardId)
+	status, _, _ = do(patron, "/api/v2/reports/top-books")
+	assert.Equal(t, status, http.StatusForbidden)
+}
+
+func TestCSVImportExport(t *testing.T) {
+	database.ResetDatabase()
+	ts := httptest.NewServer(NewHandler())
+	defer ts.Close()
+	librarian := signIn(t, "librarian", database.AccountLibrarian, 0)
+	export := func(path string) string {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		assert.Equal(t, err, nil)
+		req.Header.Set("Authorization", "Bearer "+librarian)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Equal(t, err, nil)
+		defer resp.Body.Close()
+		assert.Equal(t, resp.StatusCode, http.StatusOK)
+		assert.Equal(t, resp.Header.Get("Content-Type"), "text/csv; charset=utf-8")
+		body, err := io.ReadAll(resp.Body)
+		assert.Equal(t, err, nil)
+		return string(body)
+	}
+
+	books := "Title,Category,Publisher,Year,Author,Price\n" +
+		"Go,Computer,MIT Press,2020,Alan,10.5\n" +
+		"C,Computer,Prentice Hall,1988,Kernighan,30\n" +
+		"Rust,Computer,No Starch,20x,Steve,20\n"
+	path := "/api/v2/books/import?columns=Publisher=press&columns=Year=publish_year"
+	status, _ := request(t, ts.URL, librarian, http.MethodPost, path, books, nil)
+	assert.Equal(t, status, http.StatusUnprocessableEntity)
+	var result queries.ImportResult
+	status, _ = request(t, ts.URL, librarian, http.MethodPost, path+"&mode=best_effort&dry_run=true", books, &result)
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, result.Imported, 0)
+	assert.Equal(t, result.Errors, []queries.RowError{{Line: 4, Message: `publish_year "20x" is not an integer`, Code: database.ErrInvalidArgument}})
+	status, _ = request(t, ts.URL, librarian, http.MethodPost, path+"&mode=best_effort", books, &result)
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, result.Imported, 2)
+	status, _ = request(t, ts.URL, librarian, http.MethodPost, "/api/v2/books/import?dry_run=maybe", books, nil)
+	assert.Equal(t, status, http.StatusBadRequest)
+
+	/* the export can be imported again */
+	exported := export("/api/v2/books/export")
+	assert.Equal(t, strings.SplitN(exported, "\n", 2)[0], "book_id,category,title,press,publish_year,author,price,stock,isbn")
+	assert.Equal(t, strings.Count(exported, "\n"), 3)
+	database.ResetDatabase()
+	librarian = signIn(t, "librarian", database.AccountLibrarian, 0)
+	status, _ = request(t, ts.URL, librarian, http.MethodPost, "/api/book/import", exported, &result)
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, result.Imported, 2)
+	assert.Equal(t, export("/api/book/export"), exported) // in the same order, so with the same ids
+
+	status, _ = request(t, ts.URL, librarian, http.MethodPost, "/api/v2/cards/import", "name,department,type\nAlice,Law,S\n", &result)
+	assert.Equal(t, status, http.StatusOK)
+	exported = export("/api/v2/cards/export")
+	assert.Equal(t, strings.HasSuffix(exported, ",Alice,Law,S\n"), true)
+}
+
+func TestMARCExport(t *testing.T) {
+	database.ResetDatabase()
+	ts := httptest.NewServer(NewHandler())
+	defer ts.Close()
+	librarian := signIn(t, "librarian", database.AccountLibrarian, 0)
+	export := func(path string) (int, string, string) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		assert.Equal(t, err, nil)
+		req.Header.Set("Authorization", "Bearer "+librarian)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Equal(t, err, nil)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		assert.Equal(t, err, nil)
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(body)
+	}
+
+	server := Server{}
+	book := database.Book{Category: "Computer", Title: "The C programming language", Press: "Prentice Hall",
+		PublishYear: 1988, Author: "Brian W. Kernighan, Dennis M. Ritchie", Price: 30, ISBN: "9780131103627"}
+	assert.Equal(t, server.StoreBook(&book).Ok, true)
+
+	status, contentType, xml := export("/api/v2/books/export?format=marcxml")
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, contentType, "application/marcxml+xml")
+	assert.Equal(t, strings.Contains(xml, `<datafield tag="700" ind1="0" ind2=" ">`), true)
+	status, contentType, iso := export("/api/book/export?format=marc&category_field=084a")
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, contentType, "application/marc")
+	assert.Equal(t, strings.HasSuffix(iso, "\x1d"), true)
+	status, _, _ = export("/api/v2/books/export?format=mods")
+	assert.Equal(t, status, http.StatusBadRequest)
+
+	database.ResetDatabase()
+	librarian = signIn(t, "librarian", database.AccountLibrarian, 0)
+	var result queries.MARCImportResult
+	status, _ = request(t, ts.URL, librarian, http.MethodPost, "/api/v2/books/import/marc?format=marcxml", xml, &result)
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, result.Imported, 1)
+	status, _ = request(t, ts.URL, librarian, http.MethodPost, "/api/v2/books/import/marc", iso, &result)
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, []int{result.Imported, len(result.Errors)}, []int{0, 1}) // no category in 650$a
+	status, ok := request(t, ts.URL, librarian, http.MethodPost, "/api/book/import/marc?category_field=084a", iso, nil)
+	assert.Equal(t, []interface{}{status, ok}, []interface{}{http.StatusOK, false}) // the same book again
+	_, _, exported := export("/api/v2/books/export?format=marcxml")
+	assert.Equal(t, exported, xml)
+}
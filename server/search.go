@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"library-management-system/database"
+	"library-management-system/server/queries"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// the shortest word in the FULLTEXT index of mysql, innodb_ft_min_token_size
+const minFullTextTerm = 3
+
+// searchBooks filters the books of the query by the terms of a full-text search,
+// using the index of the database if any, and returns the relevance of a book
+// to the terms, the higher the more relevant
+func searchBooks(query *gorm.DB, terms []string) (*gorm.DB, clause.Expr) {
+	columns := make([]string, 0, len(queries.SearchFields))
+	weights := make([]string, 0, len(queries.SearchFields))
+	for _, field := range queries.SearchFields {
+		columns = append(columns, field.Name)
+		weights = append(weights, fmt.Sprint(field.Weight))
+	}
+
+	switch database.Search {
+	case database.SearchFTS5:
+		// Every term is a prefix of a word in any column, bm25 is lower for better matches
+		match := make([]string, 0, len(terms))
+		for _, term := range terms {
+			match = append(match, `"`+term+`"*`)
+		}
+		expression := strings.Join(match, " ")
+		query = query.Where("book_id in (select rowid from book_search where book_search match ?)", expression)
+		return query, gorm.Expr("-(select bm25(book_search, "+strings.Join(weights, ", ")+
+			") from book_search where book_search match ? and rowid = books.book_id)", expression)
+	case database.SearchFullText:
+		// Words shorter than the index can hold are searched with like
+		indexed, short := make([]string, 0), make([]string, 0)
+		for _, term := range terms {
+			if utf8.RuneCountInString(term) >= minFullTextTerm {
+				indexed = append(indexed, "+"+term+"*")
+			} else {
+				short = append(short, term)
+			}
+		}
+		query, relevance := likeBooks(query, short)
+		if len(indexed) == 0 {
+			return query, relevance
+		}
+		match := "match (" + strings.Join(columns, ", ") + ") against (? in boolean mode)"
+		against := strings.Join(indexed, " ")
+		query = query.Where(match, against)
+		return query, gorm.Expr(match+" + ?", against, relevance)
+	default:
+		return likeBooks(query, terms)
+	}
+}
+
+// likeBooks filters the books having every term in any of the search fields,
+// and returns the sum of the weights of the fields having each term as the relevance
+func likeBooks(query *gorm.DB, terms []string) (*gorm.DB, clause.Expr) {
+	if len(terms) == 0 {
+		return query, gorm.Expr("0")
+	}
+	cases := make([]string, 0)
+	caseArgs := make([]interface{}, 0)
+	for _, term := range terms {
+		pattern := "%" + term + "%"
+		conditions := make([]string, 0, len(queries.SearchFields))
+		args := make([]interface{}, 0, len(queries.SearchFields))
+		for _, field := range queries.SearchFields {
+			conditions = append(conditions, field.Name+" like ?")
+			args = append(args, pattern)
+			cases = append(cases, fmt.Sprintf("case when %s like ? then %v else 0 end", field.Name, field.Weight))
+			caseArgs = append(caseArgs, pattern)
+		}
+		query = query.Where("("+strings.Join(conditions, " or ")+")", args...)
+	}
+	return query, gorm.Expr(strings.Join(cases, " + "), caseArgs...)
+}
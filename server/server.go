@@ -1,54 +1,174 @@
 package server
 
 import (
+	"library-management-system/database"
+	"library-management-system/server/auth"
+	"library-management-system/server/marc"
+	"library-management-system/server/policy"
 	"net/http"
-	"sync"
 
 	"github.com/rs/cors"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type Config struct {
-	Host string `yaml:"host"`
-	Port string `yaml:"port"`
+	Host           string   `yaml:"host"`
+	Port           string   `yaml:"port"`
+	AllowedOrigins []string `yaml:"allowed_origins"` // origins of the frontend, any origin if empty
 }
 
-var Mutex = &sync.Mutex{}
+// Policy holds the loan limits for each card type and book category
+var Policy, _ = policy.New(policy.Config{})
+
+func InitPolicy(config policy.Config) {
+	p, err := policy.New(config)
+	if err != nil {
+		logrus.Panic("Invalid policy config: ", err)
+	}
+	Policy = p
+}
+
+// MARC tells where the fields of books are in MARC records that are not standard
+var MARC = marc.DefaultMapping
+
+func InitMARC(config marc.Config) {
+	mapping, err := marc.NewMapping(config)
+	if err != nil {
+		logrus.Panic("Invalid marc config: ", err)
+	}
+	MARC = mapping
+}
+
+// Auth signs and verifies the tokens of the accounts
+var Auth auth.Auth
+
+// InitAuth configures the tokens, and creates the admin account in the
+// config if the library has no admin yet
+func InitAuth(config auth.Config) {
+	Auth = auth.New(config)
+
+	var admins int64
+	if err := database.DB.Model(&database.Account{}).Where("role = ?", database.AccountAdmin).Count(&admins).Error; err != nil {
+		logrus.WithError(err).Panic("failed to count admin accounts")
+	}
+	if admins > 0 {
+		return
+	}
+	username, password := Auth.Admin()
+	if username == "" {
+		logrus.Warn("the library has no admin account, configure auth.admin to create one")
+		return
+	}
+	server := Server{}
+	result := server.RegisterAccount(&database.Account{Username: username, Password: password, Role: database.AccountAdmin})
+	if !result.Ok {
+		logrus.Panic("Failed to create admin account: ", result.Message)
+	}
+	logrus.Info("Admin account " + username + " is created")
+}
 
 func InitServer(config Config) {
 	// Configure logrus
 	// initLogger()
-	mux := http.NewServeMux()
+	backfillDueTimes()
+
+	host, port := config.Host, config.Port
+	logrus.Info("Server will run on " + host + ":" + port)
+	err := http.ListenAndServe(host+":"+port, withCORS(NewHandler(), config.AllowedOrigins))
+	if err != nil {
+		logrus.Panic("Failed to start server: ", err)
+		return
+	}
+}
 
-	// Add CORS handler
-	corsHandler := cors.AllowAll()
-	handler := corsHandler.Handler(mux)
+// NewHandler returns the handler of all routes of the API
+func NewHandler() http.Handler {
+	mux := http.NewServeMux()
 
 	// Add routes
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 	})
 
-	mux.HandleFunc("/api/book/add", storeBookHandler)
-	mux.HandleFunc("/api/book/adds", storeBooksHandler)
-	mux.HandleFunc("/api/book/remove", removeBookHandler)
-	mux.HandleFunc("/api/book/query", queryBookHandler)
-	mux.HandleFunc("/api/book/stock", incBookStockHandler)
-	mux.HandleFunc("/api/book/modify", modifyBookHandler)
+	mux.HandleFunc("/api/book/add", authorize(staff, storeBookHandler))
+	mux.HandleFunc("/api/book/adds", authorize(staff, storeBooksHandler))
+	mux.HandleFunc("/api/book/remove", authorize(staff, removeBookHandler))
+	mux.HandleFunc("/api/book/query", authorize(public, queryBookHandler))
+	mux.HandleFunc("/api/book/isbn/{isbn}", authorize(public, queryBookByISBNHandler))
+	mux.HandleFunc("/api/book/contributor/query", authorize(public, showContributorsHandler))
+	mux.HandleFunc("/api/book/contributor/modify", authorize(staff, modifyContributorsHandler))
+	mux.HandleFunc("/api/book/stock", authorize(staff, incBookStockHandler))
+	mux.HandleFunc("/api/book/modify", authorize(staff, modifyBookHandler))
+	mux.HandleFunc("/api/book/import", authorize(staff, importHandler((*Server).ImportBooks, false)))
+	mux.HandleFunc("/api/book/export", authorize(staff, exportBooksHandler(false)))
+	mux.HandleFunc("/api/book/import/marc", authorize(staff, importMARCHandler(false)))
 
-	mux.HandleFunc("/api/card/query", showCardsHandler)
-	mux.HandleFunc("/api/card/add", registerCardHandler)
-	mux.HandleFunc("/api/card/remove", removeCardHandler)
+	mux.HandleFunc("/api/copy/add", authorize(staff, addCopyHandler))
+	mux.HandleFunc("/api/copy/modify", authorize(staff, modifyCopyHandler))
+	mux.HandleFunc("/api/copy/query", authorize(public, showCopiesHandler))
 
-	mux.HandleFunc("/api/borrow/query", showBorrowsHandler)
-	mux.HandleFunc("/api/borrow/add", borrowBookHandler)
-	mux.HandleFunc("/api/borrow/return", returnBookHandler)
+	mux.HandleFunc("/api/card/query", authorize(staff, showCardsHandler))
+	mux.HandleFunc("/api/card/add", authorize(staff, registerCardHandler))
+	mux.HandleFunc("/api/card/remove", authorize(staff, removeCardHandler))
+	mux.HandleFunc("/api/card/import", authorize(staff, importHandler((*Server).ImportCards, false)))
+	mux.HandleFunc("/api/card/export", authorize(staff, exportCardsHandler(false)))
 
-	host, port := config.Host, config.Port
-	logrus.Info("Server will run on " + host + ":" + port)
-	err := http.ListenAndServe(host+":"+port, handler)
-	if err != nil {
-		logrus.Panic("Failed to start server: ", err)
-		return
+	mux.HandleFunc("/api/borrow/query", authorize(ownCard, showBorrowsHandler))
+	mux.HandleFunc("/api/borrow/add", authorize(staff, borrowBookHandler))
+	mux.HandleFunc("/api/borrow/return", authorize(staff, returnBookHandler))
+	mux.HandleFunc("/api/borrow/renew", authorize(staff, renewBookHandler))
+	mux.HandleFunc("/api/borrow/overdue", authorize(staff, showOverdueHandler))
+	mux.HandleFunc("/api/borrow/search", authorize(staff, searchBorrowsHandler))
+
+	mux.HandleFunc("/api/hold/add", authorize(staff, placeHoldHandler))
+	mux.HandleFunc("/api/hold/cancel", authorize(staff, cancelHoldHandler))
+	mux.HandleFunc("/api/hold/query", authorize(ownCard, showHoldsHandler))
+
+	mux.HandleFunc("/api/fine/query", authorize(ownCard, showFinesHandler))
+	mux.HandleFunc("/api/fine/pay", authorize(staff, payFineHandler))
+	mux.HandleFunc("/api/fine/waive", authorize(staff, waiveFineHandler))
+
+	for name := range reports {
+		mux.HandleFunc("/api/report/"+name, authorize(staff, reportHandler(name, false)))
+	}
+
+	mux.HandleFunc("/api/auth/login", authorize(public, loginHandler))
+	mux.HandleFunc("/api/auth/me", authorize(loggedIn, whoAmIHandler))
+	mux.HandleFunc("/api/account/query", authorize(adminOnly, showAccountsHandler))
+	mux.HandleFunc("/api/account/add", authorize(adminOnly, registerAccountHandler))
+	mux.HandleFunc("/api/account/remove", authorize(adminOnly, removeAccountHandler))
+
+	// Add routes of the REST API v2
+	registerV2(mux)
+
+	return mux
+}
+
+// withCORS allows the origins to call the API with a token,
+// or any origin if none is configured
+func withCORS(handler http.Handler, origins []string) http.Handler {
+	if len(origins) == 0 {
+		logrus.Warn("server.allowed_origins is not configured, the API can be called from any origin")
+		origins = []string{"*"}
+	}
+	return cors.New(cors.Options{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+	}).Handler(handler)
+}
+
+// backfillDueTimes sets the due time of borrows created before
+// due times were tracked, using the loan period of the card type
+func backfillDueTimes() {
+	for _, cardType := range []string{"T", "S"} {
+		period := Policy.Resolve(cardType, "").LoanPeriod()
+		if err := database.DB.Model(&database.Borrow{}).
+			Where("due_time = 0 and card_id in (?)",
+				database.DB.Model(&database.Card{}).Select("card_id").Where("type = ?", cardType)).
+			Update("due_time", gorm.Expr("borrow_time + ?", period.Milliseconds())).Error; err != nil {
+			logrus.WithError(err).Warn("failed to backfill due times")
+		}
 	}
 }
@@ -0,0 +1,1327 @@
+// Package apitest holds the test scenarios of utils.ServerInterface,
+// shared by all of its implementations.
+package apitest
+
+import (
+	"fmt"
+	"library-management-system/database"
+	"library-management-system/server/policy"
+	"library-management-system/server/queries"
+	"library-management-system/utils"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// Target is the implementation under test
+type Target struct {
+	Server utils.ServerInterface
+	Reset  func()        // clears all books, cards and borrows, and restarts the ids from 1
+	Policy policy.Policy // the loan policy of the server
+}
+
+func BookRegister(t *testing.T, target Target) {
+	server := target.Server
+	target.Reset()
+
+	b0 := database.Book{
+		Category: "Computer Science", Title: "Database System Concepts",
+		Press: "Machine Industry Press", PublishYear: 2023,
+		Author: "Mike", Price: 188.88, Stock: 10,
+	}
+	assert.Equal(t, server.StoreBook(&b0).Ok, true)
+
+	/* Not allowed to create duplicated records */
+	b1 := database.Book{
+		Category: "Computer Science", Title: "Database System Concepts",
+		Press: "Machine Industry Press", PublishYear: 2023,
+		Author: "Mike", Price: 188.88, Stock: 5,
+	}
+	b2 := database.Book{
+		Category: "Computer Science", Title: "Database System Concepts",
+		Press: "Machine Industry Press", PublishYear: 2023,
+		Author: "Mike", Price: 99.99, Stock: 10,
+	}
+	assert.Equal(t, server.StoreBook(&b1).Ok, false)
+	assert.Equal(t, server.StoreBook(&b2).Ok, false)
+
+	/* check equal function */
+	// records all books generated by test case, include duplicate book
+	originBookList := []*database.Book{&b0, &b1, &b2}
+	// records which books should exist in database
+	actualBookList := make(utils.BookSet)
+	actualBookList.InsertPtr(&b0) // b0 already inserted to database
+	// corresponding to originBookList, mark whether a book is duplicated
+	bookValid := []bool{false, false, false} // b0 already inserted to database, so bookValid[0] is false
+	// Check the books
+	for i, book := range originBookList {
+		if actualBookList.Contains(*book) {
+			assert.Equal(t, bookValid[i], false)
+		} else {
+			actualBookList.InsertPtr(book)
+			assert.Equal(t, bookValid[i], true)
+		}
+	}
+	assert.Equal(t, 1, len(actualBookList))
+
+	/* Generate some books */
+	for i := 0; i < 50; i++ {
+		b := utils.RandomBook()
+		originBookList = append(originBookList, &b)
+		if actualBookList.Contains(b) {
+			bookValid = append(bookValid, false)
+		} else {
+			actualBookList.InsertPtr(&b)
+			bookValid = append(bookValid, true)
+		}
+	}
+	assert.Equal(t, len(originBookList), len(bookValid))
+	assert.Equal(t, len(originBookList) > len(actualBookList), true)
+
+	/* generate some duplicate books */
+	for i := 0; i < 10; i++ {
+		dupIndex := rand.Intn(len(originBookList))
+		ob := originBookList[dupIndex]
+		if bookValid[i] {
+			assert.Equal(t, actualBookList.Contains(*ob), true)
+			cb := *ob
+			// randomly change some attributes
+			if rand.Intn(2) == 0 {
+				cb.Stock = utils.RandomStock()
+				cb.Price = utils.RandomPrice()
+			}
+			assert.Equal(t, actualBookList.Contains(cb), true)
+			originBookList = append(originBookList, &cb)
+			bookValid = append(bookValid, false)
+		}
+	}
+	assert.Equal(t, len(originBookList), len(bookValid))
+	assert.Equal(t, len(originBookList) > len(actualBookList), true)
+
+	/* Bulk load these books */
+	for i, book := range originBookList {
+		if bookValid[i] {
+			assert.Equal(t, server.StoreBook(book).Ok, true)
+		} else {
+			assert.Equal(t, server.StoreBook(book).Ok, false)
+		}
+	}
+
+	/* Use query interface to check correctness */
+	queryResult := server.QueryBooks(queries.BookQueryConditions{})
+	assert.Equal(t, queryResult.Ok, true)
+	selectedResults := queryResult.Payload.(queries.BookQueryResults)
+	assert.Equal(t, len(selectedResults.Results), selectedResults.Count)
+
+	// Sort actual book list by its PK
+	compareBooks := actualBookList.List()
+	sort.Slice(compareBooks, func(i, j int) bool {
+		return compareBooks[i].BookId < compareBooks[j].BookId
+	})
+
+	assert.Equal(t, len(compareBooks), selectedResults.Count)
+	for i := 0; i < len(compareBooks); i++ {
+		// Pointer and Value comparison: just compare the value
+		assert.Equal(t, compareBooks[i], selectedResults.Results[i])
+	}
+}
+
+func IncBookStock(t *testing.T, target Target) {
+	server := target.Server
+	target.Reset()
+
+	const numBooks = 50
+	const numRandomTests = 1000
+	/* simply insert some books to database */
+	target.Reset()
+	var books = make(map[database.Book]int) // Use map to avoid duplicated books
+	var bookIds = make(map[int]int)
+	for i := 0; i < numBooks; i++ {
+		book := utils.RandomBook()
+		books[book] = i
+	}
+
+	var bookList = make([]*database.Book, 0, len(books))
+	for book, i := range books {
+		result := server.StoreBook(&book)
+		assert.Equal(t, result.Ok, true)
+		bookIds[result.Payload.(*database.Book).BookId] = i
+		bookList = append(bookList, &book)
+	}
+	assert.Equal(t, len(books), len(bookIds))
+
+	/* begin tests */
+	type args struct {
+		bookId     int
+		deltaStock int
+	}
+	type test struct {
+		name string
+		args args
+		want database.APIResult
+	}
+	var tests []test
+
+	/* corner case: invalid book id */
+	tests = append(tests, test{
+		name: "Invalid book id - Negative",
+		args: args{bookId: -1, deltaStock: 6},
+		want: database.APIResult{Ok: false},
+	})
+	k := len(books) + 1
+	_, ok := bookIds[k]
+	for ok { // generate an invalid book id
+		k++
+		_, ok = bookIds[k]
+	}
+	tests = append(tests, test{
+		name: "Invalid book id - Maximum",
+		args: args{bookId: k, deltaStock: 10},
+		want: database.APIResult{Ok: false},
+	})
+
+	/* corner case: invalid book stock */
+	lastBook := bookList[len(bookList)-1]
+	tests = append(tests, test{
+		name: "Decrease book stock",
+		args: args{bookId: lastBook.BookId, deltaStock: -lastBook.Stock},
+		want: database.APIResult{Ok: true},
+	})
+	tests = append(tests, test{
+		name: "Increase book stock",
+		args: args{bookId: lastBook.BookId, deltaStock: 1},
+		want: database.APIResult{Ok: true},
+	})
+	tests = append(tests, test{
+		name: "Test for invalid book stock - Negative",
+		args: args{bookId: lastBook.BookId, deltaStock: -2},
+		want: database.APIResult{Ok: false},
+	})
+	lastBook.Stock = 1
+
+	/* randomly choose some books to do this operation */
+	for i := 0; i < numRandomTests; i++ {
+		book := bookList[rand.Intn(len(bookList)-1)]
+		assert.NotEqual(t, book, nil)
+		deltaStock := rand.Intn(24) - 8
+		expected := book.Stock+deltaStock >= 0
+		if expected {
+			book.Stock = book.Stock + deltaStock
+		}
+		tests = append(tests, test{
+			name: fmt.Sprintf("Random test %d", i),
+			args: args{bookId: book.BookId, deltaStock: deltaStock},
+			want: database.APIResult{Ok: expected},
+		})
+	}
+
+	/* run tests */
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := server.IncBookStock(tt.args.bookId, tt.args.deltaStock); got.Ok != tt.want.Ok {
+				t.Errorf("IncBookStock() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	/* use query interface to check correctness */
+	sort.Slice(bookList, func(i, j int) bool {
+		return bookList[i].BookId < bookList[j].BookId
+	})
+	queryResult := server.QueryBooks(queries.BookQueryConditions{})
+	assert.Equal(t, queryResult.Ok, true)
+	selectedResults := queryResult.Payload.(queries.BookQueryResults)
+	assert.Equal(t, len(bookList), selectedResults.Count)
+	for i := 0; i < len(bookList); i++ {
+		assert.Equal(t, bookList[i], selectedResults.Results[i])
+	}
+}
+
+func BulkRegisterBook(t *testing.T, target Target) {
+	const numBulkBooks = 1000
+	const numDuplicateBooks = 3
+	server := target.Server
+	target.Reset()
+
+	/* simply insert some books to database */
+	var books = make(utils.BookSet)
+	for i := 0; i < numBulkBooks; i++ {
+		book := utils.RandomBook()
+		books.Insert(book)
+	}
+
+	/* provide some duplicate records */
+	bookList1 := books.List()
+	for i := 0; i < numDuplicateBooks; i++ {
+		newBook := *bookList1[rand.Intn(len(bookList1))]
+		cb := &newBook
+		// randomly change some attributes
+		if rand.Intn(2) == 0 {
+			cb.Stock = utils.RandomStock()
+			cb.Price = utils.RandomPrice()
+		}
+		bookList1 = append(bookList1, cb)
+	}
+	// shuffle the book list
+	rand.Shuffle(len(bookList1), func(i, j int) {
+		bookList1[i], bookList1[j] = bookList1[j], bookList1[i]
+	})
+	assert.Equal(t, server.StoreBooks(bookList1).Ok, false)
+
+	/* make sure that none of the books are inserted */
+	queryResult1 := server.QueryBooks(queries.BookQueryConditions{})
+	assert.Equal(t, queryResult1.Ok, true)
+	selectedResults1 := queryResult1.Payload.(queries.BookQueryResults)
+	assert.Equal(t, 0, selectedResults1.Count)
+
+	/* normal batch insert */
+	bookList2 := books.List()
+	assert.Equal(t, server.StoreBooks(bookList2).Ok, true)
+	queryResult2 := server.QueryBooks(queries.BookQueryConditions{})
+	assert.Equal(t, queryResult2.Ok, true)
+	selectedResults2 := queryResult2.Payload.(queries.BookQueryResults)
+	assert.Equal(t, len(bookList2), selectedResults2.Count)
+	sort.Slice(bookList2, func(i, j int) bool {
+		return bookList2[i].BookId < bookList2[j].BookId
+	})
+	for i := 0; i < len(bookList2); i++ {
+		assert.Equal(t, bookList2[i], selectedResults2.Results[i])
+	}
+}
+
+func RemoveBook(t *testing.T, target Target) {
+	server := target.Server
+	target.Reset()
+
+	/* simply insert some data to database */
+	library := utils.CreateLibrary(100, 1, 0, server)
+	/* remove a non-exist book */
+	assert.Equal(t, server.RemoveBook(-1).Ok, false)
+
+	/* remove a book that someone has not returned yet */
+	borrow := database.CreateBorrow(library.Cards[0].CardId, library.Books[0].BookId)
+	borrow.ResetBorrowTime()
+	assert.Equal(t, server.BorrowBook(borrow).Ok, true)
+	assert.Equal(t, server.RemoveBook(library.Books[0].BookId).Ok, false)
+	borrow.ResetReturnTime()
+	assert.Equal(t, server.ReturnBook(borrow).Ok, true)
+	assert.Equal(t, server.RemoveBook(library.Books[0].BookId).Ok, true)
+
+	/* remove a non-exist book */
+	assert.Equal(t, server.RemoveBook(library.Books[0].BookId).Ok, false)
+	library.Books = library.Books[1:]
+
+	/* randomly choose nRemove books to remove */
+	nRemove := rand.Intn(40) + 10
+	for i := 0; i < nRemove; i++ {
+		assert.Equal(t, server.RemoveBook(library.Books[0].BookId).Ok, true)
+		/* remove a non-exist book */
+		assert.Equal(t, server.RemoveBook(library.Books[0].BookId).Ok, false)
+		library.Books = library.Books[1:]
+	}
+
+	/* compare results */
+	queryResult1 := server.QueryBooks(queries.BookQueryConditions{})
+	assert.Equal(t, queryResult1.Ok, true)
+	selectedResults1 := queryResult1.Payload.(queries.BookQueryResults)
+	assert.Equal(t, len(library.Books), selectedResults1.Count)
+
+	sort.Slice(library.Books, func(i, j int) bool {
+		return library.Books[i].BookId < library.Books[j].BookId
+	})
+	for i := 0; i < len(library.Books); i++ {
+		assert.Equal(t, library.Books[i], selectedResults1.Results[i])
+	}
+}
+
+func ModifyBookInfo(t *testing.T, target Target) {
+	server := target.Server
+	target.Reset()
+
+	/* simply insert some books to database */
+	books := make(utils.BookSet)
+	for i := 0; i < 100; i++ {
+		books.Insert(utils.RandomBook())
+	}
+	bookList := books.List()
+	for _, book := range bookList {
+		assert.Equal(t, server.StoreBook(book).Ok, true)
+	}
+	/* randomly change books */
+	for _, book := range bookList {
+		// remove old book from book set
+		assert.Equal(t, books.Remove(*book), true)
+		oldStock := book.Stock      // book's stock cannot be changed by modifyBookInfo
+		for books.Contains(*book) { // make sure the new book does not exist in database
+			// use bit mask to determine which field to update
+			var mask = rand.Intn(128)
+			if mask&0b0000_0001 > 0 {
+				book.Category = utils.RandomCategory()
+			}
+			if mask&0b0000_0010 > 0 {
+				book.Title = utils.RandomTitle()
+			}
+			if mask&0b0000_0100 > 0 {
+				book.Press = utils.RandomPress()
+			}
+			if mask&0b0000_1000 > 0 {
+				book.PublishYear = utils.RandomPublishYear()
+			}
+			if mask&0b0001_0000 > 0 {
+				book.Author = utils.RandomAuthor()
+			}
+			if mask&0b0010_0000 > 0 {
+				book.Price = utils.RandomPrice()
+			}
+			if mask&0b0100_0000 > 0 {
+				book.Stock = utils.RandomStock()
+			}
+		}
+		// insert new book to book set
+		books.Insert(*book)
+		assert.Equal(t, server.ModifyBookInfo(book).Ok, true)
+		book.Stock = oldStock
+	}
+	// compare results
+	queryResult := server.QueryBooks(queries.BookQueryConditions{})
+	assert.Equal(t, queryResult.Ok, true)
+	selectedResults := queryResult.Payload.(queries.BookQueryResults)
+	assert.Equal(t, len(bookList), selectedResults.Count)
+	bookList = books.List()
+	sort.Slice(bookList, func(i, j int) bool {
+		return bookList[i].BookId < bookList[j].BookId
+	})
+	for i := 0; i < len(bookList); i++ {
+		assert.Equal(t, bookList[i], selectedResults.Results[i])
+	}
+}
+
+func QueryBook(t *testing.T, target Target) {
+	server := target.Server
+	target.Reset()
+
+	/* simply insert some books to database */
+	my := utils.CreateLibrary(100, 1, 0, server)
+	/* run out of some books */
+	for _, book := range my.Books[:20] {
+		assert.Equal(t, server.IncBookStock(book.BookId, -book.Stock).Ok, true)
+		book.Stock = 0
+	}
+	/* generate single query condition */
+	queryConditions := make([]queries.BookQueryConditions, 0)
+	for i := 0; i < 24; i++ {
+		queryConditions = append(queryConditions, queries.BookQueryConditions{})
+	}
+	queryConditions[0].Category = utils.RandomCategory()
+	queryConditions[1].Title = utils.RandomTitle()
+	queryConditions[2].Press = "Press" // test fuzzy matching
+	queryConditions[3].Press = utils.RandomPress()
+	queryConditions[4].MinPrice = utils.RandomPrice()
+	queryConditions[5].MaxPrice = utils.RandomPrice()
+	queryConditions[6].MinPrice = 20.24
+	queryConditions[6].MaxPrice = 52.42
+	queryConditions[7].MinPublishYear = 2008
+	queryConditions[8].MaxPublishYear = 2020
+	{
+		minY := rand.Intn(15) + 2000
+		maxY := max(minY, rand.Intn(17)+2007)
+		queryConditions[9].MinPublishYear = minY
+		queryConditions[9].MaxPublishYear = maxY
+	}
+	queryConditions[10].Author = "o" // test fuzzy matching
+	queryConditions[11].Author = utils.RandomAuthor()
+	queryConditions[12].SortBy = queries.Price
+	queryConditions[12].SortOrder = queries.Asc
+	queryConditions[13].SortBy = queries.Price
+	queryConditions[13].SortOrder = queries.Desc
+	queryConditions[14].SortBy = queries.PublishYear
+	queryConditions[14].SortOrder = queries.Desc
+	queryConditions[15].Title = "Database System" // test exact matching
+	queryConditions[15].Match = queries.Exact
+	queryConditions[16].Title = utils.RandomTitle()
+	queryConditions[16].Match = queries.Exact
+	queryConditions[17].Press = "press-a" // test case-insensitive fuzzy matching
+	queryConditions[17].Match = queries.Fuzzy
+	queryConditions[18].Categories = []string{"Novel", "Horror"}
+	queryConditions[19].Presses = []string{utils.RandomPress(), utils.RandomPress(), "No Press"}
+	queryConditions[20].Authors = []string{utils.RandomAuthor(), utils.RandomAuthor()}
+	queryConditions[21].ExcludePresses = []string{"Press-A"}
+	queryConditions[22].ExcludeCategories = []string{utils.RandomCategory()}
+	queryConditions[22].ExcludeAuthors = []string{utils.RandomAuthor(), utils.RandomAuthor()}
+	queryConditions[23].InStock = true
+	/* generate multi query conditions */
+	for i := 0; i < 60; i++ {
+		c := queries.BookQueryConditions{}
+		mask := rand.Intn(256)
+		selected := 0
+		if (mask & 1) > 0 {
+			c.Press = utils.RandomPress()
+			selected++
+		}
+		if (mask & 2) > 0 {
+			c.Category = utils.RandomCategory()
+			selected++
+		}
+		if (mask & 4) > 0 {
+			c.Author = utils.RandomAuthor()
+			selected++
+		}
+		if (mask & 8) > 0 {
+			c.Match = queries.Exact
+		}
+		if (mask & 16) > 0 {
+			c.Categories = []string{utils.RandomCategory(), utils.RandomCategory(), utils.RandomCategory()}
+			selected++
+		}
+		if (mask & 32) > 0 {
+			c.ExcludePresses = []string{utils.RandomPress(), utils.RandomPress()}
+			selected++
+		}
+		if (mask & 64) > 0 {
+			c.Authors = []string{utils.RandomAuthor(), utils.RandomAuthor(), utils.RandomAuthor()}
+			c.ExcludeAuthors = []string{utils.RandomAuthor()}
+			selected++
+		}
+		if (mask & 128) > 0 {
+			c.InStock = true
+		}
+		// Randomly select year
+		if rand.Intn(2+selected) == 1 {
+			minY := rand.Intn(15) + 2000
+			maxY := max(rand.Intn(17)+2007, minY+7)
+			c.MinPublishYear = minY
+			c.MaxPublishYear = maxY
+			selected++
+		}
+		// Randomly select price
+		if rand.Intn(3+selected) == 1 {
+			minP := utils.RandomPrice()
+			maxP := max(utils.RandomPrice(), minP+16.66)
+			c.MinPrice = minP
+			c.MaxPrice = maxP
+		}
+		// Randomly choose one column to sort
+		if rand.Intn(4) != 1 {
+			c.SortBy = utils.RandomSortColumn()
+			c.SortOrder = utils.RandomSortOrder()
+		}
+		queryConditions = append(queryConditions, c)
+	}
+
+	// Loop testing
+	for _, queryCondition := range queryConditions {
+		queryResult := server.QueryBooks(queryCondition)
+		assert.Equal(t, queryResult.Ok, true)
+		bookResults := queryResult.Payload.(queries.BookQueryResults)
+		expectedResults := verifyQueryResult(my.Books, queryCondition)
+		assert.Equal(t, len(expectedResults), bookResults.Count)
+		for i := 0; i < len(expectedResults); i++ {
+			assert.Equal(t, expectedResults[i], bookResults.Results[i])
+		}
+	}
+}
+
+func BorrowAndReturnBook(t *testing.T, target Target) {
+	server := target.Server
+	target.Reset()
+
+	// Insert some books & cards & borrow histories to database
+	my := utils.CreateLibrary(50, 50, 100, server)
+
+	// Borrow a non-exists book
+	bookIds := make(map[int]bool)
+	for _, book := range my.Books {
+		bookIds[book.BookId] = true
+	}
+	stockMap := make(map[int]int)
+	for _, book := range my.Books {
+		stockMap[book.BookId] = book.Stock
+	}
+	nbId := rand.Intn(200)
+	for bookIds[nbId] {
+		nbId = rand.Intn(200)
+	}
+	cardIds := make(map[int]bool)
+	for _, card := range my.Cards {
+		cardIds[card.CardId] = true
+	}
+	nb := database.CreateBorrow(my.Cards[0].CardId, nbId)
+	nb.ResetBorrowTime()
+	nb.ResetReturnTime()
+	assert.Equal(t, server.BorrowBook(nb).Ok, false)
+	assert.Equal(t, server.ReturnBook(nb).Ok, false)
+
+	// Card not exists
+	ncId := rand.Intn(200)
+	for cardIds[ncId] {
+		ncId = rand.Intn(200)
+	}
+	nc := database.CreateBorrow(ncId, my.Books[0].BookId)
+	nc.ResetBorrowTime()
+	nc.ResetReturnTime()
+	assert.Equal(t, server.BorrowBook(nc).Ok, false)
+	assert.Equal(t, server.ReturnBook(nc).Ok, false)
+
+	// Book & card both not exist
+	nbc := database.CreateBorrow(ncId, nbId)
+	nbc.ResetBorrowTime()
+	assert.Equal(t, server.BorrowBook(nbc).Ok, false)
+
+	// Borrow a book
+	b0 := my.Books[rand.Intn(len(my.Books))]
+	assert.Equal(t, b0.Stock > 0, true)
+	c0 := my.Cards[rand.Intn(len(my.Cards))]
+	r0 := database.CreateBorrow(c0.CardId, b0.BookId)
+	r0.ResetBorrowTime()
+	r0.ResetReturnTime()
+	assert.Equal(t, server.ReturnBook(r0).Ok, false)
+	assert.Equal(t, server.BorrowBook(r0).Ok, true)
+
+	// Borrow it again
+	r1 := database.CreateBorrow(c0.CardId, b0.BookId)
+	r1.ResetBorrowTime()
+	assert.Equal(t, server.BorrowBook(r1).Ok, false)
+
+	// Return this book
+	// Corner case, for return_time > borrow_time
+	nt := database.CreateBorrow(c0.CardId, b0.BookId)
+	nt.ReturnTime = 666
+	assert.Equal(t, server.ReturnBook(nt).Ok, false)
+	nt.ReturnTime = r0.BorrowTime
+	assert.Equal(t, server.ReturnBook(nt).Ok, false)
+
+	// Normal case
+	r0.ResetReturnTime()
+	assert.Equal(t, server.ReturnBook(r0).Ok, true)
+	my.Borrows = append(my.Borrows, &r0) // Add to borrow list after operation
+
+	// Return this book again
+	r1.ResetReturnTime()
+	assert.Equal(t, server.ReturnBook(r1).Ok, false)
+
+	// Borrow & return this book
+	r2 := database.CreateBorrow(c0.CardId, b0.BookId)
+	r2.ResetBorrowTime()
+	r2.BorrowTime = max(r2.BorrowTime, r0.ReturnTime) // not within the millisecond r0 was borrowed
+	assert.Equal(t, server.BorrowBook(r2).Ok, true)
+	r2.ResetReturnTime()
+	assert.Equal(t, server.ReturnBook(r2).Ok, true)
+	my.Borrows = append(my.Borrows, &r2) // Add to borrow list after operation
+
+	// Try to borrow a zero-stock book
+	assert.Equal(t, server.IncBookStock(b0.BookId, -b0.Stock).Ok, true)
+	r3 := database.CreateBorrow(c0.CardId, b0.BookId)
+	r3.ResetBorrowTime()
+	assert.Equal(t, server.BorrowBook(r3).Ok, false)
+	stockMap[b0.BookId] = 0 // Now b0.stock == 0
+
+	// Randomly borrow & return books
+	var borrowList []*database.Borrow
+	type borrowRecord struct {
+		bookId int
+		CardId int
+	}
+	borrowStatus := make(map[borrowRecord]bool)
+	returnTime := make(map[borrowRecord]int64)
+	for i := 0; i < 1000; i++ {
+		if rand.Intn(2) == 0 && len(borrowList) > 0 { // Do return book
+			k := rand.Intn(len(borrowList))
+			r := borrowList[k]
+			r.ResetReturnTime()
+			assert.Equal(t, server.ReturnBook(*r).Ok, true)
+			borrowList = append(borrowList[:k], borrowList[k+1:]...)
+			delete(borrowStatus, borrowRecord{r.BookId, r.CardId})
+			returnTime[borrowRecord{r.BookId, r.CardId}] = r.ReturnTime
+			my.Borrows = append(my.Borrows, r) // Add to borrow list after operation
+			stockMap[r.BookId]++
+		} else { // Do borrow book
+			b := my.Books[rand.Intn(len(my.Books))]
+			c := my.Cards[rand.Intn(len(my.Cards))]
+			r := database.CreateBorrow(c.CardId, b.BookId)
+			r.ResetBorrowTime()
+			sp := borrowRecord{r.BookId, r.CardId}
+			r.BorrowTime = max(r.BorrowTime, returnTime[sp]) // not within the millisecond it was last borrowed
+			if borrowStatus[sp] || stockMap[r.BookId] == 0 {
+				assert.Equal(t, server.BorrowBook(r).Ok, false)
+			} else {
+				assert.Equal(t, server.BorrowBook(r).Ok, true)
+				borrowStatus[sp] = true
+				borrowList = append(borrowList, &r)
+				stockMap[r.BookId]--
+			}
+		}
+	}
+	// Add un-returned books to borrow histories
+	my.Borrows = append(my.Borrows, borrowList...)
+
+	// Compare borrow histories
+	bookMap := make(map[int]*database.Book)
+	for _, book := range my.Books {
+		bookMap[book.BookId] = book
+	}
+	// Card_id --> borrow_items
+	expectedBorrowMap := make(map[int][]*database.Borrow)
+	for _, borrow := range my.Borrows {
+		item := borrow
+		if _, ok := expectedBorrowMap[borrow.CardId]; !ok {
+			expectedBorrowMap[borrow.CardId] = []*database.Borrow{}
+		}
+		expectedBorrowMap[borrow.CardId] = append(expectedBorrowMap[borrow.CardId], item)
+	}
+	for _, list := range expectedBorrowMap {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].BorrowTime == list[j].BorrowTime {
+				return list[i].BookId < list[j].BookId
+			}
+			return list[i].BorrowTime > list[j].BorrowTime
+		})
+	}
+	for _, card := range my.Cards {
+		result := server.ShowBorrowHistories(card.CardId)
+		assert.Equal(t, result.Ok, true)
+		histories := result.Payload.(queries.BorrowHistories).Items
+		expectedList := expectedBorrowMap[card.CardId]
+		assert.Equal(t, len(expectedList), len(histories))
+		for i := 0; i < len(expectedList); i++ {
+			expected := *expectedList[i]
+			loanPeriod := target.Policy.Resolve(card.Type, bookMap[expected.BookId].Category).LoanPeriod()
+			expected.DueTime = expected.BorrowTime + loanPeriod.Milliseconds()
+			assert.NotEqual(t, histories[i].CopyId, 0)
+			expected.CopyId = histories[i].CopyId
+			assert.Equal(t, expected, histories[i].Borrow)
+			// with the details of the book and the card
+			book := bookMap[expected.BookId]
+			assert.Equal(t, book.Title, histories[i].Title)
+			assert.Equal(t, book.Author, histories[i].Author)
+			assert.Equal(t, book.Category, histories[i].Category)
+			assert.Equal(t, book.Price, histories[i].Price)
+			assert.Equal(t, card.Name, histories[i].Name)
+			assert.Equal(t, card.Department, histories[i].Department)
+			if expected.ReturnTime != 0 {
+				assert.Equal(t, expected.ReturnTime-expected.BorrowTime, histories[i].Duration)
+				status := queries.ReturnedOnTime
+				if expected.ReturnTime > expected.DueTime {
+					status = queries.ReturnedLate
+				}
+				assert.Equal(t, status, histories[i].Status)
+			} else {
+				assert.Equal(t, histories[i].Duration >= 0, true)
+				assert.Equal(t, queries.OnLoan, histories[i].Status)
+			}
+		}
+	}
+}
+
+func ParallelBorrowBook(t *testing.T, target Target) {
+	const numGoroutines = 16
+	server := target.Server
+	target.Reset()
+
+	// Insert some books & cards to database
+	library := utils.CreateLibrary(1, numGoroutines, 0, server)
+	assert.Equal(t, server.IncBookStock(library.Books[0].BookId, -library.Books[0].Stock+1).Ok, true)
+
+	// Create a channel to communicate between goroutines
+	done := make(chan bool)
+	success := make(chan bool, numGoroutines)
+
+	// all goroutines connects to database
+	for i := 0; i < numGoroutines; i++ {
+		go func(i int) {
+			// Each goroutine borrows a book using a different cardId
+			borrow := database.CreateBorrow(library.Cards[i].CardId, 1)
+			result := server.BorrowBook(borrow)
+			if result.Ok {
+				success <- true
+			}
+
+			// Signal that this goroutine is done
+			done <- true
+		}(i)
+	}
+
+	// Wait for all goroutines to finish
+	for i := 0; i < numGoroutines; i++ {
+		<-done
+	}
+
+	// Check if only one goroutine has successfully borrowed the book
+	successCount := 0
+	for i := 0; i < numGoroutines; i++ {
+		select {
+		case <-success:
+			successCount++
+		default:
+		}
+	}
+
+	if successCount != 1 {
+		t.Errorf("Expected 1 goroutine to successfully borrow the book, but got %d", successCount)
+	}
+
+	/* stress: borrow and return the few copies of some books in parallel */
+	const numBooks, numRounds, initialStock = 4, 25, 3
+	target.Reset()
+	library = utils.CreateLibrary(numBooks, numGoroutines, 0, server)
+	for _, book := range library.Books {
+		assert.Equal(t, server.IncBookStock(book.BookId, initialStock-book.Stock).Ok, true)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func(cardId int) {
+			defer wg.Done()
+			// Each goroutine keeps the clock of its card, so that a book is returned after borrowed
+			clock := int64(1)
+			borrowed := make(map[int]bool)
+			for round := 0; round < numRounds; round++ {
+				bookId := library.Books[rand.Intn(numBooks)].BookId
+				var result database.APIResult
+				if borrowed[bookId] {
+					result = server.ReturnBook(database.Borrow{CardId: cardId, BookId: bookId, ReturnTime: clock})
+					borrowed[bookId] = !result.Ok
+				} else {
+					result = server.BorrowBook(database.Borrow{CardId: cardId, BookId: bookId, BorrowTime: clock})
+					borrowed[bookId] = result.Ok
+				}
+				clock++
+				// Conflicts between the transactions are retried, and never surface to the user
+				if result.Code == database.ErrInternal {
+					t.Errorf("Round %d of card %d failed: %s", round, cardId, result.Message)
+				}
+			}
+		}(library.Cards[i].CardId)
+	}
+	wg.Wait()
+
+	// Every copy is either in stock or on loan
+	onLoan := make(map[int]int)
+	for _, card := range library.Cards {
+		histories := server.ShowBorrowHistories(card.CardId)
+		assert.Equal(t, histories.Ok, true)
+		for _, item := range histories.Payload.(queries.BorrowHistories).Items {
+			if item.ReturnTime == 0 {
+				onLoan[item.BookId]++
+			}
+		}
+	}
+	books := server.QueryBooks(queries.BookQueryConditions{})
+	assert.Equal(t, books.Ok, true)
+	for _, book := range books.Payload.(queries.BookQueryResults).Results {
+		if book.Stock < 0 {
+			t.Errorf("Stock of book %d becomes negative: %d", book.BookId, book.Stock)
+		}
+		assert.Equal(t, book.Stock+onLoan[book.BookId], initialStock)
+	}
+
+	/* concurrent returns of the same loan: only one of them succeeds */
+	target.Reset()
+	library = utils.CreateLibrary(1, 1, 0, server)
+	book := library.Books[0]
+	assert.Equal(t, server.IncBookStock(book.BookId, 1-book.Stock).Ok, true)
+	borrow := database.CreateBorrow(library.Cards[0].CardId, book.BookId)
+	assert.Equal(t, server.BorrowBook(borrow).Ok, true)
+	borrow.ReturnTime = borrow.BorrowTime + 1
+	returned := make(chan bool, numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			returned <- server.ReturnBook(borrow).Ok
+		}()
+	}
+	wg.Wait()
+	close(returned)
+	successCount = 0
+	for ok := range returned {
+		if ok {
+			successCount++
+		}
+	}
+	if successCount != 1 {
+		t.Errorf("Expected 1 goroutine to successfully return the book, but got %d", successCount)
+	}
+	books = server.QueryBooks(queries.BookQueryConditions{})
+	assert.Equal(t, books.Payload.(queries.BookQueryResults).Results[0].Stock, 1)
+}
+
+func RegisterAndShowAndRemoveCard(t *testing.T, target Target) {
+	const randomTimes = 20
+	server := target.Server
+	target.Reset()
+
+	/* simply insert N cards */
+	library := utils.CreateLibrary(1, 100, 0, server)
+
+	/* duplicate create */
+	duplicateCard := *library.Cards[rand.Intn(len(library.Cards))]
+	duplicateCard.CardId = 0
+	assert.Equal(t, server.RegisterCard(&duplicateCard).Ok, false)
+
+	/* delete a card that has some un-returned books */
+	delPos := rand.Intn(library.NumCards())
+	delCard := library.Cards[delPos]
+	borrow := database.CreateBorrow(delCard.CardId, library.Books[0].BookId)
+	borrow.ResetBorrowTime()
+	assert.Equal(t, server.BorrowBook(borrow).Ok, true)
+	assert.Equal(t, server.RemoveCard(delCard.CardId).Ok, false)
+	borrow.ResetReturnTime()
+	assert.Equal(t, server.ReturnBook(borrow).Ok, true)
+	assert.Equal(t, server.RemoveCard(delCard.CardId).Ok, true)
+	/* delete a non-exists card */
+	assert.Equal(t, server.RemoveCard(-1).Ok, false)
+	assert.Equal(t, server.RemoveCard(delCard.CardId).Ok, false)
+	// delete this card from library
+	library.Cards = append(library.Cards[:delPos], library.Cards[delPos+1:]...)
+
+	/* randomly delete some cards */
+	rand.Shuffle(len(library.Cards), func(i, j int) {
+		library.Cards[i], library.Cards[j] = library.Cards[j], library.Cards[i]
+	})
+	for i := 0; i < randomTimes; i++ {
+		dCard := library.Cards[0]
+		assert.Equal(t, server.RemoveCard(dCard.CardId).Ok, true)
+		assert.Equal(t, server.RemoveCard(dCard.CardId).Ok, false)
+		library.Cards = library.Cards[1:]
+	}
+
+	/* check cards */
+	sort.Slice(library.Cards, func(i, j int) bool {
+		return library.Cards[i].CardId < library.Cards[j].CardId
+	})
+	result := server.ShowCards()
+	assert.Equal(t, result.Ok, true)
+	selectedResults := result.Payload.(queries.CardList)
+	assert.Equal(t, len(library.Cards), selectedResults.Count)
+	for i := 0; i < len(library.Cards); i++ {
+		assert.Equal(t, library.Cards[i], selectedResults.Cards[i])
+	}
+}
+
+func filter(arr []*database.Book, cond func(*database.Book) bool) []*database.Book {
+	result := []*database.Book{}
+	for _, v := range arr {
+		if cond(v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func verifyQueryResult(books []*database.Book, conditions queries.BookQueryConditions) []*database.Book {
+	var result []*database.Book
+	result = append(result, books...)
+	match := func(s string, value string) bool {
+		if conditions.Match == queries.Exact {
+			return s == value
+		}
+		return strings.Contains(strings.ToLower(s), strings.ToLower(value))
+	}
+	if conditions.Category != "" {
+		result = filter(books, func(book *database.Book) bool {
+			return match(book.Category, conditions.Category)
+		})
+	}
+	if conditions.Title != "" {
+		result = filter(result, func(book *database.Book) bool {
+			return match(book.Title, conditions.Title)
+		})
+	}
+	if conditions.Press != "" {
+		result = filter(result, func(book *database.Book) bool {
+			return match(book.Press, conditions.Press)
+		})
+	}
+	if conditions.MinPublishYear != 0 {
+		result = filter(result, func(book *database.Book) bool {
+			return book.PublishYear >= conditions.MinPublishYear
+		})
+	}
+	if conditions.MaxPublishYear != 0 {
+		result = filter(result, func(book *database.Book) bool {
+			return book.PublishYear <= conditions.MaxPublishYear
+		})
+	}
+	if conditions.Author != "" {
+		result = filter(result, func(book *database.Book) bool {
+			return match(book.Author, conditions.Author)
+		})
+	}
+	if len(conditions.Categories) > 0 {
+		result = filter(result, func(book *database.Book) bool {
+			return slices.Contains(conditions.Categories, book.Category)
+		})
+	}
+	if len(conditions.Presses) > 0 {
+		result = filter(result, func(book *database.Book) bool {
+			return slices.Contains(conditions.Presses, book.Press)
+		})
+	}
+	if len(conditions.Authors) > 0 {
+		result = filter(result, func(book *database.Book) bool {
+			return slices.Contains(conditions.Authors, book.Author)
+		})
+	}
+	result = filter(result, func(book *database.Book) bool {
+		return !slices.Contains(conditions.ExcludeCategories, book.Category) &&
+			!slices.Contains(conditions.ExcludePresses, book.Press) &&
+			!slices.Contains(conditions.ExcludeAuthors, book.Author)
+	})
+	if conditions.InStock {
+		result = filter(result, func(book *database.Book) bool {
+			return book.Stock > 0
+		})
+	}
+	if conditions.MinPrice != 0 {
+		result = filter(result, func(book *database.Book) bool {
+			return book.Price >= conditions.MinPrice
+		})
+	}
+	if conditions.MaxPrice != 0 {
+		result = filter(result, func(book *database.Book) bool {
+			return book.Price <= conditions.MaxPrice
+		})
+	}
+
+	sortBy := queries.BookId
+	if conditions.SortBy != "" {
+		sortBy = conditions.SortBy
+	}
+	cmp := queries.BookComparator(queries.GetComparator(sortBy))
+	if conditions.SortOrder == queries.Desc {
+		cmp = cmp.Reverse()
+	}
+	cmp = cmp.ThenByIdAsc()
+	slices.SortFunc(result, cmp)
+	return result
+}
+
+func ErrorCodes(t *testing.T, target Target) {
+	server := target.Server
+	target.Reset()
+
+	// expect checks the code of a failure, whose payload holds no error
+	expect := func(result database.APIResult, code database.ErrorCode) {
+		t.Helper()
+		assert.Equal(t, result.Ok, false)
+		assert.Equal(t, result.Code, code)
+		assert.Equal(t, result.Payload, nil)
+	}
+
+	/* books */
+	b0 := database.Book{Category: "Computer Science", Title: "Error Codes", Press: "Press",
+		PublishYear: 2024, Author: "Alice", ISBN: "9780306406157", Price: 10, Stock: 1}
+	result := server.StoreBook(&b0)
+	assert.Equal(t, result.Ok, true)
+	assert.Equal(t, result.Code, database.ErrorCode(""))
+	b1 := b0
+	b1.BookId = 0
+	expect(server.StoreBook(&b1), database.ErrDuplicateISBN)
+	b1.ISBN = ""
+	expect(server.StoreBook(&b1), database.ErrDuplicateBook)
+	b1.Title, b1.ISBN = "Error Codes 2", "0-306-40615-3"
+	expect(server.StoreBook(&b1), database.ErrInvalidISBN)
+	expect(server.StoreBooks([]*database.Book{&b1}), database.ErrInvalidISBN)
+	expect(server.IncBookStock(-1, 1), database.ErrBookNotFound)
+	expect(server.IncBookStock(b0.BookId, -2), database.ErrInvalidStock)
+	expect(server.QueryBooks(queries.BookQueryConditions{SortBy: "title; drop table books"}), database.ErrInvalidArgument)
+	expect(server.QueryBooks(queries.BookQueryConditions{Title: "a", Match: "regexp"}), database.ErrInvalidArgument)
+
+	/* cards */
+	c0 := database.Card{Name: "Bob", Department: "Computer Science", Type: "S"}
+	c1 := database.Card{Name: "Carol", Department: "Computer Science", Type: "T"}
+	assert.Equal(t, server.RegisterCard(&c0).Ok, true)
+	assert.Equal(t, server.RegisterCard(&c1).Ok, true)
+	duplicate := c0
+	duplicate.CardId = 0
+	expect(server.RegisterCard(&duplicate), database.ErrDuplicateCard)
+	duplicate.Type = "X"
+	expect(server.RegisterCard(&duplicate), database.ErrInvalidCardType)
+
+	/* borrows */
+	r0 := database.CreateBorrow(c0.CardId, b0.BookId)
+	r0.ResetBorrowTime()
+	expect(server.BorrowBook(database.CreateBorrow(-1, b0.BookId)), database.ErrCardNotFound)
+	expect(server.BorrowBook(database.CreateBorrow(c0.CardId, -1)), database.ErrBookNotFound)
+	assert.Equal(t, server.BorrowBook(r0).Ok, true)
+	r1 := database.CreateBorrow(c1.CardId, b0.BookId)
+	r1.ResetBorrowTime()
+	expect(server.BorrowBook(r1), database.ErrBookOutOfStock)
+	assert.Equal(t, server.IncBookStock(b0.BookId, 1).Ok, true)
+	expect(server.BorrowBook(r0), database.ErrAlreadyBorrowed)
+	expect(server.RemoveBook(b0.BookId), database.ErrBookOnLoan)
+	expect(server.RemoveCard(c0.CardId), database.ErrCardHasLoans)
+	expect(server.ReturnBook(database.Borrow{CardId: c0.CardId, BookId: b0.BookId, BorrowTime: 2, ReturnTime: 1}),
+		database.ErrInvalidTime)
+	r0.ResetReturnTime()
+	assert.Equal(t, server.ReturnBook(r0).Ok, true)
+	expect(server.ReturnBook(r0), database.ErrBorrowNotFound)
+
+	/* removal */
+	assert.Equal(t, server.RemoveCard(c0.CardId).Ok, true)
+	expect(server.RemoveCard(c0.CardId), database.ErrCardNotFound)
+	assert.Equal(t, server.RemoveBook(b0.BookId).Ok, true)
+	expect(server.RemoveBook(b0.BookId), database.ErrBookNotFound)
+	expect(server.ModifyBookInfo(&b0), database.ErrBookNotFound)
+}
+
+func PaginateBooks(t *testing.T, target Target) {
+	const pageSize = 7
+	server := target.Server
+	target.Reset()
+
+	library := utils.CreateLibrary(50, 1, 0, server)
+	query := func(conditions queries.BookQueryConditions) queries.BookQueryResults {
+		t.Helper()
+		result := server.QueryBooks(conditions)
+		assert.Equal(t, result.Ok, true)
+		return result.Payload.(queries.BookQueryResults)
+	}
+
+	for _, sortBy := range []queries.SortColumn{queries.BookId, queries.Title, queries.PublishYear, queries.Price} {
+		for _, sortOrder := range []queries.Order{queries.Asc, queries.Desc} {
+			conditions := queries.BookQueryConditions{SortBy: sortBy, SortOrder: sortOrder}
+			all := query(conditions)
+			assert.Equal(t, all.Count, len(library.Books))
+			assert.Equal(t, all.Total, len(library.Books))
+			assert.Equal(t, all.NextCursor, "")
+
+			/* by offset */
+			paged := make([]database.Book, 0)
+			conditions.Limit = pageSize
+			for conditions.Offset = 0; conditions.Offset < all.Total; conditions.Offset += pageSize {
+				page := query(conditions)
+				assert.Equal(t, page.Total, all.Total)
+				assert.Equal(t, page.Count, min(pageSize, all.Total-conditions.Offset))
+				paged = append(paged, page.Results...)
+			}
+			assert.Equal(t, paged, all.Results)
+
+			/* by cursor */
+			paged = paged[:0]
+			conditions.Offset = 0
+			for {
+				page := query(conditions)
+				assert.Equal(t, page.Total, all.Total)
+				paged = append(paged, page.Results...)
+				if page.NextCursor == "" {
+					break
+				}
+				conditions.Cursor = page.NextCursor
+			}
+			assert.Equal(t, paged, all.Results)
+		}
+	}
+
+	/* books removed before the cursor do not shift the next page */
+	conditions := queries.BookQueryConditions{SortBy: queries.Price, Limit: pageSize}
+	first := query(conditions)
+	assert.Equal(t, server.RemoveBook(first.Results[0].BookId).Ok, true)
+	conditions.Cursor = first.NextCursor
+	second := query(conditions)
+	assert.Equal(t, second.Total, len(library.Books)-1)
+	assert.Equal(t, second.Results[0], query(queries.BookQueryConditions{SortBy: queries.Price}).Results[pageSize-1])
+
+	/* invalid pages */
+	invalid := []queries.BookQueryConditions{
+		{Limit: -1},
+		{Offset: -1},
+		{Limit: pageSize, Offset: pageSize, Cursor: first.NextCursor},
+		{Limit: pageSize, Cursor: "not a cursor"},
+		{SortBy: queries.Title, Limit: pageSize, Cursor: first.NextCursor}, // issued for price
+	}
+	for _, conditions := range invalid {
+		result := server.QueryBooks(conditions)
+		assert.Equal(t, result.Ok, false)
+		assert.Equal(t, result.Code, database.ErrInvalidArgument)
+	}
+}
+
+func SearchBooks(t *testing.T, target Target) {
+	server := target.Server
+	target.Reset()
+
+	books := []*database.Book{
+		{Category: "Computer Science", Title: "Database System Concepts", Press: "McGraw-Hill", Author: "Silberschatz"},
+		{Category: "Computer Science", Title: "Concepts of Programming Languages", Press: "Pearson", Author: "Sebesta"},
+		{Category: "Computer Science", Title: "Introduction to Algorithms", Press: "MIT Press", Author: "Cormen"},
+		{Category: "Database", Title: "The Art of War", Press: "Classics", Author: "Sun Tzu"},
+		{Category: "Computer Science", Title: "Data <Structures> & Algorithms", Press: "Wiley", Author: "Goodrich"},
+		{Category: "Literature", Title: "War and Peace", Press: "Penguin", Author: "Tolstoy"},
+	}
+	for _, book := range books {
+		book.PublishYear, book.Price, book.Stock = 2020, 10, 1
+	}
+	assert.Equal(t, server.StoreBooks(books).Ok, true)
+	search := func(conditions queries.BookQueryConditions) queries.BookQueryResults {
+		t.Helper()
+		result := server.QueryBooks(conditions)
+		assert.Equal(t, result.Ok, true)
+		return result.Payload.(queries.BookQueryResults)
+	}
+	ids := func(results queries.BookQueryResults) []int {
+		ids := make([]int, 0, len(results.Results))
+		for _, book := range results.Results {
+			ids = append(ids, book.BookId)
+		}
+		return ids
+	}
+
+	/* every term matches, in any field */
+	results := search(queries.BookQueryConditions{Q: "Database concepts"})
+	assert.Equal(t, ids(results), []int{books[0].BookId})
+	assert.Equal(t, results.Highlights[books[0].BookId],
+		queries.Highlight{"title": "<mark>Database</mark> System <mark>Concepts</mark>"})
+	results = search(queries.BookQueryConditions{Q: "silber data"})
+	assert.Equal(t, ids(results), []int{books[0].BookId})
+	assert.Equal(t, search(queries.BookQueryConditions{Q: "zzz"}).Total, 0)
+
+	/* ranked by relevance: a match in the title before one in the category */
+	results = search(queries.BookQueryConditions{Q: "database"})
+	assert.Equal(t, ids(results), []int{books[0].BookId, books[3].BookId})
+	assert.Equal(t, results.Highlights[books[3].BookId], queries.Highlight{"category": "<mark>Database</mark>"})
+	results = search(queries.BookQueryConditions{Q: "war", Limit: 1, Offset: 1})
+	assert.Equal(t, results.Total, 2)
+	assert.Equal(t, results.Count, 1)
+	assert.Equal(t, results.NextCursor, "")
+
+	/* with the other conditions and a sort column */
+	results = search(queries.BookQueryConditions{Q: "war", Category: "Literature"})
+	assert.Equal(t, ids(results), []int{books[5].BookId})
+	results = search(queries.BookQueryConditions{Q: "algorithms", SortBy: queries.Title})
+	assert.Equal(t, ids(results), []int{books[4].BookId, books[2].BookId})
+
+	/* highlights are escaped */
+	results = search(queries.BookQueryConditions{Q: "structures"})
+	assert.Equal(t, results.Highlights[books[4].BookId]["title"], "Data &lt;<mark>Structures</mark>&gt; &amp; Algorithms")
+
+	/* a search without words is ignored */
+	assert.Equal(t, search(queries.BookQueryConditions{Q: "&&"}).Total, len(books))
+	result := server.QueryBooks(queries.BookQueryConditions{Q: "war", Limit: 1, Cursor: queries.NewCursor(books[3], "", "")})
+	assert.Equal(t, result.Code, database.ErrInvalidArgument)
+}
+
+func FacetBooks(t *testing.T, target Target) {
+	server := target.Server
+	target.Reset()
+
+	books := []*database.Book{
+		{Category: "Computer Science", Title: "Database System Concepts", Press: "McGraw-Hill", Author: "Silberschatz, Korth", PublishYear: 2019, Price: 80},
+		{Category: "Computer Science", Title: "Operating System Concepts", Press: "Wiley", Author: "Silberschatz", PublishYear: 2018, Price: 120},
+		{Category: "Computer Science", Title: "Introduction to Algorithms", Press: "Addison-Wesley", Author: "Cormen", PublishYear: 2022, Price: 50},
+		{Category: "Literature", Title: "War and Peace", Press: "Penguin", Author: "Tolstoy", PublishYear: 1869, Price: 19.99},
+		{Category: "Literature", Title: "Anna Karenina", Press: "Penguin", Author: "Tolstoy", PublishYear: 1878, Price: 250},
+	}
+	for _, book := range books {
+		book.Stock = 1
+	}
+	assert.Equal(t, server.StoreBooks(books).Ok, true)
+	facet := func(conditions queries.BookQueryConditions) queries.BookQueryResults {
+		t.Helper()
+		conditions.Facets = true
+		result := server.QueryBooks(conditions)
+		assert.Equal(t, result.Ok, true)
+		return result.Payload.(queries.BookQueryResults)
+	}
+
+	/* over all books, regardless of the page */
+	results := facet(queries.BookQueryConditions{Limit: 1})
+	assert.Equal(t, results.Count, 1)
+	assert.Equal(t, results.Facets.Category, []queries.FacetCount{
+		{Value: "Computer Science", Count: 3},
+		{Value: "Literature", Count: 2},
+	})
+	assert.Equal(t, results.Facets.Press, []queries.FacetCount{
+		{Value: "Penguin", Count: 2},
+		{Value: "Addison-Wesley", Count: 1},
+		{Value: "McGraw-Hill", Count: 1},
+		{Value: "Wiley", Count: 1},
+	})
+	assert.Equal(t, results.Facets.Author, []queries.FacetCount{
+		{Value: "Silberschatz", Count: 2},
+		{Value: "Tolstoy", Count: 2},
+		{Value: "Cormen", Count: 1},
+		{Value: "Korth", Count: 1},
+	})
+	assert.Equal(t, results.Facets.PublishYear, []queries.FacetCount{
+		{Value: "1860-1869", Count: 1, Min: 1860, Max: 1870},
+		{Value: "1870-1879", Count: 1, Min: 1870, Max: 1880},
+		{Value: "2010-2019", Count: 2, Min: 2010, Max: 2020},
+		{Value: "2020-2029", Count: 1, Min: 2020, Max: 2030},
+	})
+	assert.Equal(t, results.Facets.Price, []queries.FacetCount{
+		{Value: "0-20", Count: 1, Max: 20},
+		{Value: "50-100", Count: 2, Min: 50, Max: 100},
+		{Value: "100-200", Count: 1, Min: 100, Max: 200},
+		{Value: "200+", Count: 1, Min: 200},
+	})
+
+	/* over the books matching the conditions */
+	results = facet(queries.BookQueryConditions{Category: "Computer Science", MaxPrice: 100})
+	assert.Equal(t, results.Total, 2)
+	assert.Equal(t, results.Facets.Author, []queries.FacetCount{
+		{Value: "Cormen", Count: 1},
+		{Value: "Korth", Count: 1},
+		{Value: "Silberschatz", Count: 1},
+	})
+	assert.Equal(t, results.Facets.Price, []queries.FacetCount{{Value: "50-100", Count: 2, Min: 50, Max: 100}})
+	results = facet(queries.BookQueryConditions{Q: "concepts"})
+	assert.Equal(t, results.Facets.Press, []queries.FacetCount{
+		{Value: "McGraw-Hill", Count: 1},
+		{Value: "Wiley", Count: 1},
+	})
+	results = facet(queries.BookQueryConditions{Title: "nothing"})
+	assert.Equal(t, results.Facets.Category, []queries.FacetCount{})
+	assert.Equal(t, results.Facets.PublishYear, []queries.FacetCount{})
+
+	/* only when requested */
+	result := server.QueryBooks(queries.BookQueryConditions{})
+	assert.Equal(t, result.Ok, true)
+	assert.Equal(t, result.Payload.(queries.BookQueryResults).Facets == nil, true)
+}
+
+func FilterAuthors(t *testing.T, target Target) {
+	server := target.Server
+	target.Reset()
+
+	books := []*database.Book{
+		{Category: "Computer Science", Title: "Database System Concepts", Press: "McGraw-Hill", Author: "Silberschatz, Korth and Sudarshan"},
+		{Category: "Computer Science", Title: "Operating System Concepts", Press: "Wiley", Author: "Silberschatz; Galvin"},
+		{Category: "Computer Science", Title: "The C Programming Language", Press: "Prentice Hall", Author: "Kernighan & Ritchie"},
+		{Category: "Literature", Title: "War and Peace", Press: "Penguin", Author: "Tolstoy"},
+	}
+	for _, book := range books {
+		book.PublishYear, book.Price, book.Stock = 2020, 10, 1
+	}
+	assert.Equal(t, server.StoreBooks(books).Ok, true)
+	ids := func(conditions queries.BookQueryConditions) []int {
+		t.Helper()
+		result := server.QueryBooks(conditions)
+		assert.Equal(t, result.Ok, true)
+		ids := make([]int, 0)
+		for _, book := range result.Payload.(queries.BookQueryResults).Results {
+			ids = append(ids, book.BookId)
+		}
+		return ids
+	}
+
+	/* every author of a book is matched, not only the first one */
+	assert.Equal(t, ids(queries.BookQueryConditions{Author: "sudar"}), []int{books[0].BookId})
+	assert.Equal(t, ids(queries.BookQueryConditions{Author: "Galvin", Match: queries.Exact}), []int{books[1].BookId})
+	assert.Equal(t, ids(queries.BookQueryConditions{Author: "Kernighan & Ritchie", Match: queries.Exact}), []int{books[2].BookId})
+	assert.Equal(t, ids(queries.BookQueryConditions{Authors: []string{"Korth", "Ritchie"}}), []int{books[0].BookId, books[2].BookId})
+	assert.Equal(t, ids(queries.BookQueryConditions{ExcludeAuthors: []string{"Silberschatz"}}), []int{books[2].BookId, books[3].BookId})
+	assert.Equal(t, ids(queries.BookQueryConditions{Authors: []string{"Silberschatz, Korth and Sudarshan"}}), []int{})
+
+	/* as the contributors in the author role */
+	assert.Equal(t, ids(queries.BookQueryConditions{Contributor: "Silberschatz"}), []int{books[0].BookId, books[1].BookId})
+	assert.Equal(t, ids(queries.BookQueryConditions{Contributor: "Silberschatz", Role: database.RoleAuthor}), []int{books[0].BookId, books[1].BookId})
+	assert.Equal(t, ids(queries.BookQueryConditions{Contributor: "Silberschatz", Role: database.RoleEditor}), []int{})
+	assert.Equal(t, ids(queries.BookQueryConditions{Contributor: "Silber"}), []int{})
+}
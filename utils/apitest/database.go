@@ -0,0 +1,52 @@
+package apitest
+
+import (
+	"errors"
+	"fmt"
+	"library-management-system/database"
+	"library-management-system/server/policy"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+type config struct {
+	Database database.Config `yaml:"database"`
+	Policy   policy.Config   `yaml:"policy"`
+}
+
+// ConnectDatabase connects to the database of the config file at path,
+// or to a temporary sqlite database if the config file does not exist.
+//
+// @return the policy of the config file, and a function removing the
+// temporary database
+func ConnectDatabase(path string) (policy.Config, func(), error) {
+	var config config
+	cleanup := func() {}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Run against a temporary sqlite database without config.yaml
+		dir, err := os.MkdirTemp("", "lms-test")
+		if err != nil {
+			return config.Policy, cleanup, err
+		}
+		cleanup = func() { os.RemoveAll(dir) }
+		fmt.Println("Config file not found, testing with sqlite in ", dir)
+		config.Database = database.Config{
+			Driver:   database.DriverSQLite,
+			Database: filepath.Join(dir, "test.db"),
+			LogLevel: "silent",
+		}
+	} else if err != nil {
+		return config.Policy, cleanup, err
+	} else {
+		defer file.Close()
+		if err := yaml.NewDecoder(file).Decode(&config); err != nil {
+			return config.Policy, cleanup, err
+		}
+	}
+
+	database.ConnectDatabase(config.Database)
+	return config.Policy, cleanup, nil
+}
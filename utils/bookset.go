@@ -10,6 +10,7 @@ func getKey(val database.Book) database.BookKey {
 		Title:       val.Title,
 		Press:       val.Press,
 		PublishYear: val.PublishYear,
+		Author:      val.Author,
 	}
 }
 